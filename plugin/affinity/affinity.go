@@ -0,0 +1,124 @@
+package affinity
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// ProcPath is the /proc directory Resolver expects as the root of its filesystem
+const ProcPath = "/proc"
+
+// MaskTTL is how long in nanoseconds a cached mask is trusted before /proc is read again, so that
+// affinity changes keeping the number of allowed CPUs are picked up
+const MaskTTL = 100_000_000
+
+// cachedMask is the allowed CPU list of a task as read at readAt
+type cachedMask struct {
+	nrCpusAllowed  uint64
+	sumExecRuntime uint64 // Never decreases for a task, a lower value means the PID was reused
+	readAt         uint64
+	cpus           []int32
+}
+
+// validFor reports whether the mask still describes t at time now
+func (m *cachedMask) validFor(t *models.QueuedTask, now uint64) bool {
+	if m.nrCpusAllowed != t.NrCpusAllowed || t.SumExecRuntime < m.sumExecRuntime ||
+		util.SaturatingSub(now, m.readAt) >= MaskTTL {
+		return false
+	}
+	// A task seen on a CPU outside the mask had its affinity changed
+	return t.Cpu < 0 || slices.Contains(m.cpus, t.Cpu)
+}
+
+// Resolver resolves the CPUs a task is allowed to run on. QueuedTask only carries the number
+// of allowed CPUs, so restricted tasks are looked up in /proc/<pid>/status and cached for MaskTTL.
+type Resolver struct {
+	procFS fs.FS
+	nrCPUs int
+	now    func() uint64
+	cache  *taskstate.Table[cachedMask]
+}
+
+// NewResolver creates a resolver reading from a filesystem rooted at ProcPath, for a host with
+// nrCPUs CPUs. A nil procFS only resolves unrestricted and pinned tasks.
+func NewResolver(procFS fs.FS, nrCPUs int) *Resolver {
+	r := &Resolver{
+		procFS: procFS,
+		nrCPUs: nrCPUs,
+		now:    util.Now,
+	}
+	r.cache = taskstate.New[cachedMask](taskstate.Options{
+		MaxAge: MaskTTL,
+		Now:    func() uint64 { return r.now() },
+	})
+	return r
+}
+
+// NrCPUs returns the number of CPUs tasks may be allowed to run on
+func (r *Resolver) NrCPUs() int {
+	return r.nrCPUs
+}
+
+// Allowed returns the sorted CPUs the task may run on, or nil if it may run on any CPU.
+// The second result is false when the mask is restricted but could not be determined.
+func (r *Resolver) Allowed(t *models.QueuedTask) ([]int32, bool) {
+	switch {
+	case t.NrCpusAllowed == 0 || t.NrCpusAllowed >= uint64(r.nrCPUs):
+		return nil, true
+	case t.NrCpusAllowed == 1 && t.Cpu >= 0:
+		// A pinned task always runs on its only allowed CPU
+		return []int32{t.Cpu}, true
+	}
+
+	now := r.now()
+	if cached, ok := r.cache.Get(t.Pid); ok && cached.validFor(t, now) {
+		return cached.cpus, true
+	}
+	// Masks are only refreshed on a miss, so expired entries also cover tasks that exited
+	r.cache.EvictExpired()
+	cpus, ok := r.readAllowedList(t.Pid)
+	if !ok {
+		r.cache.Delete(t.Pid)
+		return nil, false
+	}
+	r.cache.Update(t.Pid, func(m *cachedMask) {
+		m.nrCpusAllowed = t.NrCpusAllowed
+		m.sumExecRuntime = t.SumExecRuntime
+		m.readAt = now
+		m.cpus = cpus
+	})
+	return cpus, true
+}
+
+// readAllowedList parses the Cpus_allowed_list line of /proc/<pid>/status
+func (r *Resolver) readAllowedList(pid int32) ([]int32, bool) {
+	if r.procFS == nil {
+		return nil, false
+	}
+	data, err := fs.ReadFile(r.procFS, strconv.Itoa(int(pid))+"/status")
+	if err != nil {
+		return nil, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "Cpus_allowed_list:")
+		if !found {
+			continue
+		}
+		cpus, err := util.ParseCPUList(value)
+		if err != nil || len(cpus) == 0 {
+			return nil, false
+		}
+		return cpus, true
+	}
+	return nil, false
+}
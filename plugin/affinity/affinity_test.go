@@ -0,0 +1,77 @@
+package affinity
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// TestResolverAllowed verifies fast paths and /proc lookups of allowed CPUs
+func TestResolverAllowed(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/status": &fstest.MapFile{Data: []byte("Name:\tworker\nCpus_allowed:\t0f\nCpus_allowed_list:\t0-3\n")},
+		"200/status": &fstest.MapFile{Data: []byte("Name:\tbroken\n")},
+	}
+	r := NewResolver(procFS, 8)
+
+	tests := []struct {
+		name      string
+		task      models.QueuedTask
+		want      []int32
+		wantKnown bool
+	}{
+		{name: "Unknown count", task: models.QueuedTask{Pid: 1, Cpu: 2}, want: nil, wantKnown: true},
+		{name: "All CPUs", task: models.QueuedTask{Pid: 1, Cpu: 2, NrCpusAllowed: 8}, want: nil, wantKnown: true},
+		{name: "Pinned", task: models.QueuedTask{Pid: 1, Cpu: 5, NrCpusAllowed: 1}, want: []int32{5}, wantKnown: true},
+		{name: "Restricted", task: models.QueuedTask{Pid: 100, Cpu: 1, NrCpusAllowed: 4}, want: []int32{0, 1, 2, 3}, wantKnown: true},
+		{name: "Missing list", task: models.QueuedTask{Pid: 200, Cpu: 1, NrCpusAllowed: 4}, want: nil, wantKnown: false},
+		{name: "Exited task", task: models.QueuedTask{Pid: 300, Cpu: 1, NrCpusAllowed: 4}, want: nil, wantKnown: false},
+	}
+	for _, tt := range tests {
+		got, known := r.Allowed(&tt.task)
+		if known != tt.wantKnown || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Allowed = %v, %v; want %v, %v", tt.name, got, known, tt.want, tt.wantKnown)
+		}
+	}
+}
+
+// TestResolverCache verifies that masks are cached until the count, the CPU, the PID or the TTL says otherwise
+func TestResolverCache(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/status": &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t0-3\n")},
+	}
+	now := uint64(0)
+	r := NewResolver(procFS, 8)
+	r.now = func() uint64 { return now }
+	task := &models.QueuedTask{Pid: 100, Cpu: 1, NrCpusAllowed: 4, SumExecRuntime: 1000}
+	r.Allowed(task)
+
+	steps := []struct {
+		name   string
+		list   string
+		update func()
+		want   []int32
+	}{
+		{name: "Cached", list: "4-7", update: func() {}, want: []int32{0, 1, 2, 3}},
+		{name: "CPU outside mask", list: "4-7", update: func() { task.Cpu = 5 }, want: []int32{4, 5, 6, 7}},
+		{name: "Same size change after TTL", list: "0-1,6-7", update: func() { now += MaskTTL }, want: []int32{0, 1, 6, 7}},
+		{name: "Count change", list: "4-6", update: func() { task.NrCpusAllowed = 3; task.Cpu = 4 }, want: []int32{4, 5, 6}},
+		{name: "Reused PID", list: "0-2", update: func() { task.SumExecRuntime = 10 }, want: []int32{0, 1, 2}},
+	}
+	for _, step := range steps {
+		procFS["100/status"] = &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t" + step.list + "\n")}
+		step.update()
+		if got, _ := r.Allowed(task); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: Allowed = %v; want %v", step.name, got, step.want)
+		}
+	}
+
+	// Exited tasks are dropped from the cache
+	delete(procFS, "100/status")
+	now += MaskTTL
+	if _, known := r.Allowed(task); known || r.cache.Len() != 0 {
+		t.Errorf("Exited task: known = %v, cached = %d; want false, 0", known, r.cache.Len())
+	}
+}
@@ -2,6 +2,11 @@ package plugin
 
 // Import built-in plugins for side effects (registration via init)
 import (
+	_ "github.com/Gthulhu/plugin/plugin/baseline"
+	_ "github.com/Gthulhu/plugin/plugin/eevdf"
+	_ "github.com/Gthulhu/plugin/plugin/energy"
 	_ "github.com/Gthulhu/plugin/plugin/gthulhu"
+	_ "github.com/Gthulhu/plugin/plugin/mlfq"
+	_ "github.com/Gthulhu/plugin/plugin/share"
 	_ "github.com/Gthulhu/plugin/plugin/simple"
 )
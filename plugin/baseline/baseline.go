@@ -0,0 +1,188 @@
+// Package baseline implements textbook scheduling policies used as reference points when
+// evaluating the other plugins: strict round-robin and multi-level priority classes.
+package baseline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+func init() {
+	// Register the round-robin plugin
+	err := reg.RegisterNewPlugin("rr", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		return newFromConfig(PolicyRR, config), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Register the priority class plugin
+	err = reg.RegisterNewPlugin("prio", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		return newFromConfig(PolicyPrio, config), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newFromConfig creates a BaselinePlugin with the given policy and the quantum of the config
+func newFromConfig(policy Policy, config *reg.SchedConfig) *BaselinePlugin {
+	baselinePlugin := NewBaselinePlugin(policy)
+	if config.Scheduler.SliceNsDefault > 0 {
+		baselinePlugin.SetQuantum(config.Scheduler.SliceNsDefault)
+	}
+	return baselinePlugin
+}
+
+// Policy selects how the baseline plugin orders tasks
+type Policy int
+
+const (
+	// PolicyRR serves every task in arrival order with the same quantum, ignoring weights
+	PolicyRR Policy = iota
+	// PolicyPrio serves the priority classes in strict order, see Class
+	PolicyPrio
+)
+
+const (
+	quantumDefault   = 5000 * 1000 // 5ms in nanoseconds
+	fifoQuantumScale = 20          // FIFO class tasks run for this many quanta
+	cpuAny           = 1 << 20     // Let the kernel pick any CPU
+)
+
+// BaselinePlugin implements the round-robin and priority class policies
+type BaselinePlugin struct {
+	policy Policy
+
+	// Protects the quantum, queues and statistics
+	mu      sync.Mutex
+	quantum uint64
+
+	// One queue per class, a single queue in round-robin mode
+	queues [nrClasses]queue.FIFO
+	count  int
+
+	// Number of tasks dispatched from each class
+	dispatched [nrClasses]uint64
+}
+
+// Verify that BaselinePlugin implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*BaselinePlugin)(nil)
+
+// NewBaselinePlugin creates a new BaselinePlugin instance with the given policy
+func NewBaselinePlugin(policy Policy) *BaselinePlugin {
+	return &BaselinePlugin{
+		policy:  policy,
+		quantum: quantumDefault,
+	}
+}
+
+// SetQuantum sets the time slice of round-robin tasks
+func (b *BaselinePlugin) SetQuantum(quantum uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.quantum = quantum
+}
+
+// GetQuantum returns the time slice of round-robin tasks
+func (b *BaselinePlugin) GetQuantum() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.quantum
+}
+
+// GetPolicy returns the policy of the plugin
+func (b *BaselinePlugin) GetPolicy() Policy {
+	return b.policy
+}
+
+// classOf returns the queue a task belongs to under the policy of the plugin
+func (b *BaselinePlugin) classOf(task *models.QueuedTask) Class {
+	if b.policy == PolicyRR {
+		return ClassNormal
+	}
+	return ClassOf(task.Weight)
+}
+
+// DrainQueuedTask drains tasks from the scheduler queue into the class queues
+func (b *BaselinePlugin) DrainQueuedTask(s reg.Sched) int {
+	count := 0
+	for {
+		task := &models.QueuedTask{}
+		s.DequeueTask(task)
+		if task.Pid <= 0 {
+			return count
+		}
+
+		b.mu.Lock()
+		b.queues[b.classOf(task)].Push(task)
+		b.count++
+		b.mu.Unlock()
+		count++
+	}
+}
+
+// SelectQueuedTask returns the oldest task of the highest non-empty class
+func (b *BaselinePlugin) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for class := range b.queues {
+		if task := b.queues[class].Pop(); task != nil {
+			b.count--
+			b.dispatched[class]++
+			return task
+		}
+	}
+	return nil
+}
+
+// SelectCPU lets the kernel pick any CPU
+func (b *BaselinePlugin) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	return nil, cpuAny
+}
+
+// DetermineTimeSlice returns the quantum, or a multiple of it for FIFO class tasks so that they
+// run until they block
+func (b *BaselinePlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.classOf(t) == ClassFIFO {
+		return b.quantum * fifoQuantumScale
+	}
+	return b.quantum
+}
+
+// GetPoolCount returns the number of queued tasks
+func (b *BaselinePlugin) GetPoolCount() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return uint64(b.count)
+}
+
+// Stats holds the per-class counters of the plugin, indexed by Class
+type Stats struct {
+	Queued     [nrClasses]int
+	Dispatched [nrClasses]uint64
+}
+
+// GetStats returns the number of tasks queued in and dispatched from each class
+func (b *BaselinePlugin) GetStats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := Stats{Dispatched: b.dispatched}
+	for class := range b.queues {
+		stats.Queued[class] = b.queues[class].Len()
+	}
+	return stats
+}
+
+func (b *BaselinePlugin) SendMetrics(data interface{}) {}
+
+func (b *BaselinePlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return nil, nil
+}
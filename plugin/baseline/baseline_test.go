@@ -0,0 +1,163 @@
+package baseline
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+)
+
+// TestClassOf verifies the mapping of weights to priority classes
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		weight uint64
+		want   Class
+	}{
+		{10000, ClassFIFO},
+		{ClassFIFOMinWeight, ClassFIFO},
+		{ClassFIFOMinWeight - 1, ClassRR},
+		{ClassRRMinWeight, ClassRR},
+		{100, ClassNormal},
+		{ClassNormalMinWeight, ClassNormal},
+		{ClassNormalMinWeight - 1, ClassIdle},
+		{0, ClassIdle},
+	}
+
+	for _, tt := range tests {
+		if got := ClassOf(tt.weight); got != tt.want {
+			t.Errorf("ClassOf(%d) = %v; want %v", tt.weight, got, tt.want)
+		}
+	}
+}
+
+// runSimulation runs the tasks on a single CPU for the given number of dispatches, re-enqueueing
+// each task after it used its time slice, and returns the runtime of each PID
+func runSimulation(t *testing.T, b *BaselinePlugin, tasks []*models.QueuedTask, rounds int) map[int32]uint64 {
+	t.Helper()
+	mockSched := plugintest.NewSched(1)
+	for _, task := range tasks {
+		mockSched.Enqueue(task)
+	}
+
+	runtime := make(map[int32]uint64)
+	for i := 0; i < rounds; i++ {
+		b.DrainQueuedTask(mockSched)
+		task := b.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatalf("round %d: no task selected", i)
+		}
+		if err, cpu := b.SelectCPU(mockSched, task); err != nil || cpu != cpuAny {
+			t.Fatalf("SelectCPU = %d, %v; want cpuAny", cpu, err)
+		}
+		runtime[task.Pid] += b.DetermineTimeSlice(mockSched, task)
+		mockSched.Enqueue(task)
+	}
+	return runtime
+}
+
+// TestBaselineRoundRobin verifies that round-robin serves tasks in turn with the same quantum
+// whatever their weight
+func TestBaselineRoundRobin(t *testing.T) {
+	b := NewBaselinePlugin(PolicyRR)
+	b.SetQuantum(1000)
+	mockSched := plugintest.NewSched(1)
+	weights := []uint64{5000, 100, 1, 300}
+	for i, weight := range weights {
+		mockSched.Enqueue(&models.QueuedTask{Pid: int32(100 + i), Weight: weight})
+	}
+
+	if drained := b.DrainQueuedTask(mockSched); drained != 4 {
+		t.Fatalf("DrainQueuedTask = %d; want 4", drained)
+	}
+	for i := range weights {
+		task := b.SelectQueuedTask(mockSched)
+		if task == nil || task.Pid != int32(100+i) {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, 100+i)
+		}
+		if slice := b.DetermineTimeSlice(mockSched, task); slice != 1000 {
+			t.Errorf("DetermineTimeSlice(%d) = %d; want 1000", task.Pid, slice)
+		}
+	}
+	if b.SelectQueuedTask(mockSched) != nil || b.GetPoolCount() != 0 {
+		t.Error("Pool not empty after selecting every task")
+	}
+
+	// Every task gets the same share of the CPU
+	tasks := make([]*models.QueuedTask, len(weights))
+	for i, weight := range weights {
+		tasks[i] = &models.QueuedTask{Pid: int32(100 + i), Weight: weight}
+	}
+	runtime := runSimulation(t, b, tasks, 400)
+	for pid, got := range runtime {
+		if got != 100*1000 {
+			t.Errorf("PID %d ran %d; want %d", pid, got, 100*1000)
+		}
+	}
+}
+
+// TestBaselinePriorityClasses verifies that classes are served in strict priority order
+func TestBaselinePriorityClasses(t *testing.T) {
+	b := NewBaselinePlugin(PolicyPrio)
+	b.SetQuantum(1000)
+	mockSched := plugintest.NewSched(1)
+	for _, task := range []*models.QueuedTask{
+		{Pid: 100, Weight: 10},   // idle
+		{Pid: 200, Weight: 100},  // normal
+		{Pid: 300, Weight: 500},  // rr
+		{Pid: 400, Weight: 2000}, // fifo
+		{Pid: 201, Weight: 100},  // normal
+		{Pid: 401, Weight: 1000}, // fifo
+	} {
+		mockSched.Enqueue(task)
+	}
+	b.DrainQueuedTask(mockSched)
+
+	stats := b.GetStats()
+	if stats.Queued != [nrClasses]int{2, 1, 2, 1} {
+		t.Errorf("Queued = %v; want [2 1 2 1]", stats.Queued)
+	}
+
+	want := []struct {
+		pid   int32
+		slice uint64
+	}{
+		{400, 1000 * fifoQuantumScale},
+		{401, 1000 * fifoQuantumScale},
+		{300, 1000},
+		{200, 1000},
+		{201, 1000},
+		{100, 1000},
+	}
+	for _, w := range want {
+		task := b.SelectQueuedTask(mockSched)
+		if task == nil || task.Pid != w.pid {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, w.pid)
+		}
+		if slice := b.DetermineTimeSlice(mockSched, task); slice != w.slice {
+			t.Errorf("DetermineTimeSlice(%d) = %d; want %d", task.Pid, slice, w.slice)
+		}
+	}
+
+	stats = b.GetStats()
+	if stats.Dispatched != [nrClasses]uint64{2, 1, 2, 1} || stats.Queued != [nrClasses]int{} {
+		t.Errorf("Stats = %+v; want 2, 1, 2, 1 dispatched and nothing queued", stats)
+	}
+}
+
+// TestBaselinePriorityStarvation verifies that runnable higher classes keep lower ones off the CPU
+// and that tasks of the same class share it in round-robin
+func TestBaselinePriorityStarvation(t *testing.T) {
+	b := NewBaselinePlugin(PolicyPrio)
+	runtime := runSimulation(t, b, []*models.QueuedTask{
+		{Pid: 100, Weight: 100},
+		{Pid: 200, Weight: 500},
+		{Pid: 201, Weight: 500},
+	}, 100)
+
+	if runtime[100] != 0 {
+		t.Errorf("Normal class task ran %d while RR class tasks were runnable", runtime[100])
+	}
+	if runtime[200] != runtime[201] || runtime[200] != 50*quantumDefault {
+		t.Errorf("RR class runtimes = %d and %d; want %d each", runtime[200], runtime[201], 50*quantumDefault)
+	}
+}
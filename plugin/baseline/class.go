@@ -0,0 +1,56 @@
+package baseline
+
+// Class is a priority class of the prio policy, modelled on the Linux scheduling policies.
+// Lower classes run first and a class only runs when every class above it is empty.
+type Class int
+
+const (
+	// ClassFIFO tasks run first, in arrival order, for a long slice (SCHED_FIFO-like)
+	ClassFIFO Class = iota
+	// ClassRR tasks share the CPU in round-robin with the quantum (SCHED_RR-like)
+	ClassRR
+	// ClassNormal tasks share the CPU in round-robin with the quantum (SCHED_OTHER-like)
+	ClassNormal
+	// ClassIdle tasks only run when nothing else is runnable (SCHED_IDLE-like)
+	ClassIdle
+
+	nrClasses = 4
+)
+
+// Minimum task weight of each class. With weight 100 for nice 0, the FIFO class starts around
+// nice -11, the RR class around nice -4 and the idle class around nice 4.
+const (
+	ClassFIFOMinWeight   = 1000
+	ClassRRMinWeight     = 200
+	ClassNormalMinWeight = 50
+)
+
+// ClassOf returns the priority class of a task weight
+func ClassOf(weight uint64) Class {
+	switch {
+	case weight >= ClassFIFOMinWeight:
+		return ClassFIFO
+	case weight >= ClassRRMinWeight:
+		return ClassRR
+	case weight >= ClassNormalMinWeight:
+		return ClassNormal
+	default:
+		return ClassIdle
+	}
+}
+
+// String returns the name of the class
+func (c Class) String() string {
+	switch c {
+	case ClassFIFO:
+		return "fifo"
+	case ClassRR:
+		return "rr"
+	case ClassNormal:
+		return "normal"
+	case ClassIdle:
+		return "idle"
+	default:
+		return "unknown"
+	}
+}
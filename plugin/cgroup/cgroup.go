@@ -0,0 +1,148 @@
+package cgroup
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+const (
+	// ProcPath is the /proc directory Resolver expects as the root of its proc filesystem
+	ProcPath = "/proc"
+	// CgroupfsPath is the cgroup v2 mount Resolver expects as the root of its cgroup filesystem
+	CgroupfsPath = "/sys/fs/cgroup"
+
+	// RootPath is the cgroup of tasks whose cgroup could not be resolved
+	RootPath = "/"
+
+	// WeightDefault is the cpu.weight of cgroups without the cpu controller
+	WeightDefault = 100
+
+	refreshNs = 1000 * 1000 * 1000 // Cached paths and weights are re-read after 1s
+)
+
+// cachedPath is the cgroup of a task and when it was read
+type cachedPath struct {
+	path   string
+	readAt uint64
+}
+
+// cachedWeight is the cpu.weight of a cgroup and when it was read
+type cachedWeight struct {
+	weight uint64
+	readAt uint64
+}
+
+// Resolver maps tasks to their cgroup v2 path and cgroups to their cpu.weight. Results are
+// cached for a second, so tasks moving between cgroups are picked up without a read per enqueue.
+type Resolver struct {
+	procFS   fs.FS
+	cgroupFS fs.FS
+	now      func() uint64
+	paths    *taskstate.Table[cachedPath]
+
+	mu      sync.Mutex
+	weights map[string]cachedWeight
+}
+
+// NewResolver creates a resolver reading task cgroups from a filesystem rooted at ProcPath and
+// cgroup weights from one rooted at CgroupfsPath. A nil filesystem disables the matching lookup.
+func NewResolver(procFS, cgroupFS fs.FS) *Resolver {
+	return &Resolver{
+		procFS:   procFS,
+		cgroupFS: cgroupFS,
+		now:      util.Now,
+		paths:    taskstate.New[cachedPath](taskstate.Options{}),
+		weights:  make(map[string]cachedWeight),
+	}
+}
+
+// SetClock replaces the clock used to expire cached results
+func (r *Resolver) SetClock(now func() uint64) {
+	r.now = now
+}
+
+// Path returns the cgroup of a task, such as "/system.slice/foo.service", or RootPath
+func (r *Resolver) Path(pid int32) string {
+	now := r.now()
+	if cached, ok := r.paths.Get(pid); ok && now-cached.readAt < refreshNs {
+		return cached.path
+	}
+	p := r.readPath(pid)
+	r.paths.Update(pid, func(c *cachedPath) {
+		c.path = p
+		c.readAt = now
+	})
+	return p
+}
+
+// Weight returns the cpu.weight of a cgroup, or WeightDefault if it cannot be read
+func (r *Resolver) Weight(cgroup string) uint64 {
+	now := r.now()
+	r.mu.Lock()
+	cached, ok := r.weights[cgroup]
+	r.mu.Unlock()
+	if ok && now-cached.readAt < refreshNs {
+		return cached.weight
+	}
+
+	weight := r.readWeight(cgroup)
+	r.mu.Lock()
+	r.weights[cgroup] = cachedWeight{weight: weight, readAt: now}
+	r.mu.Unlock()
+	return weight
+}
+
+// Forget drops the cached weight of a cgroup that is no longer tracked
+func (r *Resolver) Forget(cgroup string) {
+	r.mu.Lock()
+	delete(r.weights, cgroup)
+	r.mu.Unlock()
+}
+
+// readPath parses the cgroup v2 entry ("0::<path>") of /proc/<pid>/cgroup
+func (r *Resolver) readPath(pid int32) string {
+	if r.procFS == nil {
+		return RootPath
+	}
+	data, err := fs.ReadFile(r.procFS, strconv.Itoa(int(pid))+"/cgroup")
+	if err != nil {
+		return RootPath
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if p, found := strings.CutPrefix(scanner.Text(), "0::"); found && strings.HasPrefix(p, "/") {
+			return path.Clean(p)
+		}
+	}
+	return RootPath
+}
+
+// readWeight reads <cgroup>/cpu.weight from the cgroup filesystem
+func (r *Resolver) readWeight(cgroup string) uint64 {
+	if r.cgroupFS == nil || cgroup == RootPath {
+		return WeightDefault
+	}
+	data, err := fs.ReadFile(r.cgroupFS, strings.TrimPrefix(cgroup, "/")+"/cpu.weight")
+	if err != nil {
+		return WeightDefault
+	}
+	weight, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || weight == 0 {
+		return WeightDefault
+	}
+	return weight
+}
+
+// Parent returns the parent of a cgroup path, RootPath has no parent and returns itself
+func Parent(cgroup string) string {
+	return path.Dir(cgroup)
+}
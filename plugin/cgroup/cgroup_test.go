@@ -0,0 +1,81 @@
+package cgroup
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// TestResolverPath verifies parsing of /proc/<pid>/cgroup
+func TestResolverPath(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/cgroup": &fstest.MapFile{Data: []byte("0::/system.slice/app.service\n")},
+		"200/cgroup": &fstest.MapFile{Data: []byte("12:cpu,cpuacct:/legacy\n0::/kubepods/pod1/\n")},
+		"300/cgroup": &fstest.MapFile{Data: []byte("4:cpu,cpuacct:/legacy\n")},
+		"400/cgroup": &fstest.MapFile{Data: []byte("0::/\n")},
+	}
+	r := NewResolver(procFS, nil)
+
+	tests := []struct {
+		pid  int32
+		want string
+	}{
+		{pid: 100, want: "/system.slice/app.service"},
+		{pid: 200, want: "/kubepods/pod1"},
+		{pid: 300, want: RootPath},
+		{pid: 400, want: RootPath},
+		{pid: 500, want: RootPath},
+	}
+	for _, tt := range tests {
+		if got := r.Path(tt.pid); got != tt.want {
+			t.Errorf("Path(%d) = %q; want %q", tt.pid, got, tt.want)
+		}
+	}
+}
+
+// TestResolverWeight verifies reading of cpu.weight with defaults for missing or invalid files
+func TestResolverWeight(t *testing.T) {
+	cgroupFS := fstest.MapFS{
+		"a/cpu.weight":   &fstest.MapFile{Data: []byte("200\n")},
+		"a/b/cpu.weight": &fstest.MapFile{Data: []byte("50\n")},
+		"bad/cpu.weight": &fstest.MapFile{Data: []byte("max\n")},
+	}
+	r := NewResolver(nil, cgroupFS)
+
+	tests := []struct {
+		cgroup string
+		want   uint64
+	}{
+		{cgroup: "/a", want: 200},
+		{cgroup: "/a/b", want: 50},
+		{cgroup: "/bad", want: WeightDefault},
+		{cgroup: "/missing", want: WeightDefault},
+		{cgroup: RootPath, want: WeightDefault},
+	}
+	for _, tt := range tests {
+		if got := r.Weight(tt.cgroup); got != tt.want {
+			t.Errorf("Weight(%q) = %d; want %d", tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+// TestResolverCache verifies that paths and weights are re-read once the cache expires
+func TestResolverCache(t *testing.T) {
+	clock := uint64(1)
+	procFS := fstest.MapFS{"100/cgroup": &fstest.MapFile{Data: []byte("0::/a\n")}}
+	cgroupFS := fstest.MapFS{"a/cpu.weight": &fstest.MapFile{Data: []byte("200\n")}}
+	r := NewResolver(procFS, cgroupFS)
+	r.SetClock(func() uint64 { return clock })
+	r.Path(100)
+	r.Weight("/a")
+
+	procFS["100/cgroup"] = &fstest.MapFile{Data: []byte("0::/b\n")}
+	cgroupFS["a/cpu.weight"] = &fstest.MapFile{Data: []byte("300\n")}
+	if got, weight := r.Path(100), r.Weight("/a"); got != "/a" || weight != 200 {
+		t.Errorf("Cached Path, Weight = %q, %d; want /a, 200", got, weight)
+	}
+
+	clock += refreshNs
+	if got, weight := r.Path(100), r.Weight("/a"); got != "/b" || weight != 300 {
+		t.Errorf("Refreshed Path, Weight = %q, %d; want /b, 300", got, weight)
+	}
+}
@@ -0,0 +1,318 @@
+// Package eevdf implements the Earliest Eligible Virtual Deadline First algorithm used by the
+// Linux fair scheduler since 6.6, so that it can be compared with the other plugins.
+//
+// Each task has a vruntime that advances by its execution time scaled by the inverse of its
+// weight, and a lag, the service it is owed compared with the weighted average vruntime V of the
+// queue. Tasks with non-negative lag are eligible, and the eligible task with the earliest
+// virtual deadline, vruntime plus its request size scaled by the inverse of its weight, runs
+// next. As in Linux, a running task stays accounted in V. A task that does not come back within
+// two requests is considered asleep and leaves the run queue, and its lag is restored within a
+// bound when it wakes up, so that tasks can neither bank unbounded credit nor escape their debt.
+package eevdf
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/internal/strategyapi"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+func init() {
+	err := reg.RegisterNewPlugin("eevdf", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		eevdfPlugin := newEEVDFPlugin(config.Scheduler.SliceNsDefault, reg.HostFS(config.Host.Proc, affinity.ProcPath))
+		if config.Scheduler.TaskStateSweepInterval > 0 {
+			eevdfPlugin.tasks.StartSweeper(ctx, time.Duration(config.Scheduler.TaskStateSweepInterval)*time.Second)
+		}
+		// Strategies from the API set per-PID request sizes
+		if err := strategyapi.Start(ctx, config.APIConfig, eevdfPlugin.UpdateStrategyMap); err != nil {
+			return nil, err
+		}
+		return eevdfPlugin, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	sliceDefault  = 3000 * 1000 // 3ms in nanoseconds, the Linux base slice
+	weightDefault = 100         // Weight of a nice 0 task
+	lagSlices     = 2           // Lag is bounded by this many requests
+	sleepRequests = 2           // Running tasks not back after this many requests are asleep
+	cpuAny        = 1 << 20     // Let the kernel pick any CPU
+)
+
+// taskState is the EEVDF state of a task kept across sleeps
+type taskState struct {
+	// vlag is V - vruntime when the task left the run queue, in virtual time
+	vlag int64
+	// sumExec is the SumExecRuntime of the task when it was last queued
+	sumExec uint64
+}
+
+// EEVDFPlugin implements an EEVDF scheduler
+type EEVDFPlugin struct {
+	// Protects the run queue, slice and statistics
+	mu      sync.Mutex
+	rq      runqueue
+	queued  map[int32]*entity
+	running map[int32]*entity
+	slice   uint64
+
+	// Per-PID request sizes set by strategies
+	strategyMu sync.RWMutex
+	requests   map[int32]uint64
+
+	tasks *taskstate.Table[taskState]
+	now   func() uint64
+	stats Stats
+}
+
+// Stats holds the counters of the plugin
+type Stats struct {
+	NrPicks uint64
+	// NrIneligibleSkipped counts picks that passed over a task with negative lag despite its
+	// earlier virtual deadline
+	NrIneligibleSkipped uint64
+	// NrSleeps counts running tasks that left the run queue because they did not come back
+	NrSleeps uint64
+	// NrLagClamped counts tasks whose lag exceeded the bound when they woke up
+	NrLagClamped uint64
+}
+
+// Verify that EEVDFPlugin implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*EEVDFPlugin)(nil)
+
+// NewEEVDFPlugin creates a new EEVDFPlugin with the given base request size (0 uses the default)
+func NewEEVDFPlugin(slice uint64) *EEVDFPlugin {
+	return newEEVDFPlugin(slice, os.DirFS(affinity.ProcPath))
+}
+
+// newEEVDFPlugin creates a plugin detecting exited tasks through the given /proc filesystem
+func newEEVDFPlugin(slice uint64, procFS fs.FS) *EEVDFPlugin {
+	if slice == 0 {
+		slice = sliceDefault
+	}
+	e := &EEVDFPlugin{
+		slice:    slice,
+		queued:   make(map[int32]*entity),
+		running:  make(map[int32]*entity),
+		requests: make(map[int32]uint64),
+		now:      util.Now,
+	}
+	e.tasks = taskstate.New[taskState](taskstate.Options{
+		Now:    func() uint64 { return e.now() },
+		ProcFS: procFS,
+	})
+	return e
+}
+
+// SetClock replaces the clock used to detect sleeping tasks and for per-task state, it must be
+// called before scheduling starts
+func (e *EEVDFPlugin) SetClock(now func() uint64) {
+	e.now = now
+}
+
+// UpdateStrategyMap sets the request size of the PIDs whose strategy has an execution time
+func (e *EEVDFPlugin) UpdateStrategyMap(strategies []util.SchedulingStrategy) {
+	requests := make(map[int32]uint64)
+	for _, strategy := range strategies {
+		if strategy.ExecutionTime > 0 && !strategy.IsModeSwitch() {
+			requests[int32(strategy.PID)] = strategy.ExecutionTime
+		}
+	}
+	e.strategyMu.Lock()
+	e.requests = requests
+	e.strategyMu.Unlock()
+}
+
+// request returns the request size of a task. Must be called with mu held.
+func (e *EEVDFPlugin) request(pid int32) uint64 {
+	e.strategyMu.RLock()
+	defer e.strategyMu.RUnlock()
+	if request, ok := e.requests[pid]; ok {
+		return request
+	}
+	return e.slice
+}
+
+// scale converts a duration to virtual time for the given weight
+func scale(delta, weight uint64) uint64 {
+	return delta * weightDefault / weight
+}
+
+// DrainQueuedTask drains tasks from the scheduler queue into the run queue
+func (e *EEVDFPlugin) DrainQueuedTask(s reg.Sched) int {
+	count := 0
+	for {
+		task := &models.QueuedTask{}
+		s.DequeueTask(task)
+		if task.Pid <= 0 {
+			return count
+		}
+
+		e.mu.Lock()
+		e.expireRunning(e.now())
+		e.enqueue(task)
+		e.mu.Unlock()
+		count++
+	}
+}
+
+// enqueue charges the execution time of a task and queues it. A task coming back from running, or
+// drained again while it is queued, continues from its vruntime, a new or waking task is placed so
+// that it keeps its lag. Must be called with mu held.
+func (e *EEVDFPlugin) enqueue(task *models.QueuedTask) {
+	weight := task.Weight
+	if weight == 0 {
+		weight = weightDefault
+	}
+	request := e.request(task.Pid)
+
+	state, seen := e.tasks.Get(task.Pid)
+	var ran uint64
+	switch {
+	case task.SumExecRuntime > 0:
+		if seen && task.SumExecRuntime > state.sumExec {
+			ran = task.SumExecRuntime - state.sumExec
+		}
+	case task.StopTs > task.StartTs:
+		ran = task.StopTs - task.StartTs
+	}
+	e.tasks.Update(task.Pid, func(state *taskState) {
+		state.sumExec = task.SumExecRuntime
+	})
+
+	ent, running := e.running[task.Pid]
+	queued, requeued := e.queued[task.Pid]
+	switch {
+	case running:
+		delete(e.running, task.Pid)
+		e.rq.remove(ent)
+		ent.vruntime += scale(ran, ent.weight)
+	case requeued:
+		// A task queues a single entity, replaced with the latest state of the task
+		ent = queued
+		e.rq.erase(ent)
+		e.rq.remove(ent)
+		ent.vruntime += scale(ran, ent.weight)
+	default:
+		// Lag left once the execution time is charged, within the bound
+		lag := state.vlag - int64(scale(ran, weight))
+		limit := int64(scale(lagSlices*request, weight))
+		if lag > limit || lag < -limit {
+			lag = max(-limit, min(limit, lag))
+			e.stats.NrLagClamped++
+		}
+		// Adding the task moves V towards it, so the lag is inflated as in Linux for the task to
+		// keep it once queued
+		if e.rq.sumWeight > 0 {
+			lag = lag * int64(e.rq.sumWeight+weight) / int64(e.rq.sumWeight)
+		}
+		ent = &entity{vruntime: uint64(int64(e.rq.avgVruntime()) - lag)}
+	}
+
+	ent.task = task
+	ent.weight = weight
+	ent.request = request
+	ent.deadline = ent.vruntime + scale(request, weight)
+	ent.pickTs = 0
+	task.Vtime = ent.vruntime
+	e.rq.add(ent)
+	e.rq.push(ent)
+	e.queued[task.Pid] = ent
+}
+
+// expireRunning removes the running tasks that did not come back within sleepRequests requests
+// from the run queue, saving their lag. Must be called with mu held.
+func (e *EEVDFPlugin) expireRunning(now uint64) {
+	for pid, ent := range e.running {
+		if now-ent.pickTs < sleepRequests*ent.request {
+			continue
+		}
+		vlag := int64(e.rq.avgVruntime() - ent.vruntime)
+		e.rq.remove(ent)
+		delete(e.running, pid)
+		e.tasks.Update(pid, func(state *taskState) {
+			state.vlag = vlag
+		})
+		e.stats.NrSleeps++
+	}
+}
+
+// SelectQueuedTask returns the eligible task with the earliest virtual deadline
+func (e *EEVDFPlugin) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	e.expireRunning(now)
+	ent, skipped := e.rq.pick()
+	if ent == nil {
+		return nil
+	}
+	e.stats.NrPicks++
+	if skipped {
+		e.stats.NrIneligibleSkipped++
+	}
+
+	delete(e.queued, ent.task.Pid)
+	ent.pickTs = now
+	e.running[ent.task.Pid] = ent
+	return ent.task
+}
+
+// SelectCPU lets the kernel pick any CPU
+func (e *EEVDFPlugin) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	return nil, cpuAny
+}
+
+// DetermineTimeSlice returns the request size of the task
+func (e *EEVDFPlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.request(t.Pid)
+}
+
+// GetPoolCount returns the number of queued tasks
+func (e *EEVDFPlugin) GetPoolCount() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uint64(e.rq.len())
+}
+
+// GetStats returns the counters of the plugin
+func (e *EEVDFPlugin) GetStats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// GetLag returns the lag of a task in virtual time, current if it is on the run queue or as of
+// when it left it otherwise, and whether it is known
+func (e *EEVDFPlugin) GetLag(pid int32) (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ent, ok := e.running[pid]; ok {
+		return int64(e.rq.avgVruntime() - ent.vruntime), true
+	}
+	if ent, ok := e.queued[pid]; ok {
+		return int64(e.rq.avgVruntime() - ent.vruntime), true
+	}
+	state, ok := e.tasks.Get(pid)
+	return state.vlag, ok
+}
+
+func (e *EEVDFPlugin) SendMetrics(data interface{}) {}
+
+func (e *EEVDFPlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return nil, nil
+}
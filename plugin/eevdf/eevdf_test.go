@@ -0,0 +1,251 @@
+package eevdf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// simulation runs CPU-bound tasks on a single CPU, each task using its whole slice
+type simulation struct {
+	t       *testing.T
+	e       *EEVDFPlugin
+	sched   *plugintest.Sched
+	clock   uint64
+	weights map[int32]uint64
+	service map[int32]uint64
+	picks   map[int32][]uint64
+}
+
+// newSimulation queues a task per weight, with PIDs starting at 100
+func newSimulation(t *testing.T, e *EEVDFPlugin, weights ...uint64) *simulation {
+	sim := &simulation{
+		t:       t,
+		e:       e,
+		sched:   plugintest.NewSched(1),
+		weights: make(map[int32]uint64),
+		service: make(map[int32]uint64),
+		picks:   make(map[int32][]uint64),
+	}
+	e.now = func() uint64 { return sim.clock }
+	for i, weight := range weights {
+		pid := int32(100 + i)
+		sim.weights[pid] = weight
+		sim.sched.Enqueue(&models.QueuedTask{Pid: pid, Tgid: pid, Weight: weight, SumExecRuntime: 1})
+	}
+	return sim
+}
+
+// step dispatches the next task and lets it run for its slice
+func (sim *simulation) step() *models.QueuedTask {
+	sim.t.Helper()
+	sim.e.DrainQueuedTask(sim.sched)
+	task := sim.e.SelectQueuedTask(sim.sched)
+	if task == nil {
+		sim.t.Fatal("SelectQueuedTask returned nil")
+	}
+	slice := sim.e.DetermineTimeSlice(sim.sched, task)
+	sim.picks[task.Pid] = append(sim.picks[task.Pid], sim.clock)
+	task.StartTs = sim.clock
+	sim.clock += slice
+	task.StopTs = sim.clock
+	task.SumExecRuntime += slice
+	sim.service[task.Pid] += slice
+	sim.sched.Enqueue(task)
+	return task
+}
+
+// maxServiceError returns the largest difference between the service a task received and its
+// weighted share of the elapsed time
+func (sim *simulation) maxServiceError() uint64 {
+	var totalWeight uint64
+	for _, weight := range sim.weights {
+		totalWeight += weight
+	}
+	var worst uint64
+	for pid, weight := range sim.weights {
+		ideal := sim.clock * weight / totalWeight
+		got := sim.service[pid]
+		worst = max(worst, max(got, ideal)-min(got, ideal))
+	}
+	return worst
+}
+
+// TestEEVDFFairnessBounds verifies that every task stays within a bounded distance of its
+// weighted share of the CPU at every point of the simulation
+func TestEEVDFFairnessBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []uint64
+	}{
+		{name: "EqualWeights", weights: []uint64{100, 100, 100, 100}},
+		{name: "MixedWeights", weights: []uint64{100, 200, 300}},
+		{name: "SkewedWeights", weights: []uint64{50, 1000}},
+		{name: "ManyTasks", weights: []uint64{100, 100, 150, 200, 250, 300, 500, 800}},
+	}
+
+	const slice = 1000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newSimulation(t, NewEEVDFPlugin(slice), tt.weights...)
+			var worst uint64
+			for i := 0; i < 5000; i++ {
+				sim.step()
+				worst = max(worst, sim.maxServiceError())
+			}
+
+			// EEVDF bounds the lag of each task by a couple of requests
+			if worst > 2*slice {
+				t.Errorf("Service error reached %d; want at most %d", worst, 2*slice)
+			}
+		})
+	}
+}
+
+// TestEEVDFRequestSize verifies that smaller requests get the same share with lower latency
+func TestEEVDFRequestSize(t *testing.T) {
+	const slice = 4000
+	e := NewEEVDFPlugin(slice)
+	e.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, ExecutionTime: slice / 4}})
+	sim := newSimulation(t, e, 100, 100)
+
+	for i := 0; i < 2000; i++ {
+		sim.step()
+	}
+	if err := sim.maxServiceError(); err > 2*slice {
+		t.Errorf("Service error = %d; want at most %d", err, 2*slice)
+	}
+
+	// The latency sensitive task never waits for more than one request of the other task
+	var maxGap uint64
+	picks := sim.picks[100]
+	for i := 1; i < len(picks); i++ {
+		maxGap = max(maxGap, picks[i]-picks[i-1])
+	}
+	if maxGap > slice+slice/4 {
+		t.Errorf("Largest gap between dispatches = %d; want at most %d", maxGap, slice+slice/4)
+	}
+	if slice := e.DetermineTimeSlice(nil, &models.QueuedTask{Pid: 100}); slice != 1000 {
+		t.Errorf("DetermineTimeSlice = %d; want 1000", slice)
+	}
+}
+
+// TestEEVDFSleep verifies that tasks that do not come back leave the run queue, and that their lag
+// is restored within the bound when they wake up
+func TestEEVDFSleep(t *testing.T) {
+	const slice = 1000
+	e := NewEEVDFPlugin(slice)
+	sim := newSimulation(t, e, 100, 100, 100)
+	for i := 0; i < 30; i++ {
+		sim.step()
+	}
+
+	// The next task runs for a long time and blocks
+	e.DrainQueuedTask(sim.sched)
+	sleeper := e.SelectQueuedTask(sim.sched)
+	sleeperLag, _ := e.GetLag(sleeper.Pid)
+	sim.clock += 100 * slice
+	sleeper.SumExecRuntime += 100 * slice
+	for i := 0; i < 30; i++ {
+		sim.step()
+	}
+	if stats := e.GetStats(); stats.NrSleeps != 1 {
+		t.Errorf("NrSleeps = %d; want 1", stats.NrSleeps)
+	}
+	if lag, ok := e.GetLag(sleeper.Pid); !ok || lag != sleeperLag {
+		t.Errorf("Lag while asleep = %d, %v; want %d", lag, ok, sleeperLag)
+	}
+
+	// It only carries the bounded debt when it wakes up
+	sim.sched.Enqueue(sleeper)
+	e.DrainQueuedTask(sim.sched)
+	lag, ok := e.GetLag(sleeper.Pid)
+	if !ok || lag != -lagSlices*slice {
+		t.Errorf("Lag after waking up = %d, %v; want %d", lag, ok, -lagSlices*slice)
+	}
+	if stats := e.GetStats(); stats.NrLagClamped != 1 {
+		t.Errorf("NrLagClamped = %d; want 1", stats.NrLagClamped)
+	}
+}
+
+// TestEEVDFFactory verifies that the factory applies the slice configuration and host
+func TestEEVDFFactory(t *testing.T) {
+	config := &reg.SchedConfig{
+		Mode:      "eevdf",
+		Scheduler: reg.Scheduler{SliceNsDefault: 1234},
+		Host:      reg.Host{Proc: fstest.MapFS{}},
+	}
+	scheduler, err := reg.NewSchedulerPlugin(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin: %v", err)
+	}
+	if slice := scheduler.DetermineTimeSlice(nil, &models.QueuedTask{Pid: 1}); slice != 1234 {
+		t.Errorf("DetermineTimeSlice = %d; want 1234", slice)
+	}
+	// PID 1 is missing from the fake /proc of the host
+	tasks := scheduler.(*EEVDFPlugin).tasks
+	tasks.Update(1, func(*taskState) {})
+	if dead := tasks.SweepDead(); dead != 1 {
+		t.Errorf("SweepDead = %d; want 1 with the host /proc", dead)
+	}
+}
+
+// TestEEVDFFactoryAPIStrategies verifies that the factory applies the request sizes fetched from
+// the API server
+func TestEEVDFFactoryAPIStrategies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":true,"scheduling":[{"pid":100,"execution_time":777}]}`))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := &reg.SchedConfig{Mode: "eevdf", APIConfig: reg.APIConfig{
+		Enabled:       true,
+		PublicKeyPath: "unused.pem",
+		BaseURL:       server.URL,
+		Interval:      1,
+	}}
+	scheduler, err := reg.NewSchedulerPlugin(ctx, config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin: %v", err)
+	}
+	task := &models.QueuedTask{Pid: 100}
+	for deadline := time.Now().Add(5 * time.Second); scheduler.DetermineTimeSlice(nil, task) != 777; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Request size from the API was not applied")
+		}
+	}
+}
+
+// TestEEVDFDrainTwice verifies that a task drained again before it is selected stays queued once
+func TestEEVDFDrainTwice(t *testing.T) {
+	e := NewEEVDFPlugin(0)
+	e.SetClock(func() uint64 { return 1 })
+	sched := plugintest.NewSched(1)
+	sched.Enqueue(&models.QueuedTask{Pid: 100, Weight: 100})
+	sched.Enqueue(&models.QueuedTask{Pid: 200, Weight: 100})
+	sched.Enqueue(&models.QueuedTask{Pid: 100, Weight: 100, Vtime: 5})
+	if drained := e.DrainQueuedTask(sched); drained != 3 {
+		t.Fatalf("DrainQueuedTask = %d; want 3", drained)
+	}
+	if count := e.GetPoolCount(); count != 2 {
+		t.Fatalf("GetPoolCount = %d; want 2", count)
+	}
+
+	var pids []int32
+	for task := e.SelectQueuedTask(sched); task != nil; task = e.SelectQueuedTask(sched) {
+		pids = append(pids, task.Pid)
+	}
+	if len(pids) != 2 || pids[0] == pids[1] {
+		t.Errorf("Selected PIDs = %v; want 100 and 200 once each", pids)
+	}
+}
@@ -0,0 +1,261 @@
+package eevdf
+
+import "github.com/Gthulhu/plugin/models"
+
+// entity is a task on the run queue with its EEVDF parameters
+type entity struct {
+	task     *models.QueuedTask
+	weight   uint64
+	request  uint64
+	vruntime uint64
+	deadline uint64
+
+	// pickTs is the time the task was picked to run, 0 while it is queued
+	pickTs uint64
+
+	// Links of the run queue tree, the random priority that keeps it balanced, and the entity with
+	// the earliest virtual deadline of the subtree rooted here
+	left, right *entity
+	priority    uint64
+	minDeadline *entity
+}
+
+// runqueue tracks the weighted average vruntime V of the tasks on the run queue, those queued and
+// those running, and holds the queued ones in a treap ordered by vruntime, each node knowing the
+// earliest virtual deadline of its subtree. As eligible entities are those with a vruntime up to
+// V, the eligible entity with the earliest deadline is found in one walk from the root, like in the
+// Linux augmented rbtree. Like the Linux avg_vruntime, the sums are kept relative to a base
+// vruntime so that they do not overflow.
+type runqueue struct {
+	root *entity
+	n    int
+	seed uint64
+
+	base      uint64
+	sumWeight uint64
+	sumKey    int64 // Sum of weight * (vruntime - base)
+
+	// V when the run queue was last non-empty
+	vtime uint64
+}
+
+// len returns the number of queued entities
+func (q *runqueue) len() int {
+	return q.n
+}
+
+// key returns the vruntime of an entity relative to the base
+func (q *runqueue) key(e *entity) int64 {
+	return int64(e.vruntime - q.base)
+}
+
+// avgVruntime returns the weighted average vruntime V of the run queue
+func (q *runqueue) avgVruntime() uint64 {
+	if q.sumWeight == 0 {
+		return q.vtime
+	}
+	avg := q.sumKey / int64(q.sumWeight)
+	if q.sumKey < 0 && q.sumKey%int64(q.sumWeight) != 0 {
+		avg-- // Round towards negative infinity
+	}
+	return q.base + uint64(avg)
+}
+
+// eligible reports whether an entity has non-negative lag, that is vruntime <= V
+func (q *runqueue) eligible(e *entity) bool {
+	return q.key(e)*int64(q.sumWeight) <= q.sumKey
+}
+
+// rebase moves the base of the sums to V
+func (q *runqueue) rebase() {
+	avg := q.avgVruntime()
+	q.sumKey -= int64(q.sumWeight) * int64(avg-q.base)
+	q.base = avg
+}
+
+// add accounts an entity in V
+func (q *runqueue) add(e *entity) {
+	if q.sumWeight == 0 {
+		q.base = e.vruntime
+	}
+	q.sumWeight += e.weight
+	q.sumKey += int64(e.weight) * q.key(e)
+	q.rebase()
+}
+
+// remove stops accounting an entity in V
+func (q *runqueue) remove(e *entity) {
+	q.vtime = q.avgVruntime()
+	q.sumWeight -= e.weight
+	q.sumKey -= int64(e.weight) * q.key(e)
+	if q.sumWeight == 0 {
+		q.sumKey = 0
+		return
+	}
+	q.rebase()
+}
+
+// push queues an entity that is accounted in V. Its vruntime must not change while it is queued.
+func (q *runqueue) push(e *entity) {
+	// Priorities come from a xorshift64 generator with a fixed seed, so that runs are reproducible
+	if q.seed == 0 {
+		q.seed = 0x9e3779b97f4a7c15
+	}
+	q.seed ^= q.seed << 13
+	q.seed ^= q.seed >> 7
+	q.seed ^= q.seed << 17
+	e.priority = q.seed
+	e.left, e.right, e.minDeadline = nil, nil, e
+	q.root = insert(q.root, e)
+	q.n++
+}
+
+// erase removes a queued entity from the tree, it stays accounted in V
+func (q *runqueue) erase(e *entity) {
+	q.root = erase(q.root, e)
+	e.left, e.right, e.minDeadline = nil, nil, nil
+	q.n--
+}
+
+// pick removes and returns the eligible queued entity with the earliest virtual deadline, and
+// whether an ineligible entity with an earlier deadline was passed over. The entity stays
+// accounted in V. When running entities hold V back so that no queued entity is eligible, the one
+// with the earliest deadline is returned.
+func (q *runqueue) pick() (*entity, bool) {
+	if q.root == nil {
+		return nil, false
+	}
+
+	// The entities of a node and its left subtree are eligible when the node is
+	var picked *entity
+	for node := q.root; node != nil; {
+		if !q.eligible(node) {
+			node = node.left
+			continue
+		}
+		picked = earliest(picked, node)
+		if node.left != nil {
+			picked = earliest(picked, node.left.minDeadline)
+		}
+		node = node.right
+	}
+	first := q.root.minDeadline
+	if picked == nil {
+		picked = first
+	}
+	q.erase(picked)
+	return picked, picked != first
+}
+
+// less orders entities by virtual deadline, then vruntime and PID
+func less(a, b *entity) bool {
+	if a.deadline != b.deadline {
+		return a.deadline < b.deadline
+	}
+	if a.vruntime != b.vruntime {
+		return a.vruntime < b.vruntime
+	}
+	return a.task.Pid < b.task.Pid
+}
+
+// before orders the tree by vruntime, then PID
+func before(a, b *entity) bool {
+	if a.vruntime != b.vruntime {
+		return a.vruntime < b.vruntime
+	}
+	return a.task.Pid < b.task.Pid
+}
+
+// earliest returns the entity with the earliest virtual deadline, a may be nil
+func earliest(a, b *entity) *entity {
+	if a == nil || less(b, a) {
+		return b
+	}
+	return a
+}
+
+// update recomputes the earliest deadline of the subtree rooted at node
+func update(node *entity) {
+	node.minDeadline = node
+	if node.left != nil {
+		node.minDeadline = earliest(node.minDeadline, node.left.minDeadline)
+	}
+	if node.right != nil {
+		node.minDeadline = earliest(node.minDeadline, node.right.minDeadline)
+	}
+}
+
+// insert adds e to the subtree rooted at node and returns its new root
+func insert(node, e *entity) *entity {
+	if node == nil {
+		return e
+	}
+	if before(e, node) {
+		node.left = insert(node.left, e)
+		if node.left.priority > node.priority {
+			node = rotateRight(node)
+		}
+	} else {
+		node.right = insert(node.right, e)
+		if node.right.priority > node.priority {
+			node = rotateLeft(node)
+		}
+	}
+	update(node)
+	return node
+}
+
+// erase removes e from the subtree rooted at node and returns its new root
+func erase(node, e *entity) *entity {
+	if node == nil {
+		return nil
+	}
+	if node == e {
+		return merge(node.left, node.right)
+	}
+	if before(e, node) {
+		node.left = erase(node.left, e)
+	} else {
+		node.right = erase(node.right, e)
+	}
+	update(node)
+	return node
+}
+
+// merge joins two subtrees, every entity of left ordered before those of right
+func merge(left, right *entity) *entity {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = merge(left.right, right)
+		update(left)
+		return left
+	default:
+		right.left = merge(left, right.left)
+		update(right)
+		return right
+	}
+}
+
+// rotateRight lifts the left child of node and returns it
+func rotateRight(node *entity) *entity {
+	child := node.left
+	node.left = child.right
+	child.right = node
+	update(node)
+	update(child)
+	return child
+}
+
+// rotateLeft lifts the right child of node and returns it
+func rotateLeft(node *entity) *entity {
+	child := node.right
+	node.right = child.left
+	child.left = node
+	update(node)
+	update(child)
+	return child
+}
@@ -0,0 +1,131 @@
+package eevdf
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// queueEntity accounts an entity in V and queues it
+func queueEntity(q *runqueue, pid int32, weight, vruntime, deadline uint64) {
+	e := &entity{task: &models.QueuedTask{Pid: pid}, weight: weight, vruntime: vruntime, deadline: deadline}
+	q.add(e)
+	q.push(e)
+}
+
+// TestRunqueueAvgVruntime verifies the weighted average vruntime across rebases
+func TestRunqueueAvgVruntime(t *testing.T) {
+	var q runqueue
+	queueEntity(&q, 1, 100, 1000, 2000)
+	queueEntity(&q, 2, 300, 2000, 3000)
+	if avg := q.avgVruntime(); avg != 1750 {
+		t.Errorf("V = %d; want 1750", avg)
+	}
+
+	// Entities behind the base give negative keys
+	queueEntity(&q, 3, 400, 500, 900)
+	if avg := q.avgVruntime(); avg != 1125 {
+		t.Errorf("V = %d; want 1125", avg)
+	}
+
+	for q.len() > 0 {
+		e, _ := q.pick()
+		q.remove(e)
+	}
+	if q.sumWeight != 0 || q.sumKey != 0 {
+		t.Errorf("Sums = (%d, %d) once empty; want (0, 0)", q.sumWeight, q.sumKey)
+	}
+}
+
+// TestRunqueuePickEligible verifies that the earliest deadline only wins when it is eligible
+func TestRunqueuePickEligible(t *testing.T) {
+	var q runqueue
+	queueEntity(&q, 1, 100, 3000, 3100) // Earliest deadline, but ahead of V
+	queueEntity(&q, 2, 100, 1000, 4000)
+	queueEntity(&q, 3, 100, 1500, 5000)
+
+	e, skipped := q.pick()
+	if e.task.Pid != 2 || !skipped {
+		t.Fatalf("pick = PID %d, skipped %v; want PID 2 passing over PID 1", e.task.Pid, skipped)
+	}
+
+	// Once PID 2 ran and left, V is 2250 so PID 1 is still ineligible
+	q.remove(e)
+	if e, _ := q.pick(); e.task.Pid != 3 {
+		t.Errorf("pick = PID %d; want PID 3", e.task.Pid)
+	}
+	if e, _ := q.pick(); e.task.Pid != 1 {
+		t.Errorf("pick = PID %d; want PID 1", e.task.Pid)
+	}
+	if e, _ := q.pick(); e != nil {
+		t.Errorf("pick on an empty queue = PID %d; want nil", e.task.Pid)
+	}
+}
+
+// TestRunqueuePickFallback verifies that a task is picked when running tasks hold V back
+func TestRunqueuePickFallback(t *testing.T) {
+	var q runqueue
+	running := &entity{task: &models.QueuedTask{Pid: 1}, weight: 1000, vruntime: 100}
+	q.add(running)
+	queueEntity(&q, 2, 100, 5000, 6000)
+	queueEntity(&q, 3, 100, 4000, 7000)
+
+	if e, skipped := q.pick(); e == nil || e.task.Pid != 2 || skipped {
+		t.Errorf("pick = %v, skipped %v; want PID 2 without skipping", e, skipped)
+	}
+}
+
+// TestRunqueuePickMatchesScan verifies the tree walk against a scan of every queued entity, over
+// random pushes, picks, erases and changes of V
+func TestRunqueuePickMatchesScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var q runqueue
+	var queued []*entity
+	for i := 0; i < 5000; i++ {
+		switch op := rng.Intn(4); {
+		case op < 2 || len(queued) == 0:
+			vruntime := uint64(rng.Intn(10000))
+			e := &entity{
+				task:     &models.QueuedTask{Pid: int32(i + 1)},
+				weight:   uint64(1 + rng.Intn(300)),
+				vruntime: vruntime,
+				deadline: vruntime + uint64(rng.Intn(5000)),
+			}
+			q.add(e)
+			q.push(e)
+			queued = append(queued, e)
+		case op == 2:
+			// Leaving entities move V both ways
+			idx := rng.Intn(len(queued))
+			q.erase(queued[idx])
+			q.remove(queued[idx])
+			queued = append(queued[:idx], queued[idx+1:]...)
+		default:
+			var want, first *entity
+			for _, e := range queued {
+				first = earliest(first, e)
+				if q.eligible(e) {
+					want = earliest(want, e)
+				}
+			}
+			if want == nil {
+				want = first
+			}
+			e, skipped := q.pick()
+			if e != want || skipped != (want != first) {
+				t.Fatalf("pick = PID %d, skipped %v; want PID %d, skipped %v", e.task.Pid, skipped, want.task.Pid, want != first)
+			}
+			q.remove(e)
+			for idx := range queued {
+				if queued[idx] == e {
+					queued = append(queued[:idx], queued[idx+1:]...)
+					break
+				}
+			}
+		}
+		if q.len() != len(queued) {
+			t.Fatalf("len = %d; want %d", q.len(), len(queued))
+		}
+	}
+}
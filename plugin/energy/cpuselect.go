@@ -0,0 +1,131 @@
+package energy
+
+import (
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// SelectCPU places a task among the CPUs it is allowed to run on. Below the spread threshold it
+// packs the task onto the busiest CPU with room left under the pack threshold, and only wakes an
+// idle CPU when there is none, preferring SMT siblings of busy cores. Above the spread threshold
+// it picks the CPU expected to be free first.
+func (e *EnergyPlugin) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	candidates, ok := e.candidateCPUs(t)
+
+	e.mu.Lock()
+	if !ok {
+		e.stats.NrFallback++
+		e.mu.Unlock()
+		return s.DefaultSelectCPU(t)
+	}
+	now := e.now()
+	e.rollWindow(now)
+	e.expireReservations(now)
+
+	// Tasks are expected to run as long as they did last time
+	runtime := e.slice
+	if t.StopTs > t.StartTs {
+		runtime = min(t.StopTs-t.StartTs, e.slice)
+	}
+
+	var cpu int32
+	if e.averageUtil() > e.spreadThreshold*utilScale/100 {
+		cpu = e.earliestFreeCPU(candidates, now)
+		e.stats.NrSpread++
+	} else if cpu = e.packCPU(candidates, runtime, now); cpu >= 0 {
+		e.stats.NrPacked++
+	} else {
+		cpu = e.wakeCPU(candidates, now)
+		e.stats.NrWoken++
+	}
+	e.reserve(cpu, t.Pid, runtime, now)
+	e.mu.Unlock()
+	return nil, cpu
+}
+
+// candidateCPUs returns the online CPUs the task is allowed to run on. The second result is false
+// when the task must be left to DefaultSelectCPU: there is no topology, its affinity is unknown or
+// it may not run on any online CPU.
+func (e *EnergyPlugin) candidateCPUs(t *models.QueuedTask) ([]int32, bool) {
+	e.mu.Lock()
+	topo, resolver := e.topology, e.affinity
+	e.mu.Unlock()
+	if topo == nil {
+		return nil, false
+	}
+
+	allowed, known := resolver.Allowed(t)
+	if !known {
+		return nil, false
+	}
+	if allowed == nil {
+		return topo.Online, true
+	}
+	candidates := util.IntersectCPUs(allowed, topo.Online)
+	return candidates, len(candidates) > 0
+}
+
+// averageUtil returns the average utilization of the online CPUs. Must be called with mu held.
+func (e *EnergyPlugin) averageUtil() uint64 {
+	var sum uint64
+	for _, cpu := range e.topology.Online {
+		sum += e.cpus[cpu].util
+	}
+	return sum / uint64(len(e.topology.Online))
+}
+
+// packCPU returns the busy candidate with the highest load that stays under the pack threshold
+// with the task, or -1 if there is none. Must be called with mu held.
+func (e *EnergyPlugin) packCPU(candidates []int32, runtime, now uint64) int32 {
+	limit := e.packThreshold * utilScale / 100
+	demand := runtime * utilScale / utilWindow
+	best, bestLoad := int32(-1), uint64(0)
+	for _, cpu := range candidates {
+		if !e.busy(cpu) {
+			continue
+		}
+		load := e.load(cpu, now)
+		if load+demand <= limit && (best < 0 || load > bestLoad) {
+			best, bestLoad = cpu, load
+		}
+	}
+	return best
+}
+
+// wakeCPU returns the idle candidate that costs the least energy to wake up: an SMT sibling of a
+// busy core, else the lowest CPU ID so that the same CPUs are reused. When every candidate is
+// busy it returns the one expected to be free first. Must be called with mu held.
+func (e *EnergyPlugin) wakeCPU(candidates []int32, now uint64) int32 {
+	firstIdle := int32(-1)
+	for _, cpu := range candidates {
+		if e.busy(cpu) {
+			continue
+		}
+		for _, sibling := range e.topology.CPUs[cpu].Siblings {
+			if sibling != cpu && e.busy(sibling) {
+				return cpu
+			}
+		}
+		if firstIdle < 0 {
+			firstIdle = cpu
+		}
+	}
+	if firstIdle >= 0 {
+		return firstIdle
+	}
+	return e.earliestFreeCPU(candidates, now)
+}
+
+// earliestFreeCPU returns the candidate expected to be free first, the least utilized one among
+// those with the same backlog. Must be called with mu held.
+func (e *EnergyPlugin) earliestFreeCPU(candidates []int32, now uint64) int32 {
+	best := candidates[0]
+	for _, cpu := range candidates[1:] {
+		backlog, bestBacklog := e.backlog(cpu, now), e.backlog(best, now)
+		if backlog < bestBacklog || (backlog == bestBacklog && e.cpus[cpu].util < e.cpus[best].util) {
+			best = cpu
+		}
+	}
+	return best
+}
@@ -0,0 +1,206 @@
+// Package energy implements an energy-aware scheduler for battery-powered and power-capped hosts.
+// While the load is low it packs tasks onto as few CPUs as possible, so that the other cores can
+// stay in deep idle states, and only spreads tasks over idle CPUs once the average utilization
+// exceeds a threshold. The utilization of each CPU is derived from the execution time of the
+// tasks dispatched there.
+package energy
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/topology"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+func init() {
+	err := reg.RegisterNewPlugin("energy", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		energyPlugin := newEnergyPlugin(config.Scheduler.SliceNsDefault, reg.HostFS(config.Host.Proc, affinity.ProcPath))
+		err := energyPlugin.SetThresholds(config.Scheduler.EnergyPackThreshold, config.Scheduler.EnergySpreadThreshold)
+		if err != nil {
+			return nil, err
+		}
+		if err := energyPlugin.InitTopology(reg.HostFS(config.Host.SysfsCPU, topology.SysfsCPUPath)); err != nil {
+			log.Printf("CPU topology unavailable, using default CPU selection: %v", err)
+		}
+		return energyPlugin, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	sliceDefault           = 5000 * 1000 // 5ms in nanoseconds
+	packThresholdDefault   = 80          // Percent
+	spreadThresholdDefault = 70          // Percent
+)
+
+// EnergyPlugin implements an energy-aware scheduler that consolidates load on few CPUs
+type EnergyPlugin struct {
+	// Protects everything below
+	mu    sync.Mutex
+	slice uint64
+	queue queue.FIFO
+
+	// Thresholds in percent, see SetThresholds
+	packThreshold   uint64
+	spreadThreshold uint64
+
+	// CPU placement is only done with a topology, see InitTopology
+	topology *topology.Topology
+	affinity *affinity.Resolver
+	procFS   fs.FS
+	cpus     []cpuLoad
+
+	// Start of the current utilization window
+	windowStart uint64
+	now         func() uint64
+
+	stats Stats
+}
+
+// Stats holds the placement counters of the plugin
+type Stats struct {
+	// NrPacked counts tasks placed on a CPU that was already busy
+	NrPacked uint64
+	// NrWoken counts tasks placed on an idle CPU because every busy CPU was above the pack
+	// threshold
+	NrWoken uint64
+	// NrSpread counts tasks placed while the average utilization was above the spread threshold
+	NrSpread uint64
+	// NrFallback counts tasks left to DefaultSelectCPU
+	NrFallback uint64
+}
+
+// Verify that EnergyPlugin implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*EnergyPlugin)(nil)
+
+// NewEnergyPlugin creates a new EnergyPlugin with the given time slice (0 uses the default)
+func NewEnergyPlugin(slice uint64) *EnergyPlugin {
+	return newEnergyPlugin(slice, os.DirFS(affinity.ProcPath))
+}
+
+// newEnergyPlugin creates a plugin inspecting tasks through the given /proc filesystem
+func newEnergyPlugin(slice uint64, procFS fs.FS) *EnergyPlugin {
+	if slice == 0 {
+		slice = sliceDefault
+	}
+	return &EnergyPlugin{
+		slice:           slice,
+		packThreshold:   packThresholdDefault,
+		spreadThreshold: spreadThresholdDefault,
+		procFS:          procFS,
+		now:             util.Now,
+	}
+}
+
+// SetClock replaces the clock used to sample CPU utilization, it must be called before scheduling
+// starts
+func (e *EnergyPlugin) SetClock(now func() uint64) {
+	e.now = now
+}
+
+// InitTopology loads the CPUs SelectCPU places tasks on from a filesystem rooted at
+// /sys/devices/system/cpu. Without a topology SelectCPU falls back to DefaultSelectCPU.
+func (e *EnergyPlugin) InitTopology(fsys fs.FS) error {
+	topo, err := topology.Load(fsys)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.topology = topo
+	e.affinity = affinity.NewResolver(e.procFS, topo.NrCPUs())
+	e.cpus = make([]cpuLoad, topo.MaxCPU()+1)
+	return nil
+}
+
+// SetThresholds sets the utilization in percent up to which tasks are packed onto a busy CPU, and
+// the average utilization of the CPUs in percent above which tasks are spread. Zero values keep
+// the current thresholds.
+func (e *EnergyPlugin) SetThresholds(pack, spread uint64) error {
+	if pack > 100 || spread > 100 {
+		return fmt.Errorf("invalid energy thresholds %d%% and %d%% (1-100)", pack, spread)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if pack > 0 {
+		e.packThreshold = pack
+	}
+	if spread > 0 {
+		e.spreadThreshold = spread
+	}
+	return nil
+}
+
+// GetThresholds returns the pack and spread thresholds in percent
+func (e *EnergyPlugin) GetThresholds() (uint64, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.packThreshold, e.spreadThreshold
+}
+
+// DrainQueuedTask drains tasks from the scheduler queue, charging the time they ran to the CPU
+// they ran on
+func (e *EnergyPlugin) DrainQueuedTask(s reg.Sched) int {
+	count := 0
+	for {
+		task := &models.QueuedTask{}
+		s.DequeueTask(task)
+		if task.Pid <= 0 {
+			return count
+		}
+
+		e.mu.Lock()
+		e.rollWindow(e.now())
+		e.chargeTask(task)
+		e.queue.Push(task)
+		e.mu.Unlock()
+		count++
+	}
+}
+
+// SelectQueuedTask returns the oldest queued task
+func (e *EnergyPlugin) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.queue.Pop()
+}
+
+// DetermineTimeSlice returns the time slice of every task
+func (e *EnergyPlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.slice
+}
+
+// GetPoolCount returns the number of queued tasks
+func (e *EnergyPlugin) GetPoolCount() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uint64(e.queue.Len())
+}
+
+// GetStats returns the placement counters of the plugin
+func (e *EnergyPlugin) GetStats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+func (e *EnergyPlugin) SendMetrics(data interface{}) {}
+
+func (e *EnergyPlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return nil, nil
+}
@@ -0,0 +1,252 @@
+package energy
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+)
+
+// fakeTopologyFS returns the sysfs CPU tree of a fake 8-CPU host with 2-way SMT and one LLC
+func fakeTopologyFS() fstest.MapFS {
+	fsys := fstest.MapFS{
+		"online": &fstest.MapFile{Data: []byte("0-7\n")},
+	}
+	for cpu := 0; cpu < 8; cpu++ {
+		dir := "cpu" + strconv.Itoa(cpu)
+		core := cpu &^ 1
+		fsys[dir+"/topology/thread_siblings_list"] = &fstest.MapFile{
+			Data: []byte(strconv.Itoa(core) + "-" + strconv.Itoa(core+1)),
+		}
+		fsys[dir+"/node0/cpulist"] = &fstest.MapFile{}
+	}
+	return fsys
+}
+
+// newTestPlugin creates a plugin on the fake host of fakeTopologyFS driven by clock
+func newTestPlugin(t *testing.T, clock *uint64) *EnergyPlugin {
+	t.Helper()
+	e := NewEnergyPlugin(0)
+	e.now = func() uint64 { return *clock }
+	e.procFS = fstest.MapFS{}
+	if err := e.InitTopology(fakeTopologyFS()); err != nil {
+		t.Fatalf("InitTopology: %v", err)
+	}
+	return e
+}
+
+// periodicTask runs for runtime every period
+type periodicTask struct {
+	task    *models.QueuedTask
+	runtime uint64
+	period  uint64
+	wakeup  uint64
+	queued  bool
+}
+
+// cpuModel is a synthetic host: every CPU runs the tasks placed on it in order, each for its
+// runtime, and records how long it was busy
+type cpuModel struct {
+	t      *testing.T
+	e      *EnergyPlugin
+	sched  *plugintest.Sched
+	clock  *uint64
+	tasks  []*periodicTask
+	local  [][]*periodicTask
+	freeAt []uint64
+	busy   []uint64
+}
+
+// newCPUModel creates a model of the fake host running nrTasks tasks with the given duty cycle
+func newCPUModel(t *testing.T, nrTasks int, runtime, period uint64) *cpuModel {
+	clock := uint64(1)
+	m := &cpuModel{
+		t:      t,
+		e:      newTestPlugin(t, &clock),
+		sched:  plugintest.NewSched(1),
+		clock:  &clock,
+		local:  make([][]*periodicTask, 8),
+		freeAt: make([]uint64, 8),
+		busy:   make([]uint64, 8),
+	}
+	for i := 0; i < nrTasks; i++ {
+		m.tasks = append(m.tasks, &periodicTask{
+			task:    &models.QueuedTask{Pid: int32(100 + i), Cpu: -1, Weight: 100},
+			runtime: runtime,
+			period:  period,
+			wakeup:  clock + uint64(i)*period/uint64(nrTasks),
+		})
+	}
+	return m
+}
+
+// run advances the model by duration in ticks of 100us
+func (m *cpuModel) run(duration uint64) {
+	const tick = 100 * 1000
+	for end := *m.clock + duration; *m.clock < end; *m.clock += tick {
+		now := *m.clock
+		for _, p := range m.tasks {
+			if !p.queued && p.wakeup <= now {
+				p.queued = true
+				m.sched.Enqueue(p.task)
+			}
+		}
+
+		m.e.DrainQueuedTask(m.sched)
+		for task := m.e.SelectQueuedTask(m.sched); task != nil; task = m.e.SelectQueuedTask(m.sched) {
+			err, cpu := m.e.SelectCPU(m.sched, task)
+			if err != nil || cpu < 0 || cpu >= 8 {
+				m.t.Fatalf("SelectCPU = %v, %d", err, cpu)
+			}
+			p := m.tasks[task.Pid-100]
+			p.task = task
+			m.local[cpu] = append(m.local[cpu], p)
+		}
+
+		for cpu := range m.local {
+			for len(m.local[cpu]) > 0 && m.freeAt[cpu] <= now {
+				p := m.local[cpu][0]
+				m.local[cpu] = m.local[cpu][1:]
+				p.task.Cpu = int32(cpu)
+				p.task.StartTs = max(now, m.freeAt[cpu])
+				p.task.StopTs = p.task.StartTs + p.runtime
+				m.freeAt[cpu] = p.task.StopTs
+				m.busy[cpu] += p.runtime
+				p.wakeup = p.task.StopTs + p.period - p.runtime
+				p.queued = false
+			}
+		}
+	}
+}
+
+// activeCPUs returns the number of CPUs that ran tasks since the busy time was last reset
+func (m *cpuModel) activeCPUs() int {
+	active := 0
+	for _, busy := range m.busy {
+		if busy > 0 {
+			active++
+		}
+	}
+	return active
+}
+
+// TestEnergyConsolidation runs workloads on the synthetic host and checks how many CPUs they are
+// spread over once the utilization settled
+func TestEnergyConsolidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		nrTasks int
+		runtime uint64
+		period  uint64
+		maxCPUs int
+		minCPUs int
+	}{
+		// 0.8 CPU of demand fits on one CPU below the pack threshold, plus its SMT sibling
+		{name: "LowLoad", nrTasks: 8, runtime: 1000 * 1000, period: 10 * 1000 * 1000, minCPUs: 1, maxCPUs: 2},
+		// 3.2 CPUs of demand need 4 CPUs at 80%, one more while the load settles
+		{name: "MediumLoad", nrTasks: 16, runtime: 2000 * 1000, period: 10 * 1000 * 1000, minCPUs: 4, maxCPUs: 5},
+		// 7.2 CPUs of demand are above the spread threshold and use every CPU
+		{name: "HighLoad", nrTasks: 8, runtime: 4500 * 1000, period: 5000 * 1000, minCPUs: 8, maxCPUs: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCPUModel(t, tt.nrTasks, tt.runtime, tt.period)
+			m.run(1000 * 1000 * 1000)
+			m.busy = make([]uint64, 8)
+			m.run(1000 * 1000 * 1000)
+
+			active := m.activeCPUs()
+			t.Logf("Busy time per CPU: %v, stats: %+v", m.busy, m.e.GetStats())
+			if active < tt.minCPUs || active > tt.maxCPUs {
+				t.Errorf("Tasks ran on %d CPUs; want %d-%d", active, tt.minCPUs, tt.maxCPUs)
+			}
+		})
+	}
+}
+
+// TestEnergyPackThreshold verifies that a lower pack threshold uses more CPUs for the same load
+func TestEnergyPackThreshold(t *testing.T) {
+	activeCPUs := func(pack uint64) int {
+		m := newCPUModel(t, 16, 2000*1000, 10*1000*1000)
+		if err := m.e.SetThresholds(pack, 0); err != nil {
+			t.Fatalf("SetThresholds: %v", err)
+		}
+		m.run(1000 * 1000 * 1000)
+		m.busy = make([]uint64, 8)
+		m.run(1000 * 1000 * 1000)
+		return m.activeCPUs()
+	}
+
+	if loose, tight := activeCPUs(90), activeCPUs(50); tight <= loose {
+		t.Errorf("Pack threshold 50%% used %d CPUs and 90%% used %d; want more CPUs at 50%%", tight, loose)
+	}
+}
+
+// TestEnergySelectCPU verifies packing, waking SMT siblings and affinity on an idle host
+func TestEnergySelectCPU(t *testing.T) {
+	clock := uint64(1)
+	e := newTestPlugin(t, &clock)
+	sched := plugintest.NewSched(1)
+
+	// The first task wakes CPU 0, the next ones pack onto it until it is full
+	for pid, want := range []int32{0, 0, 1} {
+		task := &models.QueuedTask{Pid: int32(100 + pid), Cpu: -1, StartTs: 1, StopTs: 3000*1000 + 1}
+		if _, cpu := e.SelectCPU(sched, task); cpu != want {
+			t.Errorf("Task %d placed on CPU %d; want %d", pid, cpu, want)
+		}
+	}
+
+	// Pinned tasks stay on their CPU
+	pinned := &models.QueuedTask{Pid: 200, Cpu: 5, NrCpusAllowed: 1}
+	if _, cpu := e.SelectCPU(sched, pinned); cpu != 5 {
+		t.Errorf("Pinned task placed on CPU %d; want 5", cpu)
+	}
+	stats := e.GetStats()
+	if stats.NrPacked != 1 || stats.NrWoken != 3 {
+		t.Errorf("Stats = %+v; want 1 packed and 3 woken", stats)
+	}
+}
+
+// TestEnergyWithoutTopology verifies that DefaultSelectCPU is used without a topology
+func TestEnergyWithoutTopology(t *testing.T) {
+	e := NewEnergyPlugin(0)
+	if _, cpu := e.SelectCPU(plugintest.NewSched(1), &models.QueuedTask{Pid: 100}); cpu != 0 {
+		t.Errorf("SelectCPU = %d; want 0 from DefaultSelectCPU", cpu)
+	}
+	if stats := e.GetStats(); stats.NrFallback != 1 {
+		t.Errorf("NrFallback = %d; want 1", stats.NrFallback)
+	}
+}
+
+// TestEnergyThresholds verifies threshold validation and the factory configuration
+func TestEnergyThresholds(t *testing.T) {
+	e := NewEnergyPlugin(0)
+	if err := e.SetThresholds(101, 0); err == nil {
+		t.Error("SetThresholds(101, 0) succeeded; want an error")
+	}
+	if pack, spread := e.GetThresholds(); pack != packThresholdDefault || spread != spreadThresholdDefault {
+		t.Errorf("Thresholds = %d, %d; want the defaults", pack, spread)
+	}
+
+	config := &reg.SchedConfig{
+		Mode:      "energy",
+		Scheduler: reg.Scheduler{EnergyPackThreshold: 60, EnergySpreadThreshold: 50},
+	}
+	scheduler, err := reg.NewSchedulerPlugin(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin: %v", err)
+	}
+	if pack, spread := scheduler.(*EnergyPlugin).GetThresholds(); pack != 60 || spread != 50 {
+		t.Errorf("Thresholds = %d, %d; want 60, 50", pack, spread)
+	}
+
+	config.Scheduler.EnergySpreadThreshold = 200
+	if _, err := reg.NewSchedulerPlugin(context.Background(), config); err == nil {
+		t.Error("NewSchedulerPlugin succeeded with an invalid threshold")
+	}
+}
@@ -0,0 +1,133 @@
+package energy
+
+import (
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+const (
+	utilWindow      = 10 * 1000 * 1000 // 10ms in nanoseconds, utilization is sampled per window
+	utilScale       = 1024             // Utilization of a fully busy CPU
+	utilIdle        = utilScale / 64   // CPUs below this utilization count as idle
+	utilDecayWindow = 32               // Windows after which an idle CPU is fully decayed
+)
+
+// reservation is a task dispatched to a CPU that did not come back yet
+type reservation struct {
+	pid int32
+	// until is when the task is expected to be done, counting the tasks dispatched before it
+	until uint64
+}
+
+// cpuLoad is the dispatch history of a CPU
+type cpuLoad struct {
+	// busy is the execution time charged in the current window
+	busy uint64
+	// util is the moving average of the utilization over past windows, out of utilScale
+	util     uint64
+	reserved []reservation
+}
+
+// rollWindow folds the execution time of every CPU into its utilization once the current window
+// is over. Windows without any execution time decay the utilization. Must be called with mu held.
+func (e *EnergyPlugin) rollWindow(now uint64) {
+	if e.windowStart == 0 || now < e.windowStart {
+		e.windowStart = now
+		return
+	}
+	windows := (now - e.windowStart) / utilWindow
+	if windows == 0 {
+		return
+	}
+	e.windowStart += windows * utilWindow
+
+	for i := range e.cpus {
+		cpu := &e.cpus[i]
+		cpu.util = util.CalcAvg(cpu.util, min(cpu.busy*utilScale/utilWindow, utilScale))
+		cpu.busy = 0
+		for w := uint64(1); w < min(windows, utilDecayWindow); w++ {
+			cpu.util = util.CalcAvg(cpu.util, 0)
+		}
+		if windows >= utilDecayWindow {
+			cpu.util = 0
+		}
+	}
+}
+
+// chargeTask charges the last run of a task to the CPU it ran on and drops its reservation. Must
+// be called with mu held.
+func (e *EnergyPlugin) chargeTask(task *models.QueuedTask) {
+	if task.Cpu < 0 || int(task.Cpu) >= len(e.cpus) {
+		return
+	}
+	cpu := &e.cpus[task.Cpu]
+	if task.StopTs > task.StartTs {
+		cpu.busy += task.StopTs - task.StartTs
+	}
+	for i, r := range cpu.reserved {
+		if r.pid == task.Pid {
+			cpu.reserved = append(cpu.reserved[:i], cpu.reserved[i+1:]...)
+			break
+		}
+	}
+}
+
+// reserve records a task expected to run for the given time on a CPU, after the tasks already
+// dispatched there. Must be called with mu held.
+func (e *EnergyPlugin) reserve(cpu int32, pid int32, runtime, now uint64) {
+	c := &e.cpus[cpu]
+	start := now
+	if n := len(c.reserved); n > 0 {
+		start = max(start, c.reserved[n-1].until)
+	}
+	c.reserved = append(c.reserved, reservation{pid: pid, until: start + runtime})
+}
+
+// expireReservations drops the reservations of tasks that should be done, so that tasks that
+// exited do not hold their CPU. Must be called with mu held.
+func (e *EnergyPlugin) expireReservations(now uint64) {
+	for i := range e.cpus {
+		cpu := &e.cpus[i]
+		kept := cpu.reserved[:0]
+		for _, r := range cpu.reserved {
+			if r.until > now {
+				kept = append(kept, r)
+			}
+		}
+		cpu.reserved = kept
+	}
+}
+
+// backlog returns the work still expected from the tasks dispatched to a CPU, out of utilScale
+// per window. Must be called with mu held.
+func (e *EnergyPlugin) backlog(cpu int32, now uint64) uint64 {
+	c := &e.cpus[cpu]
+	if n := len(c.reserved); n > 0 && c.reserved[n-1].until > now {
+		return (c.reserved[n-1].until - now) * utilScale / utilWindow
+	}
+	return 0
+}
+
+// load returns the utilization of a CPU, or its backlog if higher so that a burst of wakeups does
+// not pile onto a CPU before its utilization catches up, out of utilScale. Must be called with mu
+// held.
+func (e *EnergyPlugin) load(cpu int32, now uint64) uint64 {
+	return max(e.cpus[cpu].util, e.backlog(cpu, now))
+}
+
+// busy reports whether a CPU recently ran tasks or has tasks dispatched to it. Must be called
+// with mu held.
+func (e *EnergyPlugin) busy(cpu int32) bool {
+	return e.cpus[cpu].util >= utilIdle || len(e.cpus[cpu].reserved) > 0
+}
+
+// GetUtilization returns the utilization of each CPU in percent, indexed by CPU ID
+func (e *EnergyPlugin) GetUtilization() []uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	utilization := make([]uint64, len(e.cpus))
+	for i := range e.cpus {
+		utilization[i] = e.cpus[i].util * 100 / utilScale
+	}
+	return utilization
+}
@@ -0,0 +1,73 @@
+package energy
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// TestUtilizationWindows verifies that execution time is folded into the utilization at the end
+// of each window and decays while the CPU is idle
+func TestUtilizationWindows(t *testing.T) {
+	clock := uint64(1)
+	e := newTestPlugin(t, &clock)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// CPU 2 is fully busy for 20 windows
+	for i := 0; i < 20; i++ {
+		e.rollWindow(clock)
+		e.chargeTask(&models.QueuedTask{Pid: 100, Cpu: 2, StartTs: clock, StopTs: clock + utilWindow})
+		clock += utilWindow
+	}
+	e.rollWindow(clock)
+	if util := e.cpus[2].util; util < utilScale*99/100 {
+		t.Errorf("Utilization of a busy CPU = %d; want close to %d", util, utilScale)
+	}
+	if !e.busy(2) || e.busy(3) {
+		t.Errorf("busy(2) = %v, busy(3) = %v; want true, false", e.busy(2), e.busy(3))
+	}
+
+	// A single idle window decays it by a quarter
+	before := e.cpus[2].util
+	clock += utilWindow
+	e.rollWindow(clock)
+	if util := e.cpus[2].util; util != before-before/4 {
+		t.Errorf("Utilization after an idle window = %d; want %d", util, before-before/4)
+	}
+
+	// Long idle periods reset it
+	clock += utilDecayWindow * utilWindow
+	e.rollWindow(clock)
+	if util := e.cpus[2].util; util != 0 || e.busy(2) {
+		t.Errorf("Utilization after a long idle period = %d; want 0", util)
+	}
+}
+
+// TestReservations verifies that dispatched tasks count as backlog until they come back or should
+// be done
+func TestReservations(t *testing.T) {
+	clock := uint64(1)
+	e := newTestPlugin(t, &clock)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reserve(1, 100, utilWindow/2, clock)
+	e.reserve(1, 101, utilWindow/2, clock)
+	if backlog := e.backlog(1, clock); backlog != utilScale {
+		t.Errorf("Backlog = %d; want %d", backlog, utilScale)
+	}
+
+	// The first task comes back, the second one is still queued behind it
+	e.chargeTask(&models.QueuedTask{Pid: 100, Cpu: 1})
+	if n := len(e.cpus[1].reserved); n != 1 || e.cpus[1].reserved[0].pid != 101 {
+		t.Errorf("Reservations = %+v; want PID 101 only", e.cpus[1].reserved)
+	}
+
+	// The second one exited
+	clock += utilWindow
+	e.expireReservations(clock)
+	if e.busy(1) || e.backlog(1, clock) != 0 {
+		t.Errorf("CPU 1 still busy after its reservations expired: %+v", e.cpus[1])
+	}
+}
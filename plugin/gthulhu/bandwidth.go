@@ -0,0 +1,141 @@
+package gthulhu
+
+import (
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+const bandwidthPeriodNsDefault = 100 * 1000 * 1000 // 100ms
+
+// heldTask is a task held back until its group gets runtime again
+type heldTask struct {
+	task       Task
+	cgroupPath string
+}
+
+// bandwidthGroup is the runtime budget of the tasks matched by a strategy with a CPU quota
+type bandwidthGroup struct {
+	quotaNs     uint64
+	periodNs    uint64
+	periodStart uint64
+	runtime     uint64     // Runtime consumed in the current period, overruns carry over
+	throttled   []heldTask // Tasks held until the next period
+}
+
+// updateBandwidthGroups creates a budget per strategy with a quota, keeping the state of groups
+// whose quota did not change and requeueing the tasks of groups that lost their quota
+func (g *GthulhuPlugin) updateBandwidthGroups(strategies []util.SchedulingStrategy) {
+	groups := make(map[int32]*bandwidthGroup)
+	now := g.now()
+
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	for _, strategy := range strategies {
+		if strategy.QuotaNs == 0 {
+			continue
+		}
+		periodNs := strategy.PeriodNs
+		if periodNs == 0 {
+			periodNs = bandwidthPeriodNsDefault
+		}
+		tgid := int32(strategy.PID)
+		if group, ok := g.bandwidth[tgid]; ok && group.quotaNs == strategy.QuotaNs && group.periodNs == periodNs {
+			groups[tgid] = group
+			continue
+		}
+		groups[tgid] = &bandwidthGroup{quotaNs: strategy.QuotaNs, periodNs: periodNs, periodStart: now}
+	}
+	for tgid, group := range g.bandwidth {
+		if groups[tgid] != group {
+			g.releaseThrottled(group, now)
+		}
+	}
+	g.bandwidth = groups
+	g.nextBandwidthRefill = 0
+}
+
+// execDelta returns the runtime a task consumed since it was last enqueued
+func (g *GthulhuPlugin) execDelta(t *models.QueuedTask) uint64 {
+	var delta uint64
+	g.execRuntime.Update(t.Pid, func(last *uint64) {
+		if *last == 0 || t.SumExecRuntime < *last {
+			delta = saturatingSub(t.StopTs, t.StartTs)
+		} else {
+			delta = t.SumExecRuntime - *last
+		}
+		*last = t.SumExecRuntime
+	})
+	return delta
+}
+
+// hasBandwidthLimit reports whether the strategy matching a TGID has a CPU quota
+func (g *GthulhuPlugin) hasBandwidthLimit(tgid int32) bool {
+	g.strategyMu.RLock()
+	defer g.strategyMu.RUnlock()
+	return g.strategyMap[tgid].QuotaNs > 0
+}
+
+// chargeBandwidth charges runtime to the bandwidth group of a TGID and reports whether the
+// group exhausted its quota for the current period. Must be called with poolMu held.
+func (g *GthulhuPlugin) chargeBandwidth(tgid int32, delta uint64, now uint64) bool {
+	group, ok := g.bandwidth[tgid]
+	if !ok {
+		return false
+	}
+	g.refillBandwidth(now)
+	group.runtime += delta
+	return group.runtime >= group.quotaNs
+}
+
+// holdTask keeps a task of a throttled group until the next period. Must be called with poolMu held.
+func (g *GthulhuPlugin) holdTask(t Task, cgroupPath string) {
+	group := g.bandwidth[t.Tgid]
+	group.throttled = append(group.throttled, heldTask{task: t, cgroupPath: cgroupPath})
+	g.stats.NrBandwidthThrottled++
+}
+
+// refillBandwidth starts a new period for groups whose period elapsed and requeues their
+// throttled tasks once they are back under quota. Must be called with poolMu held.
+func (g *GthulhuPlugin) refillBandwidth(now uint64) {
+	if len(g.bandwidth) == 0 || now < g.nextBandwidthRefill {
+		return
+	}
+	next := ^uint64(0)
+	for _, group := range g.bandwidth {
+		if elapsed := saturatingSub(now, group.periodStart); elapsed >= group.periodNs {
+			periods := elapsed / group.periodNs
+			group.periodStart += periods * group.periodNs
+			group.runtime = saturatingSub(group.runtime, periods*group.quotaNs)
+			if group.runtime < group.quotaNs {
+				g.releaseThrottled(group, now)
+			}
+		}
+		next = min(next, group.periodStart+group.periodNs)
+	}
+	g.nextBandwidthRefill = next
+}
+
+// releaseThrottled moves the held tasks of a group back to the fair-share class. The time they
+// were held does not count as waiting. Must be called with poolMu held.
+func (g *GthulhuPlugin) releaseThrottled(group *bandwidthGroup, now uint64) {
+	for _, held := range group.throttled {
+		held.task.EnqueueTs = now
+		if g.cgroups != nil {
+			g.cgroups.push(held.task, held.cgroupPath, now)
+		} else {
+			g.pool.push(held.task)
+		}
+	}
+	group.throttled = nil
+}
+
+// GetThrottledCount returns the number of tasks held by bandwidth limits
+func (g *GthulhuPlugin) GetThrottledCount() int {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	count := 0
+	for _, group := range g.bandwidth {
+		count += len(group.throttled)
+	}
+	return count
+}
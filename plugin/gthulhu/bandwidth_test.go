@@ -0,0 +1,142 @@
+package gthulhu
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestBandwidthThrottleAndRelease verifies that a group over its quota is held until the next
+// period while other tasks keep flowing
+func TestBandwidthThrottleAndRelease(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 1)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{
+		{PID: 100, QuotaNs: 10 * 1000 * 1000, PeriodNs: 100 * 1000 * 1000},
+	})
+
+	// The first enqueue charges the last burst, 4ms
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100, StartTs: 0, StopTs: 4 * 1000 * 1000, SumExecRuntime: 4 * 1000 * 1000})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Tgid: 200, Weight: 100})
+	g.DrainQueuedTask(mockSched)
+	if g.GetThrottledCount() != 0 {
+		t.Fatalf("Throttled = %d; want 0 under quota", g.GetThrottledCount())
+	}
+	g.SelectQueuedTask(mockSched)
+	g.SelectQueuedTask(mockSched)
+
+	// Another 8ms of runtime exceeds the 10ms quota
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100, SumExecRuntime: 12 * 1000 * 1000})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Tgid: 200, Weight: 100})
+	g.DrainQueuedTask(mockSched)
+	if g.GetThrottledCount() != 1 || g.GetPoolCount() != 2 {
+		t.Fatalf("Throttled = %d, pool = %d; want 1 and 2", g.GetThrottledCount(), g.GetPoolCount())
+	}
+	if task := g.SelectQueuedTask(mockSched); task == nil || task.Pid != 200 {
+		t.Fatalf("SelectQueuedTask = %v; want PID 200", task)
+	}
+	if task := g.SelectQueuedTask(mockSched); task != nil {
+		t.Fatalf("SelectQueuedTask = PID %d; want nil while throttled", task.Pid)
+	}
+
+	// The next period pays back the 2ms overrun and releases the task
+	clock += 100 * 1000 * 1000
+	if task := g.SelectQueuedTask(mockSched); task == nil || task.Pid != 100 {
+		t.Fatalf("SelectQueuedTask = %v; want PID 100 after refill", task)
+	}
+	if stats := g.GetStats(); stats.NrBandwidthThrottled != 1 {
+		t.Errorf("NrBandwidthThrottled = %d; want 1", stats.NrBandwidthThrottled)
+	}
+	if g.GetPoolCount() != 0 {
+		t.Errorf("Pool count = %d; want 0", g.GetPoolCount())
+	}
+}
+
+// TestBandwidthQuotaRemoved verifies that held tasks are released when their quota is removed
+func TestBandwidthQuotaRemoved(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 1)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, QuotaNs: 1000 * 1000}})
+
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100, StopTs: 2 * 1000 * 1000})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 101, Tgid: 100, Weight: 100, StopTs: 2 * 1000 * 1000})
+	g.DrainQueuedTask(mockSched)
+	if g.GetThrottledCount() != 2 {
+		t.Fatalf("Throttled = %d; want 2", g.GetThrottledCount())
+	}
+
+	g.UpdateStrategyMap(nil)
+	if g.GetThrottledCount() != 0 {
+		t.Fatalf("Throttled = %d; want 0 after the quota was removed", g.GetThrottledCount())
+	}
+	for _, want := range []int32{100, 101} {
+		if task := g.SelectQueuedTask(mockSched); task == nil || task.Pid != want {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, want)
+		}
+	}
+}
+
+// TestBandwidthSimulationCapsGroup runs a batch group of four threads capped at one CPU per
+// period against two unrestricted tasks on two CPUs
+func TestBandwidthSimulationCapsGroup(t *testing.T) {
+	const (
+		sliceNs  = 5 * 1000 * 1000
+		periodNs = 20 * 1000 * 1000
+		rounds   = 400
+	)
+
+	run := func(quotaNs uint64) (batchRuntime uint64) {
+		clock := uint64(1000 * 1000 * 1000)
+		g := newEDFTestPlugin(&clock, 2)
+		mockSched := NewMockScheduler()
+		g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, QuotaNs: quotaNs, PeriodNs: periodNs}})
+
+		for _, pid := range []int32{100, 101, 102, 103, 200, 201} {
+			tgid := pid
+			if pid < 200 {
+				tgid = 100
+			}
+			mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: tgid, Weight: 100})
+		}
+		g.DrainQueuedTask(mockSched)
+
+		for i := 0; i < rounds; i++ {
+			running := make([]*models.QueuedTask, 0, 2)
+			for cpu := 0; cpu < 2; cpu++ {
+				task := g.SelectQueuedTask(mockSched)
+				if task == nil {
+					t.Fatalf("round %d: SelectQueuedTask returned nil", i)
+				}
+				if task.Tgid == 100 {
+					batchRuntime += sliceNs
+				}
+				running = append(running, task)
+			}
+			clock += sliceNs
+			for _, task := range running {
+				task.StartTs = clock - sliceNs
+				task.StopTs = clock
+				task.SumExecRuntime += sliceNs
+				mockSched.EnqueueTask(task)
+			}
+			g.DrainQueuedTask(mockSched)
+		}
+		return batchRuntime
+	}
+
+	const elapsed = rounds * sliceNs
+	if got := run(0); got < elapsed*2*6/10 {
+		t.Errorf("Unlimited batch runtime = %dms; want >= 60%% of %dms", got/1000/1000, elapsed*2/1000/1000)
+	}
+
+	// One CPU worth of runtime per period, plus the overrun of the last period and the slices
+	// dispatched in the last round, which are only charged once they come back
+	quota := uint64(periodNs)
+	limit := elapsed/periodNs*quota + 2*2*sliceNs
+	if got := run(quota); got > limit {
+		t.Errorf("Capped batch runtime = %dms; want <= %dms", got/1000/1000, limit/1000/1000)
+	}
+}
@@ -0,0 +1,207 @@
+package gthulhu
+
+import (
+	"io/fs"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/cgroup"
+)
+
+const cgroupIdleNs = 10 * NSEC_PER_SEC // Idle cgroups are forgotten after 10s
+
+// cgroupNode is a cgroup in the hierarchy. Its vruntime is the runtime of the whole subtree
+// scaled by the inverse of cpu.weight, so siblings share their parent in proportion to their
+// weights however many threads each holds.
+type cgroupNode struct {
+	path     string
+	parent   *cgroupNode
+	children map[string]*cgroupNode
+	weight   uint64
+
+	vruntime     uint64 // Weighted runtime among siblings
+	minVruntime  uint64 // Vruntime of the last child picked, used to place children that wake up
+	selfVruntime uint64 // Runtime of the tasks attached directly to this cgroup
+
+	tasks      taskHeap // Tasks attached directly to this cgroup
+	nrQueued   int      // Tasks queued in the whole subtree
+	lastActive uint64
+}
+
+// cgroupTree holds fair-share tasks by cgroup. Selection walks from the root to the runnable
+// child with the smallest vruntime, then picks the task with the earliest deadline inside it.
+// It is not safe for concurrent use; callers hold poolMu.
+type cgroupTree struct {
+	resolver  *cgroup.Resolver
+	root      *cgroupNode
+	nodes     map[string]*cgroupNode
+	lastPrune uint64
+}
+
+// newCgroupTree creates an empty hierarchy
+func newCgroupTree(resolver *cgroup.Resolver) *cgroupTree {
+	root := &cgroupNode{
+		path:     cgroup.RootPath,
+		children: make(map[string]*cgroupNode),
+		weight:   cgroup.WeightDefault,
+	}
+	return &cgroupTree{
+		resolver: resolver,
+		root:     root,
+		nodes:    map[string]*cgroupNode{cgroup.RootPath: root},
+	}
+}
+
+// node returns the node of a cgroup, creating it and its ancestors if needed
+func (c *cgroupTree) node(path string, now uint64) *cgroupNode {
+	if n, ok := c.nodes[path]; ok {
+		return n
+	}
+	parent := c.node(cgroup.Parent(path), now)
+	n := &cgroupNode{
+		path:       path,
+		parent:     parent,
+		children:   make(map[string]*cgroupNode),
+		weight:     c.resolver.Weight(path),
+		vruntime:   parent.minVruntime,
+		lastActive: now,
+	}
+	parent.children[path] = n
+	c.nodes[path] = n
+	return n
+}
+
+// charge accounts runtime to a cgroup and all of its ancestors
+func (c *cgroupTree) charge(path string, runtime uint64, now uint64) {
+	n := c.node(path, now)
+	n.selfVruntime += runtime
+	for ; n.parent != nil; n = n.parent {
+		n.vruntime += runtime * cgroup.WeightDefault / n.weight
+	}
+}
+
+// push queues a task in its cgroup
+func (c *cgroupTree) push(t Task, path string, now uint64) {
+	n := c.node(path, now)
+	if n.tasks.Len() == 0 {
+		n.selfVruntime = max(n.selfVruntime, n.minVruntime)
+	}
+	n.tasks.Push(t)
+	for ; n != nil; n = n.parent {
+		if n.nrQueued == 0 && n.parent != nil {
+			// A cgroup waking up refreshes its weight and does not get credit for the time it slept
+			n.weight = c.resolver.Weight(n.path)
+			n.vruntime = max(n.vruntime, n.parent.minVruntime)
+		}
+		n.nrQueued++
+		n.lastActive = now
+	}
+}
+
+// pop removes and returns the next task, or nil if no task is queued
+func (c *cgroupTree) pop() *models.QueuedTask {
+	n := c.root
+	if n.nrQueued == 0 {
+		return nil
+	}
+	for {
+		var next *cgroupNode
+		for _, child := range n.children {
+			if child.nrQueued == 0 {
+				continue
+			}
+			if next == nil || child.vruntime < next.vruntime ||
+				(child.vruntime == next.vruntime && child.path < next.path) {
+				next = child
+			}
+		}
+
+		// Tasks attached directly to the cgroup compete with its children
+		if n.tasks.Len() > 0 && (next == nil || n.selfVruntime <= next.vruntime) {
+			n.minVruntime = max(n.minVruntime, n.selfVruntime)
+			t := n.tasks.Pop().QueuedTask
+			for ; n != nil; n = n.parent {
+				n.nrQueued--
+			}
+			return t
+		}
+		n.minVruntime = max(n.minVruntime, next.vruntime)
+		n = next
+	}
+}
+
+// len returns the number of queued tasks
+func (c *cgroupTree) len() int {
+	return c.root.nrQueued
+}
+
+// promote marks tasks enqueued at or before cutoff as aged and returns how many were promoted
+func (c *cgroupTree) promote(cutoff uint64) int {
+	promoted := 0
+	for _, n := range c.nodes {
+		count := 0
+		tasks := n.tasks.Items()
+		for i := range tasks {
+			t := &tasks[i]
+			if !t.Aged && t.EnqueueTs <= cutoff {
+				t.Aged = true
+				count++
+			}
+		}
+		if count > 0 {
+			n.tasks.Init()
+		}
+		promoted += count
+	}
+	return promoted
+}
+
+// extract removes up to limit tasks matching match
+func (c *cgroupTree) extract(match func(*Task) bool, limit int) []Task {
+	var out []Task
+	for _, n := range c.nodes {
+		if len(out) >= limit {
+			break
+		}
+		before := len(out)
+		out = n.tasks.Extract(match, limit-len(out), out)
+		for m := n; m != nil; m = m.parent {
+			m.nrQueued -= len(out) - before
+		}
+	}
+	return out
+}
+
+// prune forgets leaf cgroups that have been idle for cgroupIdleNs
+func (c *cgroupTree) prune(now uint64) {
+	if now-c.lastPrune < cgroupIdleNs {
+		return
+	}
+	c.lastPrune = now
+	for path, n := range c.nodes {
+		if n.parent == nil || n.nrQueued > 0 || len(n.children) > 0 || now-n.lastActive < cgroupIdleNs {
+			continue
+		}
+		delete(n.parent.children, path)
+		delete(c.nodes, path)
+		c.resolver.Forget(path)
+	}
+}
+
+// EnableCgroupFairness switches the fair-share class to hierarchical fair sharing between
+// cgroups, resolving task cgroups from a filesystem rooted at /proc and weights from one rooted
+// at /sys/fs/cgroup. It must be called before scheduling starts.
+func (g *GthulhuPlugin) EnableCgroupFairness(procFS, cgroupFS fs.FS) {
+	resolver := cgroup.NewResolver(procFS, cgroupFS)
+	resolver.SetClock(func() uint64 { return g.now() })
+
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	g.cgroups = newCgroupTree(resolver)
+}
+
+// CgroupFairnessEnabled reports whether fair-share tasks are scheduled by cgroup
+func (g *GthulhuPlugin) CgroupFairnessEnabled() bool {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	return g.cgroups != nil
+}
@@ -0,0 +1,132 @@
+package gthulhu
+
+import (
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// runCgroupSimulation runs always-runnable tasks on two CPUs and returns the dispatches of each
+// cgroup. groups maps a cgroup path to its number of threads.
+func runCgroupSimulation(t *testing.T, hierarchical bool, groups map[string]int, weights map[string]string) map[string]int {
+	t.Helper()
+	const (
+		sliceNs = 5 * 1000 * 1000
+		rounds  = 600
+	)
+
+	procFS := fstest.MapFS{}
+	cgroupFS := fstest.MapFS{}
+	for path, weight := range weights {
+		cgroupFS[path[1:]+"/cpu.weight"] = &fstest.MapFile{Data: []byte(weight + "\n")}
+	}
+
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 2)
+	g.SetStarvationThreshold(0)
+	if hierarchical {
+		g.EnableCgroupFairness(procFS, cgroupFS)
+	}
+	mockSched := NewMockScheduler()
+
+	groupOf := make(map[int32]string)
+	pid := int32(100)
+	for path, threads := range groups {
+		for i := 0; i < threads; i++ {
+			procFS[strconv.Itoa(int(pid))+"/cgroup"] = &fstest.MapFile{Data: []byte("0::" + path + "\n")}
+			groupOf[pid] = path
+			mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: pid, Weight: 100})
+			pid++
+		}
+	}
+	g.DrainQueuedTask(mockSched)
+
+	dispatches := make(map[string]int)
+	for i := 0; i < rounds; i++ {
+		running := make([]*models.QueuedTask, 0, 2)
+		for cpu := 0; cpu < 2; cpu++ {
+			task := g.SelectQueuedTask(mockSched)
+			if task == nil {
+				t.Fatalf("round %d: SelectQueuedTask returned nil", i)
+			}
+			dispatches[groupOf[task.Pid]]++
+			running = append(running, task)
+		}
+		clock += sliceNs
+		for _, task := range running {
+			task.StartTs = clock - sliceNs
+			task.StopTs = clock
+			mockSched.EnqueueTask(task)
+		}
+		g.DrainQueuedTask(mockSched)
+	}
+	return dispatches
+}
+
+// TestCgroupFairnessIgnoresThreadCount verifies that a cgroup with many threads does not get
+// more CPU time than a cgroup with few
+func TestCgroupFairnessIgnoresThreadCount(t *testing.T) {
+	groups := map[string]int{"/big": 40, "/small": 2}
+	const total = 600 * 2
+
+	flat := runCgroupSimulation(t, false, groups, nil)
+	if flat["/small"] > total/10 {
+		t.Errorf("Per-task fairness: /small got %d of %d dispatches; want <= %d", flat["/small"], total, total/10)
+	}
+
+	fair := runCgroupSimulation(t, true, groups, nil)
+	if fair["/small"] < total*45/100 || fair["/small"] > total*55/100 {
+		t.Errorf("Cgroup fairness: /small got %d of %d dispatches; want about half", fair["/small"], total)
+	}
+}
+
+// TestCgroupFairnessWeights verifies that cgroups share CPU time in proportion to cpu.weight
+// at every level of the hierarchy
+func TestCgroupFairnessWeights(t *testing.T) {
+	groups := map[string]int{"/a/x": 4, "/a/y": 4, "/b": 4}
+	weights := map[string]string{"/a": "300", "/a/x": "100", "/a/y": "300", "/b": "100"}
+	const total = 600 * 2
+
+	got := runCgroupSimulation(t, true, groups, weights)
+	a := got["/a/x"] + got["/a/y"]
+	if a < total*70/100 || a > total*80/100 {
+		t.Errorf("/a got %d of %d dispatches; want about 75%%", a, total)
+	}
+	if got["/a/y"] < a*70/100 || got["/a/y"] > a*80/100 {
+		t.Errorf("/a/y got %d of the %d dispatches of /a; want about 75%%", got["/a/y"], a)
+	}
+}
+
+// TestCgroupTreePrune verifies that idle cgroups are forgotten while busy ones are kept
+func TestCgroupTreePrune(t *testing.T) {
+	clock := uint64(1000)
+	g := newEDFTestPlugin(&clock, 2)
+	g.EnableCgroupFairness(fstest.MapFS{}, nil)
+	tree := g.cgroups
+
+	tree.push(Task{QueuedTask: &models.QueuedTask{Pid: 1}}, "/idle/leaf", clock)
+	tree.push(Task{QueuedTask: &models.QueuedTask{Pid: 2}}, "/busy", clock)
+	if qt := tree.pop(); qt == nil {
+		t.Fatal("pop returned nil")
+	}
+	if qt := tree.pop(); qt == nil {
+		t.Fatal("pop returned nil")
+	}
+	tree.push(Task{QueuedTask: &models.QueuedTask{Pid: 2}}, "/busy", clock)
+
+	// Leaves go first, their parents once they have no children left
+	clock += cgroupIdleNs
+	tree.prune(clock)
+	clock += cgroupIdleNs
+	tree.prune(clock)
+	for _, path := range []string{"/idle/leaf", "/idle"} {
+		if _, ok := tree.nodes[path]; ok {
+			t.Errorf("Idle cgroup %s was not pruned", path)
+		}
+	}
+	if _, ok := tree.nodes["/busy"]; !ok {
+		t.Error("Busy cgroup /busy was pruned")
+	}
+}
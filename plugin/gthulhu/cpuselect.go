@@ -0,0 +1,252 @@
+package gthulhu
+
+import (
+	"io/fs"
+	"slices"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/topology"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// cpuState tracks a CPU the plugin dispatched to. A CPU is considered busy until the slice of
+// the task dispatched there expires or the task comes back to the queue.
+type cpuState struct {
+	busyUntil uint64
+	pid       int32
+}
+
+// InitTopology loads the CPU topology used by SelectCPU from a filesystem rooted at
+// /sys/devices/system/cpu. Without a topology SelectCPU falls back to DefaultSelectCPU.
+// The task pool is resharded per LLC, so it must be called before scheduling starts.
+func (g *GthulhuPlugin) InitTopology(fsys fs.FS) error {
+	topo, err := topology.Load(fsys)
+	if err != nil {
+		return err
+	}
+
+	g.cpuMu.Lock()
+	g.topology = topo
+	g.cpus = make([]cpuState, topo.MaxCPU()+1)
+	g.affinity = affinity.NewResolver(g.procFS, topo.NrCPUs())
+	g.cpuMu.Unlock()
+
+	g.poolMu.Lock()
+	g.nrCPUs = topo.NrCPUs()
+	pool := newLLCTaskPool(topo, g.pool.getLimit())
+	g.pool.moveTo(pool)
+	g.pool = pool
+	g.poolMu.Unlock()
+	return nil
+}
+
+// selectCPU picks a CPU among the candidates allowed by the task affinity and its strategy CPU
+// mask: the previous CPU of the task if it is idle, then an idle CPU sharing its LLC, then one on
+// its NUMA node, preferring fully idle cores over SMT siblings of busy cores. Members of a gang
+// are spread over distinct CPUs.
+func (g *GthulhuPlugin) selectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	now := g.now()
+	slice := g.getTaskExecutionTime(t.Pid)
+	if slice == 0 {
+		slice = g.sliceNsDefault
+	}
+
+	allowed, ok := g.candidateCPUs(t)
+	g.cpuMu.Lock()
+	// Members of a gang each get a CPU no other member was given
+	candidates, inGang := g.gangCandidates(t, allowed)
+	if inGang && (!ok || len(candidates) == 0) {
+		// Not enough CPUs for every member to get its own, run this one wherever it fits
+		g.nrGangFallback++
+		candidates = allowed
+	}
+	if ok {
+		if cpu := g.pickCPU(t.Cpu, candidates, now); cpu >= 0 {
+			g.reserveCPU(cpu, t.Pid, now+slice)
+			if inGang {
+				g.placeGangMember(cpu)
+			}
+			g.cpuMu.Unlock()
+			return nil, cpu
+		}
+	}
+	g.cpuMu.Unlock()
+
+	err, cpu := s.DefaultSelectCPU(t)
+	g.cpuMu.Lock()
+	if err == nil {
+		g.reserveCPU(cpu, t.Pid, now+slice)
+	}
+	if inGang {
+		g.placeGangMember(cpu)
+	}
+	g.cpuMu.Unlock()
+	return err, cpu
+}
+
+// candidateCPUs returns the intersection of the strategy CPU mask and the CPUs the task is
+// allowed to run on, or nil if it may run anywhere. The second result is false when the task
+// must be left to DefaultSelectCPU: its affinity is unknown or the intersection is empty.
+func (g *GthulhuPlugin) candidateCPUs(t *models.QueuedTask) ([]int32, bool) {
+	allowed, known := g.affinity.Allowed(t)
+	if !known {
+		return nil, false
+	}
+	mask := g.strategyCPUs(t)
+	switch {
+	case mask == nil:
+		return allowed, true
+	case allowed == nil:
+		return mask, true
+	}
+	candidates := util.IntersectCPUs(mask, allowed)
+	return candidates, len(candidates) > 0
+}
+
+// onlineCPUs returns the CPUs strategy CPU masks may name
+func (g *GthulhuPlugin) onlineCPUs() []int32 {
+	g.cpuMu.Lock()
+	defer g.cpuMu.Unlock()
+	return topology.OnlineCPUs(g.topology, g.nrCPUs)
+}
+
+// strategyCPUs returns the CPU mask of the strategy matching the task, or nil if unrestricted
+func (g *GthulhuPlugin) strategyCPUs(t *models.QueuedTask) []int32 {
+	g.strategyMu.RLock()
+	defer g.strategyMu.RUnlock()
+	return g.cpuMasks[t.Tgid]
+}
+
+// pickCPU returns a CPU for a task that last ran on prev, restricted to candidates unless nil,
+// or -1 to fall back to DefaultSelectCPU. Must hold cpuMu.
+func (g *GthulhuPlugin) pickCPU(prev int32, candidates []int32, now uint64) int32 {
+	if candidates == nil {
+		if g.topology == nil {
+			return -1
+		}
+		return g.pickIdleCPU(prev, nil, now)
+	}
+
+	if g.topology != nil {
+		candidates = util.IntersectCPUs(candidates, g.topology.Online)
+		if len(candidates) == 0 {
+			return -1
+		}
+	}
+	g.growCPUState(candidates[len(candidates)-1])
+	if cpu := g.pickIdleCPU(prev, candidates, now); cpu >= 0 {
+		return cpu
+	}
+	// Every candidate is busy, queue behind the one expected to free up first
+	best := candidates[0]
+	for _, cpu := range candidates[1:] {
+		if g.cpus[cpu].busyUntil < g.cpus[best].busyUntil {
+			best = cpu
+		}
+	}
+	return best
+}
+
+// pickIdleCPU returns an idle CPU close to prev, or -1 if there is none. When candidates is not
+// nil only those CPUs are considered and they are searched as a last resort. Must hold cpuMu.
+func (g *GthulhuPlugin) pickIdleCPU(prev int32, candidates []int32, now uint64) int32 {
+	if inCPUs(candidates, prev) && g.cpuIdle(prev, now) {
+		return prev
+	}
+
+	domains := make([][]int32, 0, 3)
+	if g.topology != nil {
+		if prevCPU, ok := g.topology.CPUs[prev]; ok {
+			domains = append(domains, prevCPU.LLC, g.topology.Nodes[prevCPU.Node])
+		} else if candidates == nil {
+			domains = append(domains, g.topology.Online)
+		}
+	}
+	if candidates != nil {
+		domains = append(domains, candidates)
+	}
+
+	for _, fullCore := range []bool{true, false} {
+		for _, domain := range domains {
+			if cpu := g.findIdleCPU(domain, candidates, fullCore, now); cpu >= 0 {
+				return cpu
+			}
+		}
+	}
+	return -1
+}
+
+// inCPUs reports whether cpu is in the sorted list, a nil list contains every CPU
+func inCPUs(cpus []int32, cpu int32) bool {
+	if cpus == nil {
+		return true
+	}
+	_, found := slices.BinarySearch(cpus, cpu)
+	return found
+}
+
+// findIdleCPU returns the first idle CPU of domain that is also in candidates, requiring all of
+// its SMT siblings to be idle as well when fullCore is set. Must hold cpuMu.
+func (g *GthulhuPlugin) findIdleCPU(domain, candidates []int32, fullCore bool, now uint64) int32 {
+	for _, id := range domain {
+		if !inCPUs(candidates, id) || !g.cpuIdle(id, now) {
+			continue
+		}
+		if g.topology == nil {
+			return id
+		}
+		cpu, online := g.topology.CPUs[id]
+		if !online || (fullCore && !g.coreIdle(cpu, now)) {
+			continue
+		}
+		return id
+	}
+	return -1
+}
+
+// coreIdle reports whether every SMT sibling of cpu is idle. Must hold cpuMu.
+func (g *GthulhuPlugin) coreIdle(cpu topology.CPU, now uint64) bool {
+	for _, sibling := range cpu.Siblings {
+		if !g.cpuIdle(sibling, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// cpuIdle reports whether no dispatched task is expected to run on cpu. Must hold cpuMu.
+func (g *GthulhuPlugin) cpuIdle(cpu int32, now uint64) bool {
+	if cpu < 0 || int(cpu) >= len(g.cpus) {
+		return false
+	}
+	return g.cpus[cpu].busyUntil <= now
+}
+
+// growCPUState makes room to track CPUs up to maxCPU when no topology sized the table. Must hold cpuMu.
+func (g *GthulhuPlugin) growCPUState(maxCPU int32) {
+	if int(maxCPU) >= len(g.cpus) {
+		g.cpus = append(g.cpus, make([]cpuState, int(maxCPU)+1-len(g.cpus))...)
+	}
+}
+
+// reserveCPU marks cpu busy with pid until the given time. Must hold cpuMu.
+func (g *GthulhuPlugin) reserveCPU(cpu int32, pid int32, until uint64) {
+	if cpu < 0 || int(cpu) >= len(g.cpus) {
+		return
+	}
+	g.cpus[cpu] = cpuState{busyUntil: until, pid: pid}
+}
+
+// releaseCPU marks the CPU a task last ran on idle when the task comes back to the queue
+func (g *GthulhuPlugin) releaseCPU(t *models.QueuedTask) {
+	g.cpuMu.Lock()
+	defer g.cpuMu.Unlock()
+	if t.Cpu < 0 || int(t.Cpu) >= len(g.cpus) {
+		return
+	}
+	if g.cpus[t.Cpu].pid == t.Pid {
+		g.cpus[t.Cpu].busyUntil = 0
+	}
+}
@@ -0,0 +1,237 @@
+package gthulhu
+
+import (
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// fakeTopologyFS returns the sysfs CPU tree of a fake 12-CPU host with 2-way SMT:
+// node0 holds CPUs 0-7 split in LLCs 0-3 and 4-7, node1 holds CPUs 8-11 in one LLC
+func fakeTopologyFS() fstest.MapFS {
+	llcs := []string{"0-3", "4-7", "8-11"}
+	fsys := fstest.MapFS{
+		"online": &fstest.MapFile{Data: []byte("0-11\n")},
+	}
+	for cpu := 0; cpu < 12; cpu++ {
+		dir := "cpu" + strconv.Itoa(cpu)
+		core := cpu &^ 1
+		fsys[dir+"/topology/thread_siblings_list"] = &fstest.MapFile{
+			Data: []byte(strconv.Itoa(core) + "-" + strconv.Itoa(core+1)),
+		}
+		fsys[dir+"/node"+strconv.Itoa(cpu/8)+"/cpulist"] = &fstest.MapFile{}
+		fsys[dir+"/cache/index3/level"] = &fstest.MapFile{Data: []byte("3")}
+		fsys[dir+"/cache/index3/shared_cpu_list"] = &fstest.MapFile{Data: []byte(llcs[cpu/4])}
+	}
+	return fsys
+}
+
+// newTopologyTestPlugin creates a plugin on the fake host of fakeTopologyFS
+func newTopologyTestPlugin(t *testing.T, clock *uint64) *GthulhuPlugin {
+	t.Helper()
+
+	g := NewGthulhuPlugin(5000*1000, 500*1000)
+	g.now = func() uint64 { return *clock }
+	if err := g.InitTopology(fakeTopologyFS()); err != nil {
+		t.Fatalf("InitTopology error: %v", err)
+	}
+	return g
+}
+
+// TestSelectCPUWithoutTopology verifies that DefaultSelectCPU is used when no topology is loaded
+func TestSelectCPUWithoutTopology(t *testing.T) {
+	g := NewGthulhuPlugin(0, 0)
+	mockSched := NewMockScheduler()
+
+	err, cpu := g.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Cpu: 2})
+	if err != nil || cpu != 0 {
+		t.Errorf("SelectCPU = %v, %d; want nil, 0 from DefaultSelectCPU", err, cpu)
+	}
+	if mockSched.selectCPUCall != 1 {
+		t.Errorf("DefaultSelectCPU calls = %d; want 1", mockSched.selectCPUCall)
+	}
+}
+
+// TestSelectCPUTopologyPolicy verifies the previous CPU, LLC and NUMA node preference order
+func TestSelectCPUTopologyPolicy(t *testing.T) {
+	const busy = 1 << 62
+
+	tests := []struct {
+		name     string
+		busyCPUs []int32
+		prev     int32
+		want     int32
+	}{
+		{name: "PreviousCPUIdle", prev: 5, want: 5},
+		{name: "SameLLCFullIdleCore", busyCPUs: []int32{0}, prev: 0, want: 2},
+		{name: "SameNodeWhenLLCBusy", busyCPUs: []int32{0, 1, 2, 3}, prev: 0, want: 4},
+		{name: "AvoidSMTSiblingOfBusyCore", busyCPUs: []int32{0, 2}, prev: 0, want: 4},
+		{name: "SMTSiblingWhenNoIdleCore", busyCPUs: []int32{0, 2, 4, 6}, prev: 0, want: 1},
+		{name: "UnknownPreviousCPU", busyCPUs: []int32{0}, prev: -1, want: 2},
+		{name: "FallbackWhenNodeBusy", busyCPUs: []int32{0, 1, 2, 3, 4, 5, 6, 7}, prev: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := uint64(1000)
+			g := newTopologyTestPlugin(t, &clock)
+			mockSched := NewMockScheduler()
+			for _, cpu := range tt.busyCPUs {
+				g.reserveCPU(cpu, 1, busy)
+			}
+
+			err, cpu := g.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Cpu: tt.prev, NrCpusAllowed: 12})
+			if err != nil {
+				t.Fatalf("SelectCPU error: %v", err)
+			}
+			if cpu != tt.want {
+				t.Errorf("SelectCPU = %d; want %d", cpu, tt.want)
+			}
+		})
+	}
+}
+
+// TestSelectCPUReservation verifies that a selected CPU stays busy until the slice expires
+// or the task comes back to the queue
+func TestSelectCPUReservation(t *testing.T) {
+	clock := uint64(1000)
+	g := newTopologyTestPlugin(t, &clock)
+	mockSched := NewMockScheduler()
+
+	_, first := g.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Cpu: 0})
+	_, second := g.SelectCPU(mockSched, &models.QueuedTask{Pid: 200, Cpu: 0})
+	if first != 0 || second != 2 {
+		t.Fatalf("SelectCPU = %d, %d; want 0, 2", first, second)
+	}
+
+	// The slice of PID 200 expires
+	clock += 5000 * 1000
+	if !g.cpuIdle(2, clock) {
+		t.Error("CPU 2 should be idle once the slice expired")
+	}
+
+	// PID 100 comes back to the queue before its slice expired
+	g.cpuMu.Lock()
+	g.reserveCPU(0, 100, clock+5000*1000)
+	g.cpuMu.Unlock()
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 0, Weight: 100})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 1, Weight: 100})
+	g.DrainQueuedTask(mockSched)
+	if !g.cpuIdle(0, clock) {
+		t.Error("CPU 0 should be released when its task is enqueued again")
+	}
+}
+
+// TestSelectCPURestrictedTask verifies that a pinned task runs on its only allowed CPU
+func TestSelectCPURestrictedTask(t *testing.T) {
+	clock := uint64(1000)
+	g := newTopologyTestPlugin(t, &clock)
+	mockSched := NewMockScheduler()
+	g.reserveCPU(3, 1, 1<<62)
+
+	_, cpu := g.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Cpu: 3, NrCpusAllowed: 1})
+	if cpu != 3 || mockSched.selectCPUCall != 0 {
+		t.Errorf("SelectCPU = %d with %d default calls; want 3 without DefaultSelectCPU", cpu, mockSched.selectCPUCall)
+	}
+}
+
+// TestSelectCPUAffinityMask verifies that strategy CPU masks and task affinity restrict SelectCPU
+func TestSelectCPUAffinityMask(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/status": &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t4-11\n")},
+		"200/status": &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t0-1\n")},
+	}
+
+	tests := []struct {
+		name        string
+		mask        string
+		task        models.QueuedTask
+		busyCPUs    []int32
+		want        int32
+		wantDefault int
+	}{
+		{name: "StrategyMask", mask: "8-11", task: models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 0}, want: 8},
+		{name: "MaskAndAffinity", mask: "0-5", task: models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 0, NrCpusAllowed: 8}, want: 4},
+		{name: "AllMaskedCPUsBusy", mask: "8-9", task: models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 0}, busyCPUs: []int32{8, 9}, want: 8},
+		{name: "EmptyIntersection", mask: "8-11", task: models.QueuedTask{Pid: 200, Tgid: 200, Cpu: 0, NrCpusAllowed: 2}, want: 0, wantDefault: 1},
+		{name: "UnknownAffinity", mask: "8-11", task: models.QueuedTask{Pid: 400, Tgid: 400, Cpu: 0, NrCpusAllowed: 2}, want: 0, wantDefault: 1},
+		{name: "OfflineMask", mask: "16-31", task: models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 0}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := uint64(1000)
+			g := newTopologyTestPlugin(t, &clock)
+			g.affinity = affinity.NewResolver(procFS, 12)
+			g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: int(tt.task.Tgid), CPUs: tt.mask}})
+			for _, cpu := range tt.busyCPUs {
+				g.reserveCPU(cpu, 1, 1<<62)
+			}
+			mockSched := NewMockScheduler()
+
+			_, cpu := g.SelectCPU(mockSched, &tt.task)
+			if cpu != tt.want || mockSched.selectCPUCall != tt.wantDefault {
+				t.Errorf("SelectCPU = %d with %d default calls; want %d with %d", cpu, mockSched.selectCPUCall, tt.want, tt.wantDefault)
+			}
+		})
+	}
+}
+
+// TestUpdateStrategyMapInvalidCPUs verifies that invalid or offline CPU masks are ignored while
+// the rest of their strategy still applies and the strategy is reported unchanged
+func TestUpdateStrategyMapInvalidCPUs(t *testing.T) {
+	g := NewGthulhuPlugin(0, 0)
+	g.nrCPUs = 4
+	g.UpdateStrategyMap([]util.SchedulingStrategy{
+		{PID: 1, CPUs: "0-3"},
+		{PID: 2, CPUs: "3-1", Priority: 1},
+		{PID: 3},
+		{PID: 4, CPUs: "2-4", QuotaNs: 1000},
+		{PID: 5, CPUs: "0-2147483647", LatencyTargetNs: 1000},
+	})
+
+	if got := g.strategyCPUs(&models.QueuedTask{Tgid: 1}); len(got) != 4 {
+		t.Errorf("CPU mask of PID 1 = %v; want [0 1 2 3]", got)
+	}
+	for _, pid := range []int32{2, 3, 4, 5} {
+		if got := g.strategyCPUs(&models.QueuedTask{Tgid: pid}); got != nil {
+			t.Errorf("CPU mask of PID %d = %v; want nil", pid, got)
+		}
+	}
+	changed, _ := g.GetChangedStrategies()
+	if len(changed) != 5 {
+		t.Errorf("Changed strategies = %v; want those of PIDs 1 to 5", changed)
+	}
+	wantCPUs := map[int]string{1: "0-3", 2: "3-1", 3: "", 4: "2-4", 5: "0-2147483647"}
+	for _, strategy := range changed {
+		if strategy.CPUs != wantCPUs[strategy.PID] {
+			t.Errorf("Strategy of PID %d reported CPU mask %q; want %q", strategy.PID, strategy.CPUs, wantCPUs[strategy.PID])
+		}
+	}
+	if !g.hasBandwidthLimit(4) || g.latencyTarget(&models.QueuedTask{Tgid: 5}) != 1000 {
+		t.Error("Strategies with an invalid CPU mask lost their quota or latency target")
+	}
+}
+
+// TestUpdateStrategyMapSparseOnlineCPUs verifies that masks are checked against the online CPU
+// IDs rather than the number of online CPUs
+func TestUpdateStrategyMapSparseOnlineCPUs(t *testing.T) {
+	fsys := fakeTopologyFS()
+	fsys["online"] = &fstest.MapFile{Data: []byte("0-3,8-11\n")}
+	g := NewGthulhuPlugin(0, 0)
+	if err := g.InitTopology(fsys); err != nil {
+		t.Fatalf("InitTopology error: %v", err)
+	}
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 1, CPUs: "8-11"}, {PID: 2, CPUs: "2-4"}})
+
+	if got := g.strategyCPUs(&models.QueuedTask{Tgid: 1}); len(got) != 4 || got[0] != 8 {
+		t.Errorf("CPU mask of PID 1 = %v; want [8 9 10 11]", got)
+	}
+	if got := g.strategyCPUs(&models.QueuedTask{Tgid: 2}); got != nil {
+		t.Errorf("CPU mask of PID 2 naming offline CPU 4 = %v; want nil", got)
+	}
+}
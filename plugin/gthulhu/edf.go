@@ -0,0 +1,63 @@
+package gthulhu
+
+import (
+	"github.com/Gthulhu/plugin/models"
+)
+
+const (
+	edfBandwidthDefault = 50                // Percentage of each period EDF tasks may consume
+	edfPeriodNsDefault  = 100 * 1000 * 1000 // 100ms
+)
+
+// latencyTarget returns the latency target of the strategy matching the task, or 0 if none
+func (g *GthulhuPlugin) latencyTarget(t *models.QueuedTask) uint64 {
+	g.strategyMu.RLock()
+	strategy, exists := g.strategyMap[t.Tgid]
+	g.strategyMu.RUnlock()
+	if exists {
+		return strategy.LatencyTargetNs
+	}
+	return 0
+}
+
+// admitDeadlineTask charges the last burst of a deadline task to the EDF class and reports
+// whether the class still has bandwidth left in the current period. Tasks that are not
+// admitted are demoted to the fair-share class, so EDF tasks cannot starve everything else.
+// Must be called with poolMu held.
+func (g *GthulhuPlugin) admitDeadlineTask(t *models.QueuedTask, now uint64) bool {
+	if saturatingSub(now, g.edfPeriodStart) >= g.edfPeriodNs {
+		g.edfPeriodStart = now
+		g.edfRuntime = 0
+	}
+	g.edfRuntime += saturatingSub(t.StopTs, t.StartTs)
+	if g.edfRuntime > g.edfBudget() {
+		g.stats.NrEDFThrottled++
+		return false
+	}
+	g.stats.NrEDFAdmitted++
+	return true
+}
+
+// edfBudget returns the runtime EDF tasks may consume per period across all CPUs
+func (g *GthulhuPlugin) edfBudget() uint64 {
+	return g.edfPeriodNs * g.edfBandwidth / 100 * uint64(g.nrCPUs)
+}
+
+// SetEDFConfig updates the EDF bandwidth (percentage of each period) and period length
+func (g *GthulhuPlugin) SetEDFConfig(bandwidth, periodNs uint64) {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	if bandwidth > 0 {
+		g.edfBandwidth = min(bandwidth, 100)
+	}
+	if periodNs > 0 {
+		g.edfPeriodNs = periodNs
+	}
+}
+
+// GetEDFConfig returns the current EDF bandwidth and period
+func (g *GthulhuPlugin) GetEDFConfig() (uint64, uint64) {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	return g.edfBandwidth, g.edfPeriodNs
+}
@@ -0,0 +1,195 @@
+package gthulhu
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// newEDFTestPlugin creates a plugin with a fake clock and a fixed CPU count
+func newEDFTestPlugin(clock *uint64, nrCPUs int) *GthulhuPlugin {
+	g := NewGthulhuPlugin(5000*1000, 500*1000)
+	g.now = func() uint64 { return *clock }
+	g.nrCPUs = nrCPUs
+	return g
+}
+
+// TestEDFTasksRunAheadOfFairTasks verifies that deadline tasks are selected before fair-share tasks
+func TestEDFTasksRunAheadOfFairTasks(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 4)
+	mockSched := NewMockScheduler()
+
+	g.UpdateStrategyMap([]util.SchedulingStrategy{
+		{PID: 300, LatencyTargetNs: 1000 * 1000},
+	})
+
+	tasks := []*models.QueuedTask{
+		{Pid: 100, Weight: 100, Tgid: 100, StartTs: 1000, StopTs: 2000},
+		{Pid: 200, Weight: 100, Tgid: 200, StartTs: 1000, StopTs: 2000},
+		{Pid: 300, Weight: 100, Tgid: 300, StartTs: 1000, StopTs: 2000, Vtime: 1 << 40},
+		{Pid: 400, Weight: 100, Tgid: 400, StartTs: 1000, StopTs: 2000},
+	}
+	for _, task := range tasks {
+		mockSched.EnqueueTask(task)
+	}
+
+	if drained := g.DrainQueuedTask(mockSched); drained != 4 {
+		t.Fatalf("DrainQueuedTask = %d; want 4", drained)
+	}
+	if g.GetPoolCount() != 4 {
+		t.Errorf("GetPoolCount = %d; want 4 (EDF tasks are counted)", g.GetPoolCount())
+	}
+
+	first := g.SelectQueuedTask(mockSched)
+	if first == nil || first.Pid != 300 {
+		t.Fatalf("First selected task = %v; want PID 300", first)
+	}
+	if stats := g.GetStats(); stats.NrEDFAdmitted != 1 || stats.NrEDFThrottled != 0 {
+		t.Errorf("Stats = %+v; want 1 admitted, 0 throttled", stats)
+	}
+}
+
+// TestEDFEarliestDeadlineFirst verifies that deadline tasks are ordered by now + latency target
+func TestEDFEarliestDeadlineFirst(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 4)
+	mockSched := NewMockScheduler()
+
+	g.UpdateStrategyMap([]util.SchedulingStrategy{
+		{PID: 100, LatencyTargetNs: 10 * 1000 * 1000},
+		{PID: 200, LatencyTargetNs: 2 * 1000 * 1000},
+		{PID: 300, LatencyTargetNs: 5 * 1000 * 1000},
+		{PID: 400, LatencyTargetNs: 1 * 1000 * 1000},
+	})
+
+	// PID 100 and 200 are enqueued first, PID 300 and 400 4ms later
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Weight: 100, Tgid: 100})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Weight: 100, Tgid: 200})
+	g.DrainQueuedTask(mockSched)
+
+	clock += 4 * 1000 * 1000
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 300, Weight: 100, Tgid: 300})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 400, Weight: 100, Tgid: 400})
+	g.DrainQueuedTask(mockSched)
+
+	// Absolute deadlines: 200 -> 2ms, 400 -> 5ms, 300 -> 9ms, 100 -> 10ms
+	expected := []int32{200, 400, 300, 100}
+	for i, want := range expected {
+		task := g.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatalf("SelectQueuedTask returned nil at %d", i)
+		}
+		if task.Pid != want {
+			t.Errorf("Task %d PID = %d; want %d", i, task.Pid, want)
+		}
+	}
+}
+
+// TestEDFAdmissionControl verifies that deadline tasks exceeding the bandwidth are demoted
+// and admitted again once a new period starts
+func TestEDFAdmissionControl(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 1)
+	g.SetEDFConfig(50, 10*1000*1000) // 5ms of EDF runtime per 10ms period
+	mockSched := NewMockScheduler()
+
+	g.UpdateStrategyMap([]util.SchedulingStrategy{
+		{PID: 100, LatencyTargetNs: 1000 * 1000},
+		{PID: 200, LatencyTargetNs: 1000 * 1000},
+	})
+
+	// Each enqueue charges a 2ms burst: 2ms, 4ms admitted, 6ms and 8ms throttled
+	for i := 0; i < 2; i++ {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Weight: 100, Tgid: 100, StartTs: 0, StopTs: 2000 * 1000})
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Weight: 100, Tgid: 200, StartTs: 0, StopTs: 2000 * 1000})
+	}
+	if drained := g.DrainQueuedTask(mockSched); drained != 4 {
+		t.Fatalf("DrainQueuedTask = %d; want 4", drained)
+	}
+
+	stats := g.GetStats()
+	if stats.NrEDFAdmitted != 2 || stats.NrEDFThrottled != 2 {
+		t.Errorf("Stats = %+v; want 2 admitted, 2 throttled", stats)
+	}
+	if g.edfQueue.Len() != 2 || g.pool.len() != 2 {
+		t.Errorf("EDF queue = %d, fair pool = %d; want 2 and 2", g.edfQueue.Len(), g.pool.len())
+	}
+
+	// A new period restores the EDF budget
+	clock += 10 * 1000 * 1000
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Weight: 100, Tgid: 100, StartTs: 0, StopTs: 2000 * 1000})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Weight: 100, Tgid: 200, StartTs: 0, StopTs: 2000 * 1000})
+	g.DrainQueuedTask(mockSched)
+
+	if stats := g.GetStats(); stats.NrEDFAdmitted != 4 {
+		t.Errorf("NrEDFAdmitted after new period = %d; want 4", stats.NrEDFAdmitted)
+	}
+}
+
+// TestEDFSimulationBandwidthPreventsStarvation runs two always-runnable deadline tasks against
+// two fair tasks on two CPUs and checks that the fair tasks only make progress with admission control
+func TestEDFSimulationBandwidthPreventsStarvation(t *testing.T) {
+	const (
+		sliceNs = 4 * 1000 * 1000
+		rounds  = 250
+	)
+
+	run := func(bandwidth uint64) (fairDispatches int, stats Stats) {
+		clock := uint64(1000 * 1000 * 1000)
+		g := newEDFTestPlugin(&clock, 2)
+		g.SetEDFConfig(bandwidth, 100*1000*1000)
+		mockSched := NewMockScheduler()
+
+		g.UpdateStrategyMap([]util.SchedulingStrategy{
+			{PID: 100, LatencyTargetNs: 1000 * 1000},
+			{PID: 101, LatencyTargetNs: 1000 * 1000},
+		})
+		for _, pid := range []int32{100, 101, 200, 201} {
+			mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Weight: 100, Tgid: pid})
+		}
+		g.DrainQueuedTask(mockSched)
+
+		for i := 0; i < rounds; i++ {
+			// Dispatch one task per CPU and run it for a full slice
+			running := make([]*models.QueuedTask, 0, 2)
+			for cpu := 0; cpu < 2; cpu++ {
+				task := g.SelectQueuedTask(mockSched)
+				if task == nil {
+					t.Fatalf("round %d: SelectQueuedTask returned nil", i)
+				}
+				if task.Pid >= 200 {
+					fairDispatches++
+				}
+				running = append(running, task)
+			}
+			clock += sliceNs
+			for _, task := range running {
+				task.StartTs = clock - sliceNs
+				task.StopTs = clock
+				mockSched.EnqueueTask(task)
+			}
+			g.DrainQueuedTask(mockSched)
+		}
+		return fairDispatches, g.GetStats()
+	}
+
+	// Without a bandwidth limit the deadline tasks monopolize both CPUs
+	fair, stats := run(100)
+	if fair != 0 {
+		t.Errorf("Fair dispatches without bandwidth limit = %d; want 0", fair)
+	}
+	if stats.NrEDFThrottled != 0 {
+		t.Errorf("NrEDFThrottled without bandwidth limit = %d; want 0", stats.NrEDFThrottled)
+	}
+
+	// With a 50% limit the fair tasks get at least a quarter of all dispatches
+	fair, stats = run(50)
+	if fair < rounds*2/4 {
+		t.Errorf("Fair dispatches with 50%% bandwidth = %d; want >= %d", fair, rounds*2/4)
+	}
+	if stats.NrEDFThrottled == 0 {
+		t.Error("Expected deadline tasks to be throttled with 50% bandwidth")
+	}
+}
@@ -0,0 +1,104 @@
+package gthulhu
+
+import (
+	"slices"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// gangState tracks the CPUs given to the members of the gang being dispatched
+type gangState struct {
+	tgid    int32
+	pending int     // Members still waiting for a CPU
+	cpus    []int32 // CPUs already given to members
+	nrCPUs  int
+}
+
+// isGangTask reports whether the strategy matching a TGID asks for gang scheduling
+func (g *GthulhuPlugin) isGangTask(tgid int32) bool {
+	g.strategyMu.RLock()
+	defer g.strategyMu.RUnlock()
+	return g.strategyMap[tgid].Gang
+}
+
+// formGang pulls the queued siblings of a gang task so they are selected right after it, up to
+// one task per CPU. Siblings beyond the CPU count stay queued. Must be called with poolMu held.
+func (g *GthulhuPlugin) formGang(leader *models.QueuedTask) {
+	limit := g.nrCPUs - 1
+	if limit <= 0 {
+		return
+	}
+	match := func(t *Task) bool { return t.Tgid == leader.Tgid }
+	var siblings []Task
+	if g.cgroups != nil {
+		siblings = g.cgroups.extract(match, limit)
+	} else {
+		siblings = g.pool.extract(match, limit)
+	}
+	if len(siblings) == 0 {
+		return
+	}
+
+	slices.SortFunc(siblings, func(a, b Task) int {
+		if lessQueuedTask(&a, &b) {
+			return -1
+		}
+		return 1
+	})
+	for i := range siblings {
+		g.gangQueue = append(g.gangQueue, siblings[i].QueuedTask)
+	}
+	g.stats.NrGangs++
+
+	g.cpuMu.Lock()
+	g.gang = gangState{tgid: leader.Tgid, pending: len(siblings) + 1, nrCPUs: g.nrCPUs}
+	g.cpuMu.Unlock()
+}
+
+// popGangTask returns the next sibling of the gang being dispatched, or nil if there is none.
+// Must be called with poolMu held.
+func (g *GthulhuPlugin) popGangTask() *models.QueuedTask {
+	if len(g.gangQueue) == 0 {
+		return nil
+	}
+	t := g.gangQueue[0]
+	g.gangQueue[0] = nil
+	g.gangQueue = g.gangQueue[1:]
+	g.pool.unreserve()
+	return t
+}
+
+// gangCandidates removes the CPUs already given to other members of the gang from the
+// candidates of a member, returning the candidates unchanged for tasks outside the gang.
+// Must hold cpuMu.
+func (g *GthulhuPlugin) gangCandidates(t *models.QueuedTask, candidates []int32) ([]int32, bool) {
+	if g.gang.pending == 0 || g.gang.tgid != t.Tgid {
+		return candidates, false
+	}
+	if candidates == nil {
+		if g.topology != nil {
+			candidates = g.topology.Online
+		} else {
+			candidates = make([]int32, g.gang.nrCPUs)
+			for cpu := range candidates {
+				candidates[cpu] = int32(cpu)
+			}
+		}
+	}
+	free := make([]int32, 0, len(candidates))
+	for _, cpu := range candidates {
+		if !slices.Contains(g.gang.cpus, cpu) {
+			free = append(free, cpu)
+		}
+	}
+	return free, true
+}
+
+// placeGangMember records the CPU given to a member of the gang. Must hold cpuMu.
+func (g *GthulhuPlugin) placeGangMember(cpu int32) {
+	g.gang.cpus = append(g.gang.cpus, cpu)
+	g.gang.pending--
+	if g.gang.pending == 0 {
+		g.gang = gangState{}
+	}
+}
@@ -0,0 +1,112 @@
+package gthulhu
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestGangSiblingsDispatchedTogether verifies that the siblings of a gang task are selected
+// right after it and placed on distinct CPUs
+func TestGangSiblingsDispatchedTogether(t *testing.T) {
+	clock := uint64(1000)
+	g := newEDFTestPlugin(&clock, 4)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, Gang: true}})
+
+	tasks := []*models.QueuedTask{
+		{Pid: 100, Tgid: 100, Cpu: 2, Weight: 100, Vtime: 1000},
+		{Pid: 101, Tgid: 100, Cpu: 2, Weight: 100, Vtime: 5000},
+		{Pid: 102, Tgid: 100, Cpu: 2, Weight: 100, Vtime: 6000},
+		{Pid: 200, Tgid: 200, Cpu: 2, Weight: 100, Vtime: 2000},
+		{Pid: 201, Tgid: 201, Cpu: 2, Weight: 100, Vtime: 3000},
+		{Pid: 202, Tgid: 202, Cpu: 2, Weight: 100, Vtime: 4000},
+	}
+	for _, task := range tasks {
+		mockSched.EnqueueTask(task)
+	}
+	g.DrainQueuedTask(mockSched)
+
+	var order []int32
+	cpus := make(map[int32]bool)
+	for i := 0; i < 3; i++ {
+		task := g.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatalf("SelectQueuedTask %d returned nil", i)
+		}
+		order = append(order, task.Pid)
+		_, cpu := g.SelectCPU(mockSched, task)
+		if cpus[cpu] {
+			t.Errorf("PID %d placed on CPU %d already used by the gang", task.Pid, cpu)
+		}
+		cpus[cpu] = true
+	}
+	if order[0] != 100 || order[1] != 101 || order[2] != 102 {
+		t.Errorf("Selection order = %v; want [100 101 102]", order)
+	}
+	if g.GetPoolCount() != 3 {
+		t.Errorf("Pool count = %d; want 3", g.GetPoolCount())
+	}
+	if stats := g.GetStats(); stats.NrGangs != 1 || stats.NrGangFallback != 0 {
+		t.Errorf("Stats = %+v; want 1 gang, 0 fallbacks", stats)
+	}
+
+	// Tasks outside the gang are unaffected
+	if task := g.SelectQueuedTask(mockSched); task == nil || task.Pid != 200 {
+		t.Errorf("SelectQueuedTask after the gang = %v; want PID 200", task)
+	}
+}
+
+// TestGangLimitedByCPUCount verifies that a gang never holds more tasks than there are CPUs
+func TestGangLimitedByCPUCount(t *testing.T) {
+	clock := uint64(1000)
+	g := newEDFTestPlugin(&clock, 2)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, Gang: true}})
+
+	for i := int32(0); i < 4; i++ {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100 + i, Tgid: 100, Weight: 100, Vtime: uint64(1000 + i)})
+	}
+	g.DrainQueuedTask(mockSched)
+
+	if task := g.SelectQueuedTask(mockSched); task == nil || task.Pid != 100 {
+		t.Fatalf("SelectQueuedTask = %v; want PID 100", task)
+	}
+	g.poolMu.Lock()
+	gangSize := len(g.gangQueue)
+	g.poolMu.Unlock()
+	if gangSize != 1 {
+		t.Errorf("Gang siblings = %d; want 1 on a 2-CPU host", gangSize)
+	}
+	if g.GetPoolCount() != 3 {
+		t.Errorf("Pool count = %d; want 3", g.GetPoolCount())
+	}
+}
+
+// TestGangFallbackWithoutEnoughCPUs verifies that members that cannot get a CPU of their own
+// still run on an allowed CPU
+func TestGangFallbackWithoutEnoughCPUs(t *testing.T) {
+	clock := uint64(1000)
+	g := newTopologyTestPlugin(t, &clock)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, Gang: true}})
+
+	// Both threads are pinned to CPU 5
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 5, NrCpusAllowed: 1, Weight: 100, Vtime: 1000})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 101, Tgid: 100, Cpu: 5, NrCpusAllowed: 1, Weight: 100, Vtime: 2000})
+	g.DrainQueuedTask(mockSched)
+
+	for _, want := range []int32{100, 101} {
+		task := g.SelectQueuedTask(mockSched)
+		if task == nil || task.Pid != want {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, want)
+		}
+		if _, cpu := g.SelectCPU(mockSched, task); cpu != 5 {
+			t.Errorf("SelectCPU(PID %d) = %d; want pinned CPU 5", task.Pid, cpu)
+		}
+	}
+	if stats := g.GetStats(); stats.NrGangs != 1 || stats.NrGangFallback != 1 {
+		t.Errorf("Stats = %+v; want 1 gang, 1 fallback", stats)
+	}
+}
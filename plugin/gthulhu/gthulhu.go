@@ -2,12 +2,20 @@ package gthulhu
 
 import (
 	"context"
+	"io/fs"
 	"log"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 
 	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/cgroup"
 	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/internal/strategyapi"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/topology"
 	"github.com/Gthulhu/plugin/plugin/util"
 )
 
@@ -25,7 +33,25 @@ func init() {
 			sliceNsMin = config.Scheduler.SliceNsMin
 		}
 
-		gthulhuPlugin := NewGthulhuPlugin(sliceNsDefault, sliceNsMin)
+		gthulhuPlugin := newGthulhuPlugin(sliceNsDefault, sliceNsMin, reg.HostFS(config.Host.Proc, affinity.ProcPath))
+		gthulhuPlugin.SetEDFConfig(config.Scheduler.EDFBandwidth, config.Scheduler.EDFPeriodNs)
+		if config.Scheduler.CgroupFairness {
+			gthulhuPlugin.EnableCgroupFairness(gthulhuPlugin.procFS, reg.HostFS(config.Host.Cgroupfs, cgroup.CgroupfsPath))
+		}
+		if config.Scheduler.StarvationThresholdNs > 0 {
+			gthulhuPlugin.SetStarvationThreshold(config.Scheduler.StarvationThresholdNs)
+		}
+		if config.Scheduler.TaskPoolLimit > 0 {
+			gthulhuPlugin.SetTaskPoolLimit(config.Scheduler.TaskPoolLimit)
+		}
+		if err := gthulhuPlugin.InitTopology(reg.HostFS(config.Host.SysfsCPU, topology.SysfsCPUPath)); err != nil {
+			log.Printf("CPU topology unavailable, using default CPU selection: %v", err)
+		}
+		if config.Scheduler.TaskStateSweepInterval > 0 {
+			interval := time.Duration(config.Scheduler.TaskStateSweepInterval) * time.Second
+			gthulhuPlugin.taskHistory.StartSweeper(ctx, interval)
+			gthulhuPlugin.execRuntime.StartSweeper(ctx, interval)
+		}
 
 		// Initialize JWT client if API config is provided
 		if config.APIConfig.Enabled &&
@@ -58,17 +84,68 @@ type GthulhuPlugin struct {
 	sliceNsDefault uint64
 	sliceNsMin     uint64
 
-	// Task pool state
-	taskPool      []Task
-	taskPoolCount int
-	poolMu        sync.Mutex
+	// Fair-share task pool, sharded with its own locks
+	pool *taskPool
+
+	// Protects the vruntime, EDF, cgroup and statistics state below
+	poolMu sync.Mutex
+
+	// Fair-share tasks queued by cgroup when hierarchical fair sharing is enabled
+	cgroups *cgroupTree
+
+	// Siblings of a gang task waiting to be selected right after it
+	gangQueue []*models.QueuedTask
 
 	// Global vruntime
 	minVruntime uint64
 
+	// EDF class for tasks with a latency target, served ahead of the fair-share pool
+	edfQueue       taskHeap
+	edfBandwidth   uint64
+	edfPeriodNs    uint64
+	edfPeriodStart uint64
+	edfRuntime     uint64
+
+	// CPU quota of strategies with bandwidth limits, keyed by TGID
+	bandwidth           map[int32]*bandwidthGroup
+	nextBandwidthRefill uint64
+	execRuntime         *taskstate.Table[uint64]
+
+	// Aging of fair-share tasks that waited too long in the pool
+	starvationThresholdNs uint64
+	lastAgingScan         uint64
+
+	// Per-PID wakeup and burst history used to detect interactive tasks
+	taskHistory *taskstate.Table[taskHistory]
+
+	// Number of CPUs the scheduler dispatches to
+	nrCPUs int
+
+	// CPU topology and per-CPU dispatch state for topology-aware CPU selection
+	topology *topology.Topology
+	cpus     []cpuState
+	gang     gangState
+	cpuMu    sync.Mutex
+
+	// Gang members that could not get a CPU of their own, protected by cpuMu
+	nrGangFallback uint64
+
+	// Resolves the CPUs a task is allowed to run on
+	affinity *affinity.Resolver
+
+	// /proc filesystem used to inspect tasks
+	procFS fs.FS
+
+	// Clock used for deadlines, returns nanoseconds
+	now func() uint64
+
+	// Scheduling counters, protected by poolMu
+	stats Stats
+
 	// Strategy map for PID-based scheduling strategies
 	oldStrategyMap  map[int32]util.SchedulingStrategy
 	strategyMap     map[int32]util.SchedulingStrategy
+	cpuMasks        map[int32][]int32
 	newStrategy     []util.SchedulingStrategy
 	removedStrategy []util.SchedulingStrategy
 	strategyMu      sync.RWMutex
@@ -80,16 +157,54 @@ type GthulhuPlugin struct {
 	metricsClient *MetricsClient
 }
 
+// Stats holds the scheduling counters of a GthulhuPlugin instance
+type Stats struct {
+	NrEDFAdmitted  uint64 // Deadline tasks enqueued in the EDF class
+	NrEDFThrottled uint64 // Deadline tasks demoted to the fair class by admission control
+	NrInteractive  uint64 // Enqueues that received the interactive deadline bonus
+	NrPoolOverflow uint64 // Drains stopped because the task pool reached its limit
+	NrStarved      uint64 // Tasks promoted after waiting past the starvation threshold
+
+	NrBandwidthThrottled uint64 // Tasks held because their group exhausted its CPU quota
+
+	NrGangs        uint64 // Gangs dispatched together
+	NrGangFallback uint64 // Gang members that could not get a CPU of their own
+}
+
 func NewGthulhuPlugin(sliceNsDefault, sliceNsMin uint64) *GthulhuPlugin {
+	return newGthulhuPlugin(sliceNsDefault, sliceNsMin, os.DirFS(affinity.ProcPath))
+}
+
+// newGthulhuPlugin creates a plugin inspecting tasks through the given /proc filesystem
+func newGthulhuPlugin(sliceNsDefault, sliceNsMin uint64, procFS fs.FS) *GthulhuPlugin {
 	plugin := &GthulhuPlugin{
 		sliceNsDefault: 5000 * 1000, // 5ms (default)
 		sliceNsMin:     500 * 1000,  // 0.5ms (default)
-		taskPool:       make([]Task, taskPoolSize),
-		taskPoolCount:  0,
+		pool:           newFlatTaskPool(runtime.NumCPU(), taskPoolLimitDefault),
 		minVruntime:    0,
+		edfBandwidth:   edfBandwidthDefault,
+		edfPeriodNs:    edfPeriodNsDefault,
+		nrCPUs:         runtime.NumCPU(),
+		now:            util.Now,
+		procFS:         procFS,
 		strategyMap:    make(map[int32]util.SchedulingStrategy),
+		cpuMasks:       make(map[int32][]int32),
+
+		starvationThresholdNs: starvationThresholdNsDefault,
 	}
 
+	plugin.taskHistory = taskstate.New[taskHistory](taskstate.Options{
+		Capacity: taskHistorySizeDefault,
+		MaxAge:   taskHistoryMaxAge,
+		Now:      func() uint64 { return plugin.now() },
+		ProcFS:   plugin.procFS,
+	})
+	plugin.execRuntime = taskstate.New[uint64](taskstate.Options{
+		Now:    func() uint64 { return plugin.now() },
+		ProcFS: plugin.procFS,
+	})
+	plugin.affinity = affinity.NewResolver(plugin.procFS, plugin.nrCPUs)
+
 	// Override defaults if provided
 	if sliceNsDefault > 0 {
 		plugin.sliceNsDefault = sliceNsDefault
@@ -126,7 +241,7 @@ func (g *GthulhuPlugin) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
 }
 
 func (g *GthulhuPlugin) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
-	return s.DefaultSelectCPU(t)
+	return g.selectCPU(s, t)
 }
 
 func (g *GthulhuPlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
@@ -134,35 +249,93 @@ func (g *GthulhuPlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) ui
 }
 
 func (g *GthulhuPlugin) GetPoolCount() uint64 {
-	return uint64(g.taskPoolCount)
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	return uint64(g.pool.len() + g.edfQueue.Len())
+}
+
+// GetStats returns a snapshot of the scheduling counters
+func (g *GthulhuPlugin) GetStats() Stats {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	stats := g.stats
+	g.cpuMu.Lock()
+	stats.NrGangFallback = g.nrGangFallback
+	g.cpuMu.Unlock()
+	return stats
 }
 
 // drainQueuedTask drains tasks from the scheduler queue into the task pool
 func (g *GthulhuPlugin) drainQueuedTask(s reg.Sched) int {
 	var count int
-	// Hold the lock across capacity check and insertion to avoid TOCTOU race
 	for {
-		g.poolMu.Lock()
-		if g.taskPoolCount >= taskPoolSize-1 {
+		// Claim room before dequeuing so a full pool leaves tasks in the kernel queue
+		if !g.pool.reserve() {
+			g.poolMu.Lock()
+			g.stats.NrPoolOverflow++
 			g.poolMu.Unlock()
 			break
 		}
 		var newQueuedTask models.QueuedTask
 		s.DequeueTask(&newQueuedTask)
-		if newQueuedTask.Pid == -1 || count == int(s.GetNrQueued()) {
-			g.poolMu.Unlock()
+		if newQueuedTask.Pid == -1 {
+			g.pool.unreserve()
 			return count
 		}
+		if newQueuedTask.Pid <= 0 {
+			// Drop invalid tasks
+			g.pool.unreserve()
+			continue
+		}
+		g.releaseCPU(&newQueuedTask)
+		var cgroupPath string
+		if g.cgroups != nil {
+			cgroupPath = g.cgroups.resolver.Path(newQueuedTask.Pid)
+		}
+		var delta uint64
+		if g.hasBandwidthLimit(newQueuedTask.Tgid) {
+			delta = g.execDelta(&newQueuedTask)
+		}
+
+		g.poolMu.Lock()
+		now := g.now()
+		throttled := g.chargeBandwidth(newQueuedTask.Tgid, delta, now)
+		if target := g.latencyTarget(&newQueuedTask); target > 0 && !throttled {
+			if g.admitDeadlineTask(&newQueuedTask, now) {
+				g.edfQueue.Push(Task{
+					QueuedTask: &newQueuedTask,
+					Deadline:   now + target,
+					Timestamp:  newQueuedTask.StartTs,
+				})
+				g.poolMu.Unlock()
+				g.pool.unreserve()
+				count++
+				continue
+			}
+		}
 		t := Task{
 			QueuedTask: &newQueuedTask,
 			Deadline:   g.updatedEnqueueTask(&newQueuedTask),
 			Timestamp:  newQueuedTask.StartTs,
+			EnqueueTs:  now,
+		}
+		if throttled {
+			// Throttled tasks keep their room reserved in the pool
+			g.holdTask(t, cgroupPath)
+			g.poolMu.Unlock()
+			count++
+			continue
+		}
+		if g.cgroups != nil {
+			// Tasks held by the cgroup tree keep their room reserved in the pool
+			g.cgroups.charge(cgroupPath, saturatingSub(newQueuedTask.StopTs, newQueuedTask.StartTs), t.EnqueueTs)
+			g.cgroups.push(t, cgroupPath, t.EnqueueTs)
+			g.poolMu.Unlock()
+			count++
+			continue
 		}
-		// Direct heap insert (no second lock acquisition)
-		g.taskPool[g.taskPoolCount] = t
-		g.heapSiftUp(g.taskPoolCount)
-		g.taskPoolCount++
 		g.poolMu.Unlock()
+		g.pool.push(t)
 		count++
 	}
 	return count
@@ -170,6 +343,8 @@ func (g *GthulhuPlugin) drainQueuedTask(s reg.Sched) int {
 
 // updatedEnqueueTask updates the task's vtime based on scheduling strategy
 func (g *GthulhuPlugin) updatedEnqueueTask(t *models.QueuedTask) uint64 {
+	history := g.updateTaskHistory(t)
+
 	// Check if we have a specific strategy for this task
 	strategyApplied := g.applySchedulingStrategy(t)
 
@@ -184,6 +359,12 @@ func (g *GthulhuPlugin) updatedEnqueueTask(t *models.QueuedTask) uint64 {
 		vslice := (t.StopTs - t.StartTs) * 100 / t.Weight
 		t.Vtime += vslice
 		g.minVruntime += vslice
+		if history.interactive() {
+			// Interactive tasks are charged their average burst instead of the accumulated
+			// runtime and are pulled ahead by one slice
+			g.stats.NrInteractive++
+			return saturatingSub(t.Vtime+min(history.avgBurst, g.sliceNsDefault*100), g.sliceNsDefault)
+		}
 		return t.Vtime + min(t.SumExecRuntime, g.sliceNsDefault*100)
 	}
 
@@ -200,78 +381,80 @@ func saturatingSub(a, b uint64) uint64 {
 
 // getTaskFromPool retrieves a task from the pool
 func (g *GthulhuPlugin) getTaskFromPool() *models.QueuedTask {
-	// Pop-min from binary heap stored in g.taskPool[0:g.taskPoolCount]
 	g.poolMu.Lock()
-	defer g.poolMu.Unlock()
-	if g.taskPoolCount == 0 {
-		return nil
+	// Siblings of a gang run right after the thread that formed it
+	if t := g.popGangTask(); t != nil {
+		g.poolMu.Unlock()
+		return t
+	}
+	now := g.now()
+	g.refillBandwidth(now)
+	g.ageTasks(now)
+	// Deadline tasks always run ahead of the fair-share pool
+	if g.edfQueue.Len() > 0 {
+		t := g.edfQueue.Pop().QueuedTask
+		g.poolMu.Unlock()
+		return t
+	}
+	if g.cgroups != nil {
+		t := g.cgroups.pop()
+		g.cgroups.prune(now)
+		if t != nil {
+			g.pool.unreserve()
+			if g.isGangTask(t.Tgid) {
+				g.formGang(t)
+			}
+		}
+		g.poolMu.Unlock()
+		return t
 	}
-	// Take the root element
-	top := g.taskPool[0]
-	g.taskPoolCount--
-	if g.taskPoolCount > 0 {
-		// Move last element to root and sift down
-		g.taskPool[0] = g.taskPool[g.taskPoolCount]
-		g.heapSiftDown(0)
+	g.poolMu.Unlock()
+
+	t := g.pool.pop()
+	if t != nil && g.isGangTask(t.Tgid) {
+		g.poolMu.Lock()
+		g.formGang(t)
+		g.poolMu.Unlock()
 	}
-	return top.QueuedTask
+	return t
 }
 
 // insertTaskToPool inserts a task into the pool in sorted order
 func (g *GthulhuPlugin) insertTaskToPool(newTask Task) bool {
-	// In-place binary min-heap using preallocated array
-	g.poolMu.Lock()
-	defer g.poolMu.Unlock()
-	if g.taskPoolCount >= taskPoolSize-1 {
+	if !g.pool.reserve() {
 		return false
 	}
-	// Place at the end and sift up
-	g.taskPool[g.taskPoolCount] = newTask
-	g.heapSiftUp(g.taskPoolCount)
-	g.taskPoolCount++
+	g.pool.push(newTask)
 	return true
 }
 
-// heapLess compares elements at indices i and j in the heap according to lessQueuedTask
-func (g *GthulhuPlugin) heapLess(i, j int) bool {
-	return lessQueuedTask(&g.taskPool[i], &g.taskPool[j])
+// SetClock replaces the clock used for deadlines and per-task state, it must be called before
+// scheduling starts
+func (g *GthulhuPlugin) SetClock(now func() uint64) {
+	g.now = now
 }
 
-// heapSiftUp moves the element at idx up to restore heap property
-func (g *GthulhuPlugin) heapSiftUp(idx int) {
-	for idx > 0 {
-		parent := (idx - 1) / 2
-		if !g.heapLess(idx, parent) {
-			break
-		}
-		g.taskPool[idx], g.taskPool[parent] = g.taskPool[parent], g.taskPool[idx]
-		idx = parent
+// SetTaskPoolLimit updates the number of tasks the pool may hold before draining stops
+func (g *GthulhuPlugin) SetTaskPoolLimit(limit int) {
+	if limit > 0 {
+		g.pool.setLimit(limit)
 	}
 }
 
-// heapSiftDown moves the element at idx down to restore heap property
-func (g *GthulhuPlugin) heapSiftDown(idx int) {
-	n := g.taskPoolCount
-	for {
-		left := 2*idx + 1
-		if left >= n {
-			break
-		}
-		smallest := left
-		right := left + 1
-		if right < n && g.heapLess(right, left) {
-			smallest = right
-		}
-		if !g.heapLess(smallest, idx) {
-			break
-		}
-		g.taskPool[idx], g.taskPool[smallest] = g.taskPool[smallest], g.taskPool[idx]
-		idx = smallest
-	}
+// GetTaskPoolLimit returns the number of tasks the pool may hold
+func (g *GthulhuPlugin) GetTaskPoolLimit() int {
+	return g.pool.getLimit()
 }
 
 // lessQueuedTask compares two tasks for priority ordering
 func lessQueuedTask(a, b *Task) bool {
+	// Aged tasks run first, in the order they were enqueued
+	if a.Aged != b.Aged {
+		return a.Aged
+	}
+	if a.Aged && a.EnqueueTs != b.EnqueueTs {
+		return a.EnqueueTs < b.EnqueueTs
+	}
 	if a.Deadline != b.Deadline {
 		return a.Deadline < b.Deadline
 	}
@@ -286,6 +469,10 @@ func (g *GthulhuPlugin) applySchedulingStrategy(task *models.QueuedTask) bool {
 	g.strategyMu.RLock()
 	strategy, exists := g.strategyMap[task.Tgid]
 	g.strategyMu.RUnlock()
+	if exists && strategy.LatencyTargetNs > 0 {
+		// Deadline tasks reaching the fair pool were throttled and compete by vruntime
+		return false
+	}
 	if exists {
 		// Apply strategy
 		if strategy.Priority > 0 {
@@ -315,7 +502,7 @@ func (g *GthulhuPlugin) InitJWTClient(
 	authEnabled bool,
 	mtlsCfg reg.MTLSConfig,
 ) error {
-	client, err := NewJWTClient(publicKeyPath, apiBaseURL, authEnabled, mtlsCfg)
+	client, err := strategyapi.NewJWTClient(publicKeyPath, apiBaseURL, authEnabled, mtlsCfg)
 	if err != nil {
 		return err
 	}
@@ -362,26 +549,47 @@ func (g *GthulhuPlugin) FetchSchedulingStrategies(apiUrl string) ([]util.Schedul
 	if g.jwtClient == nil {
 		return nil, nil // Silently skip if JWT client not initialized
 	}
-	return fetchSchedulingStrategies(g.jwtClient, apiUrl)
+	return strategyapi.Fetch(g.jwtClient, apiUrl)
 }
 
 // UpdateStrategyMap updates the strategy map from a slice of strategies
 func (g *GthulhuPlugin) UpdateStrategyMap(strategies []util.SchedulingStrategy) {
 	// Create a new map to avoid concurrent access issues
 	newMap := make(map[int32]util.SchedulingStrategy)
+	newMasks := make(map[int32][]int32)
+	valid := make([]util.SchedulingStrategy, 0, len(strategies))
+	online := g.onlineCPUs()
 
 	for _, strategy := range strategies {
+		// The Gthulhu plugin has a single scheduling mode
+		if strategy.IsModeSwitch() {
+			continue
+		}
+		if strategy.CPUs != "" {
+			cpus, err := util.ParseCPUMask(strategy.CPUs, online)
+			if err != nil {
+				// The rest of the strategy still applies and is reported as received, only the
+				// scheduler ignores the mask and lets the task run on any CPU
+				log.Printf("Ignoring CPU mask of PID %d: %v", strategy.PID, err)
+			} else {
+				newMasks[int32(strategy.PID)] = cpus
+			}
+		}
 		newMap[int32(strategy.PID)] = strategy
+		valid = append(valid, strategy)
 	}
 
 	// Replace the old map with the new one
 	g.strategyMu.Lock()
 	g.oldStrategyMap = g.strategyMap
 	g.strategyMap = newMap
+	g.cpuMasks = newMasks
 	changed, removed := g.caculateChangedStrategies()
 	g.newStrategy = append(g.newStrategy, changed...)
 	g.removedStrategy = append(g.removedStrategy, removed...)
 	g.strategyMu.Unlock()
+
+	g.updateBandwidthGroups(valid)
 }
 
 // Campare g.oldStrategyMap and g.strategyMap and return the list of SchedulingStrategy that have changed strategies
@@ -1,6 +1,7 @@
 package gthulhu
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/Gthulhu/plugin/models"
@@ -57,13 +58,57 @@ func TestGthulhuPluginTaskPoolInitialization(t *testing.T) {
 	}
 
 	// Verify task pool is allocated
-	if gthulhuPlugin.taskPool == nil {
-		t.Error("Task pool is nil; expected allocated array")
+	if gthulhuPlugin.pool == nil {
+		t.Error("Task pool is nil; expected allocated pool")
 	}
 
-	// Verify task pool size
-	if len(gthulhuPlugin.taskPool) != taskPoolSize {
-		t.Errorf("Task pool size = %d; want %d", len(gthulhuPlugin.taskPool), taskPoolSize)
+	// Verify task pool limit
+	if gthulhuPlugin.GetTaskPoolLimit() != taskPoolLimitDefault {
+		t.Errorf("Task pool limit = %d; want %d", gthulhuPlugin.GetTaskPoolLimit(), taskPoolLimitDefault)
+	}
+}
+
+// TestGthulhuPluginDrainKeepsEveryTask verifies that draining keeps every valid task, whatever
+// the number of tasks left in the queue, and drops invalid PIDs
+func TestGthulhuPluginDrainKeepsEveryTask(t *testing.T) {
+	gthulhuPlugin := NewGthulhuPlugin(0, 0)
+	mockSched := NewMockScheduler()
+	for _, pid := range []int32{100, 101, 0, 102} {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: pid, Weight: 100})
+	}
+
+	if drained := gthulhuPlugin.DrainQueuedTask(mockSched); drained != 3 {
+		t.Errorf("DrainQueuedTask = %d; want 3", drained)
+	}
+	if count := gthulhuPlugin.GetPoolCount(); count != 3 {
+		t.Errorf("GetPoolCount = %d; want 3", count)
+	}
+	for range 3 {
+		if task := gthulhuPlugin.SelectQueuedTask(mockSched); task == nil || task.Pid <= 0 {
+			t.Fatalf("SelectQueuedTask = %v; want a valid task", task)
+		}
+	}
+}
+
+// TestGthulhuPluginDrainIgnoresNrQueued verifies that a dequeued task is pooled even when the
+// number of tasks drained so far equals the number left in the queue. Draining used to stop there
+// and drop the task it had just dequeued, losing the only task of a queue of one.
+func TestGthulhuPluginDrainIgnoresNrQueued(t *testing.T) {
+	for n := 1; n <= 5; n++ {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			gthulhuPlugin := NewGthulhuPlugin(0, 0)
+			mockSched := NewMockScheduler()
+			for i := 0; i < n; i++ {
+				mockSched.EnqueueTask(&models.QueuedTask{Pid: int32(100 + i), Tgid: int32(100 + i), Weight: 100})
+			}
+
+			if drained := gthulhuPlugin.DrainQueuedTask(mockSched); drained != n {
+				t.Errorf("DrainQueuedTask = %d; want %d", drained, n)
+			}
+			if count := gthulhuPlugin.GetPoolCount(); count != uint64(n) {
+				t.Errorf("GetPoolCount = %d after dequeuing %d tasks; want %d", count, mockSched.queueIndex, n)
+			}
+		})
 	}
 }
 
@@ -107,6 +152,7 @@ func TestGthulhuPluginUpdateStrategyMap(t *testing.T) {
 	strategies := []util.SchedulingStrategy{
 		{PID: 100, Priority: 1, ExecutionTime: 10000},
 		{PID: 200, Priority: 0, ExecutionTime: 20000},
+		{Mode: "fifo"}, // Mode switches do not apply to the Gthulhu plugin
 	}
 
 	// Update strategy map
@@ -569,3 +615,59 @@ func TestMinHeapOrderByDeadline(t *testing.T) {
 		}
 	}
 }
+
+// benchmarkStrategies returns n strategies for distinct PIDs, the first changed ones with a
+// different priority
+func benchmarkStrategies(n, changed int) []util.SchedulingStrategy {
+	strategies := make([]util.SchedulingStrategy, n)
+	for i := range strategies {
+		strategies[i] = util.SchedulingStrategy{
+			PID:           1000 + i,
+			Priority:      i % 2,
+			ExecutionTime: uint64(1+i%10) * 1000 * 1000,
+		}
+		if i < changed {
+			strategies[i].Priority = 1 - strategies[i].Priority
+		}
+	}
+	return strategies
+}
+
+// BenchmarkGthulhuPluginStrategyLookup measures the strategy lookups made for each task with 10k
+// strategies, half of the PIDs looked up having none
+func BenchmarkGthulhuPluginStrategyLookup(b *testing.B) {
+	const nrStrategies = 10000
+	g := NewGthulhuPlugin(0, 0)
+	g.UpdateStrategyMap(benchmarkStrategies(nrStrategies, 0))
+	task := models.QueuedTask{Weight: 100}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pid := int32(1000 + i%(2*nrStrategies))
+		task.Pid, task.Tgid = pid, pid
+		g.applySchedulingStrategy(&task)
+		g.getTaskExecutionTime(pid)
+	}
+}
+
+// BenchmarkGthulhuPluginUpdateStrategyMap measures replacing the strategies and collecting the
+// changes, with 1% of the strategies changing at each update
+func BenchmarkGthulhuPluginUpdateStrategyMap(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		b.Run("strategies="+strconv.Itoa(n), func(b *testing.B) {
+			g := NewGthulhuPlugin(0, 0)
+			updates := [][]util.SchedulingStrategy{
+				benchmarkStrategies(n, 0),
+				benchmarkStrategies(n, max(n/100, 1)),
+			}
+			g.UpdateStrategyMap(updates[0])
+			g.GetChangedStrategies()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				g.UpdateStrategyMap(updates[(i+1)%2])
+				g.GetChangedStrategies()
+			}
+		})
+	}
+}
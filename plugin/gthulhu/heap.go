@@ -0,0 +1,16 @@
+package gthulhu
+
+import (
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+)
+
+// taskHeap is a min-heap of tasks ordered by lessQueuedTask. It is not safe for concurrent use;
+// callers hold the lock of its owner.
+type taskHeap = queue.Heap[Task, byPriority]
+
+// byPriority orders the tasks of a taskHeap by lessQueuedTask
+type byPriority struct{}
+
+func (byPriority) Less(a, b *Task) bool {
+	return lessQueuedTask(a, b)
+}
@@ -0,0 +1,64 @@
+package gthulhu
+
+import (
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+const (
+	taskHistorySizeDefault = 8192                    // Maximum number of PIDs tracked for interactivity
+	taskHistoryMaxAge      = 60 * 1000 * 1000 * 1000 // Forget PIDs that have not run for 60s
+
+	interactiveMinWakeups        = 4                // Wakeups observed before a task can be classified
+	interactiveMaxWakeupInterval = 50 * 1000 * 1000 // At least 20 wakeups per second
+	interactiveSleepRunRatio     = 2                // Off-CPU time must be at least twice the run time
+)
+
+// taskHistory tracks the recent behavior of a task to classify it as interactive or batch
+type taskHistory struct {
+	nrEnqueues   uint64
+	nrWakeups    uint64
+	lastWakeup   uint64 // Plugin clock at the last wakeup enqueue
+	lastStopTs   uint64 // StopTs reported at the last enqueue
+	avgWakeupGap uint64 // Average time between two wakeups
+	avgBurst     uint64 // Average run length (StopTs - StartTs)
+	avgSleep     uint64 // Average off-CPU time between two runs
+}
+
+// interactive reports whether the task wakes up often and sleeps much longer than it runs
+func (h *taskHistory) interactive() bool {
+	return h.nrWakeups >= interactiveMinWakeups &&
+		h.avgWakeupGap <= interactiveMaxWakeupInterval &&
+		h.avgSleep >= h.avgBurst*interactiveSleepRunRatio
+}
+
+// updateTaskHistory records the last burst and wakeup of a task and returns a copy of its history
+func (g *GthulhuPlugin) updateTaskHistory(t *models.QueuedTask) taskHistory {
+	var history taskHistory
+	g.taskHistory.Update(t.Pid, func(h *taskHistory) {
+		burst := saturatingSub(t.StopTs, t.StartTs)
+		if h.nrEnqueues == 0 {
+			h.avgBurst = burst
+		} else {
+			h.avgBurst = util.CalcAvg(h.avgBurst, burst)
+			if h.lastStopTs > 0 && t.StartTs >= h.lastStopTs {
+				h.avgSleep = util.CalcAvg(h.avgSleep, t.StartTs-h.lastStopTs)
+			}
+		}
+		h.lastStopTs = t.StopTs
+		h.nrEnqueues++
+
+		if t.Flags&SCX_ENQ_WAKEUP != 0 {
+			now := g.now()
+			if h.nrWakeups == 1 {
+				h.avgWakeupGap = saturatingSub(now, h.lastWakeup)
+			} else if h.nrWakeups > 1 {
+				h.avgWakeupGap = util.CalcAvg(h.avgWakeupGap, saturatingSub(now, h.lastWakeup))
+			}
+			h.lastWakeup = now
+			h.nrWakeups++
+		}
+		history = *h
+	})
+	return history
+}
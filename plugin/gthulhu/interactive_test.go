@@ -0,0 +1,89 @@
+package gthulhu
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// feedTaskHistory replays n enqueues of a task that runs for runNs and then sleeps for sleepNs
+func feedTaskHistory(g *GthulhuPlugin, clock *uint64, pid int32, n int, runNs, sleepNs, flags uint64) {
+	ts := *clock
+	for i := 0; i < n; i++ {
+		ts += sleepNs
+		*clock = ts + runNs
+		g.updateTaskHistory(&models.QueuedTask{
+			Pid:     pid,
+			Tgid:    pid,
+			Weight:  100,
+			Flags:   flags,
+			StartTs: ts,
+			StopTs:  ts + runNs,
+		})
+		ts += runNs
+	}
+}
+
+// TestInteractiveClassification verifies wakeup frequency and sleep/run ratio heuristics
+func TestInteractiveClassification(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := NewGthulhuPlugin(0, 0)
+	g.now = func() uint64 { return clock }
+
+	// Short bursts, long sleeps, frequent wakeups
+	feedTaskHistory(g, &clock, 100, 8, 100*1000, 10*1000*1000, SCX_ENQ_WAKEUP)
+	// Long bursts back to back, never woken up
+	feedTaskHistory(g, &clock, 200, 8, 5*1000*1000, 100*1000, 0)
+	// Frequent wakeups but runs longer than it sleeps
+	feedTaskHistory(g, &clock, 300, 8, 5*1000*1000, 1000*1000, SCX_ENQ_WAKEUP)
+	// Short bursts, long sleeps, but wakes up too rarely
+	feedTaskHistory(g, &clock, 400, 8, 100*1000, 200*1000*1000, SCX_ENQ_WAKEUP)
+
+	tests := []struct {
+		pid         int32
+		interactive bool
+	}{
+		{pid: 100, interactive: true},
+		{pid: 200, interactive: false},
+		{pid: 300, interactive: false},
+		{pid: 400, interactive: false},
+	}
+	for _, tt := range tests {
+		h, _ := g.taskHistory.Get(tt.pid)
+		if h.interactive() != tt.interactive {
+			t.Errorf("PID %d interactive = %v; want %v (history %+v)", tt.pid, h.interactive(), tt.interactive, h)
+		}
+	}
+}
+
+// TestInteractiveDeadlineBonus verifies that an interactive task is selected ahead of a batch task
+func TestInteractiveDeadlineBonus(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := NewGthulhuPlugin(5000*1000, 500*1000)
+	g.now = func() uint64 { return clock }
+	mockSched := NewMockScheduler()
+
+	feedTaskHistory(g, &clock, 200, 8, 100*1000, 10*1000*1000, SCX_ENQ_WAKEUP)
+
+	// Same vtime and burst, only the history of PID 200 differs
+	mockSched.EnqueueTask(&models.QueuedTask{
+		Pid: 100, Tgid: 100, Weight: 100, SumExecRuntime: 1000 * 1000,
+		StartTs: clock, StopTs: clock + 100*1000,
+	})
+	clock += 10 * 1000 * 1000
+	mockSched.EnqueueTask(&models.QueuedTask{
+		Pid: 200, Tgid: 200, Weight: 100, SumExecRuntime: 1000 * 1000, Flags: SCX_ENQ_WAKEUP,
+		StartTs: clock, StopTs: clock + 100*1000,
+	})
+	if drained := g.DrainQueuedTask(mockSched); drained != 2 {
+		t.Fatalf("DrainQueuedTask = %d; want 2", drained)
+	}
+
+	first := g.SelectQueuedTask(mockSched)
+	if first == nil || first.Pid != 200 {
+		t.Fatalf("First selected task = %v; want interactive PID 200", first)
+	}
+	if stats := g.GetStats(); stats.NrInteractive != 1 {
+		t.Errorf("NrInteractive = %d; want 1", stats.NrInteractive)
+	}
+}
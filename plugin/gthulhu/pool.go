@@ -0,0 +1,203 @@
+package gthulhu
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/topology"
+)
+
+const (
+	taskPoolLimitDefault = 1 << 16 // Tasks the pool may hold before draining stops
+	cpusPerShardDefault  = 8       // CPUs per shard when the LLC layout is unknown
+)
+
+// poolShard is one heap of the fair-share pool with its own lock
+type poolShard struct {
+	mu   sync.Mutex
+	heap taskHeap
+}
+
+// taskPool is the fair-share task pool. Tasks are spread over heaps sharded by the LLC of the
+// CPU they last ran on, so enqueues from different LLCs do not contend on a single lock.
+// Each heap grows on demand; the pool as a whole is capped by a configurable limit.
+type taskPool struct {
+	shards  []poolShard
+	shardOf []int // CPU ID -> shard index
+	count   atomic.Int64
+	limit   atomic.Int64
+}
+
+// newTaskPool creates a pool with one shard per distinct value of shardOf
+func newTaskPool(shardOf []int, nrShards int, limit int) *taskPool {
+	p := &taskPool{
+		shards:  make([]poolShard, max(nrShards, 1)),
+		shardOf: shardOf,
+	}
+	p.limit.Store(int64(limit))
+	return p
+}
+
+// newFlatTaskPool creates a pool for nrCPUs CPUs with one shard per cpusPerShardDefault CPUs
+func newFlatTaskPool(nrCPUs int, limit int) *taskPool {
+	shardOf := make([]int, max(nrCPUs, 1))
+	for cpu := range shardOf {
+		shardOf[cpu] = cpu / cpusPerShardDefault
+	}
+	return newTaskPool(shardOf, (len(shardOf)+cpusPerShardDefault-1)/cpusPerShardDefault, limit)
+}
+
+// newLLCTaskPool creates a pool with one shard per last level cache of topo
+func newLLCTaskPool(topo *topology.Topology, limit int) *taskPool {
+	shardOf := make([]int, topo.MaxCPU()+1)
+	llcShard := make(map[int32]int)
+	for _, id := range topo.Online {
+		cpu := topo.CPUs[id]
+		key := id
+		if len(cpu.LLC) > 0 {
+			key = cpu.LLC[0]
+		}
+		shard, ok := llcShard[key]
+		if !ok {
+			shard = len(llcShard)
+			llcShard[key] = shard
+		}
+		shardOf[id] = shard
+	}
+	return newTaskPool(shardOf, len(llcShard), limit)
+}
+
+// shard returns the shard of a task, based on the CPU it last ran on
+func (p *taskPool) shard(t *models.QueuedTask) *poolShard {
+	if t.Cpu >= 0 && int(t.Cpu) < len(p.shardOf) {
+		return &p.shards[p.shardOf[t.Cpu]]
+	}
+	return &p.shards[int(uint32(t.Pid))%len(p.shards)]
+}
+
+// reserve claims room for one task, it returns false when the pool is at its limit
+func (p *taskPool) reserve() bool {
+	if p.count.Add(1) > p.limit.Load() {
+		p.count.Add(-1)
+		return false
+	}
+	return true
+}
+
+// unreserve releases room claimed by reserve that was not used
+func (p *taskPool) unreserve() {
+	p.count.Add(-1)
+}
+
+// push inserts a task into its shard. Room must have been claimed with reserve.
+func (p *taskPool) push(t Task) {
+	s := p.shard(t.QueuedTask)
+	s.mu.Lock()
+	s.heap.Push(t)
+	s.mu.Unlock()
+}
+
+// pop removes and returns the task with the earliest deadline across all shards, or nil if
+// the pool is empty. Concurrent callers may each get a task that is not the global minimum.
+func (p *taskPool) pop() *models.QueuedTask {
+	for p.count.Load() > 0 {
+		best := -1
+		var bestTask Task
+		for i := range p.shards {
+			s := &p.shards[i]
+			s.mu.Lock()
+			if head := s.heap.Peek(); head != nil && (best < 0 || lessQueuedTask(head, &bestTask)) {
+				best = i
+				bestTask = *head
+			}
+			s.mu.Unlock()
+		}
+		if best < 0 {
+			// Tasks are reserved but not pushed yet
+			return nil
+		}
+
+		s := &p.shards[best]
+		s.mu.Lock()
+		var t *models.QueuedTask
+		if s.heap.Len() > 0 {
+			t = s.heap.Pop().QueuedTask
+		}
+		s.mu.Unlock()
+		if t != nil {
+			p.count.Add(-1)
+			return t
+		}
+	}
+	return nil
+}
+
+// promote marks tasks enqueued at or before cutoff as aged and returns how many were promoted
+func (p *taskPool) promote(cutoff uint64) int {
+	promoted := 0
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		n := 0
+		tasks := s.heap.Items()
+		for j := range tasks {
+			t := &tasks[j]
+			if !t.Aged && t.EnqueueTs <= cutoff {
+				t.Aged = true
+				n++
+			}
+		}
+		if n > 0 {
+			s.heap.Init()
+		}
+		s.mu.Unlock()
+		promoted += n
+	}
+	return promoted
+}
+
+// extract removes up to limit tasks matching match. The removed tasks keep their room reserved
+// until the caller releases it with unreserve.
+func (p *taskPool) extract(match func(*Task) bool, limit int) []Task {
+	var out []Task
+	for i := range p.shards {
+		if len(out) >= limit {
+			break
+		}
+		s := &p.shards[i]
+		s.mu.Lock()
+		out = s.heap.Extract(match, limit-len(out), out)
+		s.mu.Unlock()
+	}
+	return out
+}
+
+// len returns the number of tasks in the pool
+func (p *taskPool) len() int {
+	return int(p.count.Load())
+}
+
+// setLimit updates the number of tasks the pool may hold
+func (p *taskPool) setLimit(limit int) {
+	p.limit.Store(int64(limit))
+}
+
+// getLimit returns the number of tasks the pool may hold
+func (p *taskPool) getLimit() int {
+	return int(p.limit.Load())
+}
+
+// moveTo transfers every queued task to another pool
+func (p *taskPool) moveTo(dst *taskPool) {
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		for s.heap.Len() > 0 {
+			dst.count.Add(1)
+			dst.push(s.heap.Pop())
+			p.count.Add(-1)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,340 @@
+package gthulhu
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// TestTaskPoolGrowsPastInitialSize verifies that the pool holds more than the former fixed 4096 tasks
+func TestTaskPoolGrowsPastInitialSize(t *testing.T) {
+	clock := uint64(1000)
+	g := newEDFTestPlugin(&clock, 4)
+	mockSched := NewMockScheduler()
+
+	const nrTasks = 10000
+	for i := 0; i < nrTasks; i++ {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: int32(1000 + i), Tgid: int32(1000 + i), Cpu: int32(i % 16), Weight: 100})
+	}
+	if drained := g.DrainQueuedTask(mockSched); drained != nrTasks {
+		t.Fatalf("DrainQueuedTask = %d; want %d", drained, nrTasks)
+	}
+	if g.GetPoolCount() != nrTasks {
+		t.Errorf("Pool count = %d; want %d", g.GetPoolCount(), nrTasks)
+	}
+	if stats := g.GetStats(); stats.NrPoolOverflow != 0 {
+		t.Errorf("NrPoolOverflow = %d; want 0", stats.NrPoolOverflow)
+	}
+
+	// Tasks come out in deadline order across shards
+	var prev *Task
+	for i := 0; i < nrTasks; i++ {
+		qt := g.SelectQueuedTask(mockSched)
+		if qt == nil {
+			t.Fatalf("SelectQueuedTask returned nil after %d tasks", i)
+		}
+		cur := &Task{QueuedTask: qt, Deadline: qt.Vtime + min(qt.SumExecRuntime, g.sliceNsDefault*100), Timestamp: qt.StartTs}
+		if prev != nil && lessQueuedTask(cur, prev) {
+			t.Fatalf("Task %d popped before %d", cur.Pid, prev.Pid)
+		}
+		prev = cur
+	}
+	if g.SelectQueuedTask(mockSched) != nil || g.GetPoolCount() != 0 {
+		t.Errorf("Pool not empty after draining every task")
+	}
+}
+
+// TestTaskPoolLimitOverflow verifies that draining stops at the limit and counts overflows
+func TestTaskPoolLimitOverflow(t *testing.T) {
+	g := NewGthulhuPlugin(0, 0)
+	g.SetTaskPoolLimit(4)
+	mockSched := NewMockScheduler()
+	for i := 0; i < 6; i++ {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: int32(100 + i), Tgid: int32(100 + i), Weight: 100})
+	}
+
+	if drained := g.DrainQueuedTask(mockSched); drained != 4 {
+		t.Fatalf("DrainQueuedTask = %d; want 4", drained)
+	}
+	if stats := g.GetStats(); stats.NrPoolOverflow != 1 {
+		t.Errorf("NrPoolOverflow = %d; want 1", stats.NrPoolOverflow)
+	}
+	if g.insertTaskToPool(Task{QueuedTask: &models.QueuedTask{Pid: 999}}) {
+		t.Error("insertTaskToPool succeeded on a full pool")
+	}
+
+	// The remaining tasks stay queued and are drained once there is room
+	g.SelectQueuedTask(mockSched)
+	g.SelectQueuedTask(mockSched)
+	if drained := g.DrainQueuedTask(mockSched); drained != 2 {
+		t.Errorf("DrainQueuedTask after pops = %d; want 2", drained)
+	}
+}
+
+// TestTaskPoolLLCSharding verifies that tasks are sharded by the LLC of their previous CPU and
+// survive resharding when the topology is loaded
+func TestTaskPoolLLCSharding(t *testing.T) {
+	g := NewGthulhuPlugin(0, 0)
+	g.SetTaskPoolLimit(100)
+	g.insertTaskToPool(Task{QueuedTask: &models.QueuedTask{Pid: 1, Cpu: 0}, Deadline: 1})
+	if err := g.InitTopology(fakeTopologyFS()); err != nil {
+		t.Fatalf("InitTopology error: %v", err)
+	}
+
+	pool := g.pool
+	if pool.getLimit() != 100 || pool.len() != 1 {
+		t.Fatalf("Resharded pool limit = %d, len = %d; want 100 and 1", pool.getLimit(), pool.len())
+	}
+	if len(pool.shards) != 3 {
+		t.Fatalf("Shards = %d; want 3 (one per LLC)", len(pool.shards))
+	}
+	for _, cpu := range []int32{1, 5, 9} {
+		g.insertTaskToPool(Task{QueuedTask: &models.QueuedTask{Pid: 10 + cpu, Cpu: cpu}, Deadline: uint64(10 + cpu)})
+	}
+	for i, want := range []int{2, 1, 1} {
+		if got := pool.shards[i].heap.Len(); got != want {
+			t.Errorf("Shard %d holds %d tasks; want %d", i, got, want)
+		}
+	}
+
+	expected := []int32{1, 11, 15, 19}
+	for _, pid := range expected {
+		if qt := g.getTaskFromPool(); qt == nil || qt.Pid != pid {
+			t.Fatalf("getTaskFromPool = %v; want PID %d", qt, pid)
+		}
+	}
+}
+
+// TestTaskPoolConcurrentAccess verifies that concurrent drains and selects neither lose nor
+// duplicate tasks
+func TestTaskPoolConcurrentAccess(t *testing.T) {
+	g := NewGthulhuPlugin(0, 0)
+	const producers, perProducer = 4, 1000
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				pid := int32(p*perProducer + i + 1)
+				g.insertTaskToPool(Task{QueuedTask: &models.QueuedTask{Pid: pid, Cpu: int32(i % 32)}, Deadline: uint64(i)})
+			}
+		}(p)
+	}
+
+	seen := make(map[int32]bool)
+	var mu sync.Mutex
+	for c := 0; c < 2; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < producers*perProducer/4; i++ {
+				if qt := g.getTaskFromPool(); qt != nil {
+					mu.Lock()
+					if seen[qt.Pid] {
+						t.Errorf("PID %d selected twice", qt.Pid)
+					}
+					seen[qt.Pid] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for qt := g.getTaskFromPool(); qt != nil; qt = g.getTaskFromPool() {
+		if seen[qt.Pid] {
+			t.Errorf("PID %d selected twice", qt.Pid)
+		}
+		seen[qt.Pid] = true
+	}
+	if len(seen) != producers*perProducer {
+		t.Errorf("Selected %d tasks; want %d", len(seen), producers*perProducer)
+	}
+}
+
+// benchmarkTasks returns n tasks with distinct PIDs and runtimes, so that they spread over the pool
+func benchmarkTasks(n int) []models.QueuedTask {
+	tasks := make([]models.QueuedTask, n)
+	for i := range tasks {
+		pid := int32(1000 + i)
+		tasks[i] = models.QueuedTask{
+			Pid:            pid,
+			Tgid:           pid,
+			Cpu:            -1,
+			Weight:         100,
+			StartTs:        uint64(i) * 1000,
+			StopTs:         uint64(i)*1000 + uint64(i%97)*10000,
+			SumExecRuntime: uint64(i%97) * 10000,
+		}
+	}
+	return tasks
+}
+
+// BenchmarkGthulhuPluginDrain measures draining n tasks into an empty pool
+func BenchmarkGthulhuPluginDrain(b *testing.B) {
+	for _, n := range []int{10, 1000, 4000} {
+		b.Run("pool="+strconv.Itoa(n), func(b *testing.B) {
+			g := NewGthulhuPlugin(0, 0)
+			sched := NewMockScheduler()
+			tasks := benchmarkTasks(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sched.Reset()
+				for j := range tasks {
+					task := tasks[j]
+					sched.EnqueueTask(&task)
+				}
+				b.StartTimer()
+				g.DrainQueuedTask(sched)
+				b.StopTimer()
+				for g.SelectQueuedTask(sched) != nil {
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/task")
+		})
+	}
+}
+
+// BenchmarkGthulhuPluginSelect measures selecting a task from a pool of n tasks, then draining
+// it back after it ran so that the pool keeps its size
+func BenchmarkGthulhuPluginSelect(b *testing.B) {
+	for _, n := range []int{10, 1000, 4000} {
+		b.Run("pool="+strconv.Itoa(n), func(b *testing.B) {
+			g := NewGthulhuPlugin(0, 0)
+			sched := NewMockScheduler()
+			for _, task := range benchmarkTasks(n) {
+				sched.EnqueueTask(&task)
+			}
+			g.DrainQueuedTask(sched)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				task := *g.SelectQueuedTask(sched)
+				task.StartTs = task.StopTs
+				task.StopTs += 10000
+				task.SumExecRuntime += 10000
+				sched.EnqueueTask(&task)
+				g.DrainQueuedTask(sched)
+			}
+		})
+	}
+}
+
+// FuzzTaskPoolOrder interleaves drains, pops, promotions and extractions on the task pool, checking
+// that every pop returns the task a reference queue orders first by lessQueuedTask
+func FuzzTaskPoolOrder(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3, 0, 3, 2, 1, 2, 2, 2})
+	f.Add([]byte{0, 5, 5, 5, 1, 5, 5, 5, 0, 16, 5, 4, 2, 6, 3, 2, 2})
+	f.Add([]byte{1, 0, 7, 0, 1, 1, 7, 0, 7, 2, 11, 1, 0, 2, 0, 3, 3, 2, 2, 2})
+	f.Add([]byte{0, 255, 1, 1, 0, 255, 1, 1, 0, 9, 1, 0, 6, 3, 2})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		next := func() byte {
+			if len(ops) == 0 {
+				return 0
+			}
+			b := ops[0]
+			ops = ops[1:]
+			return b
+		}
+
+		pool := newFlatTaskPool(16, taskPoolLimitDefault)
+		var queued []Task
+		popMin := func() {
+			t.Helper()
+			got := pool.pop()
+			if len(queued) == 0 {
+				if got != nil {
+					t.Fatalf("Empty pool popped task %d", got.Pid)
+				}
+				return
+			}
+			best := 0
+			for i := range queued {
+				if lessQueuedTask(&queued[i], &queued[best]) {
+					best = i
+				}
+			}
+			if got == nil || got.Pid != queued[best].Pid {
+				t.Fatalf("Popped %v; want task %d", got, queued[best].Pid)
+			}
+			queued = append(queued[:best], queued[best+1:]...)
+		}
+
+		pid := int32(1)
+		for len(ops) > 0 {
+			switch op := next(); op % 4 {
+			case 0, 1:
+				// Small ranges so that deadlines and timestamps tie
+				task := Task{
+					QueuedTask: &models.QueuedTask{Pid: pid, Cpu: int32(next()%17) - 1},
+					Deadline:   uint64(next() % 8),
+					Timestamp:  uint64(next() % 4),
+					EnqueueTs:  uint64(op >> 2 % 8),
+				}
+				pid++
+				if !pool.reserve() {
+					t.Fatal("Pool full")
+				}
+				pool.push(task)
+				queued = append(queued, task)
+			case 2:
+				popMin()
+			case 3:
+				if op&4 == 0 {
+					cutoff := uint64(next() % 8)
+					want := 0
+					for i := range queued {
+						if !queued[i].Aged && queued[i].EnqueueTs <= cutoff {
+							queued[i].Aged = true
+							want++
+						}
+					}
+					if got := pool.promote(cutoff); got != want {
+						t.Fatalf("promote(%d) = %d; want %d", cutoff, got, want)
+					}
+					break
+				}
+				mod, limit := int32(next()%3+1), int(next()%4)
+				extracted := pool.extract(func(task *Task) bool { return task.Pid%mod == 0 }, limit)
+				if len(extracted) > limit {
+					t.Fatalf("Extracted %d tasks; want at most %d", len(extracted), limit)
+				}
+				for _, task := range extracted {
+					if task.Pid%mod != 0 {
+						t.Fatalf("Extracted task %d not matching", task.Pid)
+					}
+					found := false
+					for i := range queued {
+						if queued[i].Pid == task.Pid {
+							queued = append(queued[:i], queued[i+1:]...)
+							found = true
+							break
+						}
+					}
+					if !found {
+						t.Fatalf("Extracted task %d not queued", task.Pid)
+					}
+					pool.unreserve()
+				}
+			}
+			if pool.len() != len(queued) {
+				t.Fatalf("Pool holds %d tasks; want %d", pool.len(), len(queued))
+			}
+		}
+
+		for len(queued) > 0 {
+			popMin()
+		}
+		if got := pool.pop(); got != nil || pool.len() != 0 {
+			t.Fatalf("Drained pool popped %v with %d tasks left", got, pool.len())
+		}
+	})
+}
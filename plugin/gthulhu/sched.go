@@ -11,10 +11,10 @@ const (
 	PF_WQ_WORKER       = 0x00000020
 )
 
-const taskPoolSize = 4096
-
 type Task struct {
 	*models.QueuedTask
 	Deadline  uint64
 	Timestamp uint64
+	EnqueueTs uint64 // Time the task entered the pool
+	Aged      bool   // Waited past the starvation threshold, runs ahead of other tasks
 }
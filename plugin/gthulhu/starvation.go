@@ -0,0 +1,40 @@
+package gthulhu
+
+const (
+	starvationThresholdNsDefault = 100 * 1000 * 1000 // 100ms
+	agingScansPerThreshold       = 4                 // Pool scans per threshold period
+)
+
+// ageTasks promotes fair-share tasks that waited longer than the starvation threshold so they
+// run ahead of priority tasks. The pool is scanned a few times per threshold period, which
+// bounds the wait of any task to the threshold plus one scan interval and the aged tasks
+// queued before it. Must be called with poolMu held.
+func (g *GthulhuPlugin) ageTasks(now uint64) {
+	if g.starvationThresholdNs == 0 || now < g.starvationThresholdNs {
+		return
+	}
+	if now-g.lastAgingScan < g.starvationThresholdNs/agingScansPerThreshold {
+		return
+	}
+	g.lastAgingScan = now
+	cutoff := now - g.starvationThresholdNs
+	g.stats.NrStarved += uint64(g.pool.promote(cutoff))
+	if g.cgroups != nil {
+		g.stats.NrStarved += uint64(g.cgroups.promote(cutoff))
+	}
+}
+
+// SetStarvationThreshold updates the time a task may wait in the pool before it is promoted,
+// 0 disables aging
+func (g *GthulhuPlugin) SetStarvationThreshold(thresholdNs uint64) {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	g.starvationThresholdNs = thresholdNs
+}
+
+// GetStarvationThreshold returns the time a task may wait in the pool before it is promoted
+func (g *GthulhuPlugin) GetStarvationThreshold() uint64 {
+	g.poolMu.Lock()
+	defer g.poolMu.Unlock()
+	return g.starvationThresholdNs
+}
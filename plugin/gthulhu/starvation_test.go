@@ -0,0 +1,118 @@
+package gthulhu
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestAgedTasksRunAheadOfPriorityTasks verifies that a task waiting past the threshold is
+// promoted ahead of priority tasks and counted as starved
+func TestAgedTasksRunAheadOfPriorityTasks(t *testing.T) {
+	clock := uint64(1000 * 1000 * 1000)
+	g := newEDFTestPlugin(&clock, 1)
+	g.SetStarvationThreshold(10 * 1000 * 1000)
+	mockSched := NewMockScheduler()
+	g.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, Priority: 1}})
+
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Weight: 100, Tgid: 200})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 201, Weight: 100, Tgid: 201})
+	g.DrainQueuedTask(mockSched)
+
+	// A priority task arriving later normally runs first
+	clock += 5 * 1000 * 1000
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Weight: 100, Tgid: 100})
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 202, Weight: 100, Tgid: 202})
+	g.DrainQueuedTask(mockSched)
+
+	// Once the threshold passed, the first two tasks are promoted in enqueue order
+	clock += 5 * 1000 * 1000
+	var got []int32
+	for task := g.SelectQueuedTask(mockSched); task != nil; task = g.SelectQueuedTask(mockSched) {
+		got = append(got, task.Pid)
+	}
+	want := []int32{200, 201, 100, 202}
+	if len(got) != len(want) {
+		t.Fatalf("Selected %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Selected %v; want %v", got, want)
+		}
+	}
+	if stats := g.GetStats(); stats.NrStarved != 2 {
+		t.Errorf("NrStarved = %d; want 2", stats.NrStarved)
+	}
+}
+
+// TestStarvationSimulationBoundedWait runs four always-runnable priority tasks against two fair
+// tasks on two CPUs and checks that aging bounds the wait of the fair tasks
+func TestStarvationSimulationBoundedWait(t *testing.T) {
+	const (
+		sliceNs     = 5 * 1000 * 1000
+		thresholdNs = 50 * 1000 * 1000
+		rounds      = 400
+	)
+
+	run := func(threshold uint64) (fairDispatches int, maxWait uint64, stats Stats) {
+		clock := uint64(1000 * 1000 * 1000)
+		g := newEDFTestPlugin(&clock, 2)
+		g.SetStarvationThreshold(threshold)
+		mockSched := NewMockScheduler()
+
+		g.UpdateStrategyMap([]util.SchedulingStrategy{
+			{PID: 100, Priority: 1},
+			{PID: 101, Priority: 1},
+			{PID: 102, Priority: 1},
+			{PID: 103, Priority: 1},
+		})
+		enqueuedAt := make(map[int32]uint64)
+		for _, pid := range []int32{100, 101, 102, 103, 200, 201} {
+			mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Weight: 100, Tgid: pid})
+			enqueuedAt[pid] = clock
+		}
+		g.DrainQueuedTask(mockSched)
+
+		for i := 0; i < rounds; i++ {
+			// Dispatch one task per CPU and run it for a full slice
+			running := make([]*models.QueuedTask, 0, 2)
+			for cpu := 0; cpu < 2; cpu++ {
+				task := g.SelectQueuedTask(mockSched)
+				if task == nil {
+					t.Fatalf("round %d: SelectQueuedTask returned nil", i)
+				}
+				if task.Pid >= 200 {
+					fairDispatches++
+					maxWait = max(maxWait, clock-enqueuedAt[task.Pid])
+				}
+				running = append(running, task)
+			}
+			clock += sliceNs
+			for _, task := range running {
+				task.StartTs = clock - sliceNs
+				task.StopTs = clock
+				mockSched.EnqueueTask(task)
+				enqueuedAt[task.Pid] = clock
+			}
+			g.DrainQueuedTask(mockSched)
+		}
+		return fairDispatches, maxWait, g.GetStats()
+	}
+
+	// Without aging the priority tasks monopolize both CPUs
+	fair, _, stats := run(0)
+	if fair != 0 || stats.NrStarved != 0 {
+		t.Errorf("Without aging: fair dispatches = %d, NrStarved = %d; want 0 and 0", fair, stats.NrStarved)
+	}
+
+	// With aging every fair task waits at most the threshold, one scan interval and one slice
+	fair, maxWait, stats := run(thresholdNs)
+	if fair == 0 || stats.NrStarved == 0 {
+		t.Fatalf("With aging: fair dispatches = %d, NrStarved = %d; want both > 0", fair, stats.NrStarved)
+	}
+	bound := uint64(thresholdNs + thresholdNs/agingScansPerThreshold + sliceNs)
+	if maxWait > bound {
+		t.Errorf("Maximum fair task wait = %dns; want <= %dns", maxWait, bound)
+	}
+}
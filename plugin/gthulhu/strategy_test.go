@@ -0,0 +1,87 @@
+package gthulhu
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/internal/strategyapi"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// strategyKeys returns the strategies the Gthulhu plugin keeps by PID, the last one of each PID
+func strategyKeys(strategies []util.SchedulingStrategy) map[int32]util.SchedulingStrategy {
+	keys := make(map[int32]util.SchedulingStrategy)
+	for _, strategy := range strategies {
+		if !strategy.IsModeSwitch() {
+			keys[int32(strategy.PID)] = strategy
+		}
+	}
+	return keys
+}
+
+// checkChanged checks that strategies holds exactly the strategies of want
+func checkChanged(t *testing.T, what string, strategies []util.SchedulingStrategy, want map[int32]util.SchedulingStrategy) {
+	t.Helper()
+	if len(strategies) != len(want) {
+		t.Fatalf("%s %d strategies; want %d", what, len(strategies), len(want))
+	}
+	for _, strategy := range strategies {
+		if w, ok := want[int32(strategy.PID)]; !ok || w != strategy {
+			t.Fatalf("%s strategy %+v; want %+v", what, strategy, w)
+		}
+	}
+}
+
+// FuzzSchedulingStrategies decodes untrusted API responses and applies them, checking that
+// nothing panics and that GetChangedStrategies reports exactly what changed
+func FuzzSchedulingStrategies(f *testing.F) {
+	f.Add([]byte(`{"success":true,"scheduling":[{"pid":100,"priority":1,"execution_time":20000000}]}`))
+	f.Add([]byte(`{"success":true,"scheduling":[{"pid":100,"cpus":"0-3,8"},{"pid":100,"cpus":"bogus"},{"pid":0,"mode":"fifo"}]}`))
+	f.Add([]byte(`{"success":true,"scheduling":[{"pid":200,"latency_target_ns":1000000},{"pid":300,"quota_ns":1,"period_ns":1}]}`))
+	f.Add([]byte(`{"success":true,"scheduling":[{"pid":4294967396,"gang":true},{"pid":-5,"cpus":"7-2"}]}`))
+	f.Add([]byte(`{"success":false}`))
+	f.Add([]byte(`not json`))
+
+	// Invalid CPU lists are logged
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(output) })
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		strategies, err := strategyapi.Decode(body)
+		if err != nil {
+			return
+		}
+		g := NewGthulhuPlugin(0, 0)
+		want := strategyKeys(strategies)
+		g.UpdateStrategyMap(strategies)
+		changed, removed := g.GetChangedStrategies()
+		checkChanged(t, "First update changed", changed, want)
+		checkChanged(t, "First update removed", removed, nil)
+
+		// Tasks matching the strategies go through the hot path
+		mockSched := NewMockScheduler()
+		for pid := range want {
+			if pid > 0 {
+				mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: pid, Cpu: pid % 4, Weight: 100, StopTs: 1000})
+			}
+		}
+		g.DrainQueuedTask(mockSched)
+		for task := g.SelectQueuedTask(mockSched); task != nil; task = g.SelectQueuedTask(mockSched) {
+			g.DetermineTimeSlice(mockSched, task)
+			g.SelectCPU(mockSched, task)
+		}
+
+		g.UpdateStrategyMap(strategies)
+		changed, removed = g.GetChangedStrategies()
+		checkChanged(t, "Same update changed", changed, nil)
+		checkChanged(t, "Same update removed", removed, nil)
+
+		g.UpdateStrategyMap(nil)
+		changed, removed = g.GetChangedStrategies()
+		checkChanged(t, "Clearing changed", changed, nil)
+		checkChanged(t, "Clearing removed", removed, want)
+	})
+}
@@ -0,0 +1,115 @@
+package queue
+
+// Ordering orders the items of a Heap. Implementations are empty structs, so that the zero value
+// of a Heap is ready to use.
+type Ordering[T any] interface {
+	Less(a, b *T) bool
+}
+
+// Heap is a growable binary min-heap of items ordered by O that gives memory back once a burst
+// has been served. The zero value is an empty heap. It is not safe for concurrent use.
+type Heap[T any, O Ordering[T]] struct {
+	items []T
+	order O
+}
+
+// Len returns the number of items in the heap
+func (h *Heap[T, O]) Len() int {
+	return len(h.items)
+}
+
+// Cap returns the capacity of the backing array
+func (h *Heap[T, O]) Cap() int {
+	return cap(h.items)
+}
+
+// Push inserts an item and restores the heap property
+func (h *Heap[T, O]) Push(x T) {
+	h.items = append(h.items, x)
+	idx := len(h.items) - 1
+	for idx > 0 {
+		parent := (idx - 1) / 2
+		if !h.order.Less(&h.items[idx], &h.items[parent]) {
+			break
+		}
+		h.items[idx], h.items[parent] = h.items[parent], h.items[idx]
+		idx = parent
+	}
+}
+
+// Peek returns the smallest item without removing it, or nil when the heap is empty
+func (h *Heap[T, O]) Peek() *T {
+	if len(h.items) == 0 {
+		return nil
+	}
+	return &h.items[0]
+}
+
+// Pop removes and returns the smallest item, the heap must not be empty
+func (h *Heap[T, O]) Pop() T {
+	n := len(h.items) - 1
+	top := h.items[0]
+	h.items[0] = h.items[n]
+	clear(h.items[n:])
+	h.items = h.items[:n]
+	h.down(0)
+
+	// Give memory back once a burst has been served
+	if c := cap(h.items); c > shrinkMin && n < c/4 {
+		h.items = append(make([]T, 0, c/2), h.items...)
+	}
+	return top
+}
+
+// Items returns the items in heap order. Callers modifying them in place must call Init after.
+func (h *Heap[T, O]) Items() []T {
+	return h.items
+}
+
+// Init restores the heap property after items were modified in place
+func (h *Heap[T, O]) Init() {
+	for idx := len(h.items)/2 - 1; idx >= 0; idx-- {
+		h.down(idx)
+	}
+}
+
+// Extract removes up to limit items matching match, appending them to out
+func (h *Heap[T, O]) Extract(match func(*T) bool, limit int, out []T) []T {
+	kept := h.items[:0]
+	found := 0
+	for i := range h.items {
+		if found < limit && match(&h.items[i]) {
+			out = append(out, h.items[i])
+			found++
+			continue
+		}
+		kept = append(kept, h.items[i])
+	}
+	if found == 0 {
+		return out
+	}
+	clear(h.items[len(kept):])
+	h.items = kept
+	h.Init()
+	return out
+}
+
+// down moves the item at idx towards the leaves until the heap property holds
+func (h *Heap[T, O]) down(idx int) {
+	n := len(h.items)
+	for {
+		left := 2*idx + 1
+		if left >= n {
+			break
+		}
+		smallest := left
+		if right := left + 1; right < n && h.order.Less(&h.items[right], &h.items[left]) {
+			smallest = right
+		}
+		if !h.order.Less(&h.items[smallest], &h.items[idx]) {
+			break
+		}
+		h.items[idx], h.items[smallest] = h.items[smallest], h.items[idx]
+		idx = smallest
+	}
+}
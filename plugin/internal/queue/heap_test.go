@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// byValue orders ints in ascending order
+type byValue struct{}
+
+func (byValue) Less(a, b *int) bool {
+	return *a < *b
+}
+
+// TestHeapOrder verifies that random pushes pop in ascending order and that the heap shrinks
+// once drained
+func TestHeapOrder(t *testing.T) {
+	var h Heap[int, byValue]
+	if h.Peek() != nil {
+		t.Fatal("Empty heap returned an item")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	values := make([]int, 1000)
+	for i := range values {
+		values[i] = rng.Intn(100)
+		h.Push(values[i])
+	}
+	slices.Sort(values)
+	capacity := h.Cap()
+	for i, want := range values {
+		if peek := h.Peek(); peek == nil || *peek != want {
+			t.Fatalf("Peek = %v; want %d", peek, want)
+		}
+		if got := h.Pop(); got != want {
+			t.Fatalf("Pop %d = %d; want %d", i, got, want)
+		}
+	}
+	if h.Len() != 0 || h.Cap() >= capacity {
+		t.Errorf("Len = %d with capacity %d after draining; want 0 and less than %d", h.Len(), h.Cap(), capacity)
+	}
+}
+
+// TestHeapExtractAndInit verifies that extracting items and modifying them in place keep the
+// heap ordered
+func TestHeapExtractAndInit(t *testing.T) {
+	var h Heap[int, byValue]
+	for i := 1; i <= 10; i++ {
+		h.Push(i)
+	}
+
+	// Extract two of the even values
+	out := h.Extract(func(v *int) bool { return *v%2 == 0 }, 2, nil)
+	if !slices.Equal(out, []int{2, 4}) && !slices.Equal(out, []int{4, 2}) {
+		t.Errorf("Extract = %v; want 2 and 4", out)
+	}
+
+	// Move 9 and 10 to the front
+	items := h.Items()
+	for i := range items {
+		if items[i] >= 9 {
+			items[i] -= 10
+		}
+	}
+	h.Init()
+
+	want := []int{-1, 0, 1, 3, 5, 6, 7, 8}
+	for _, w := range want {
+		if got := h.Pop(); got != w {
+			t.Fatalf("Pop = %d; want %d", got, w)
+		}
+	}
+	if h.Len() != 0 {
+		t.Errorf("Len = %d; want 0", h.Len())
+	}
+}
@@ -0,0 +1,68 @@
+// Package queue provides the task queues shared by the scheduler plugins
+package queue
+
+import "github.com/Gthulhu/plugin/models"
+
+const shrinkMin = 64 // Capacity below which queues never shrink their backing array
+
+// FIFO is a growable ring buffer of tasks served in arrival order. Its capacity is always a
+// power of two so indexes wrap with a mask. The zero value is an empty queue.
+type FIFO struct {
+	buf   []*models.QueuedTask
+	head  int
+	count int
+}
+
+// Len returns the number of queued tasks
+func (q *FIFO) Len() int {
+	return q.count
+}
+
+// Cap returns the capacity of the buffer
+func (q *FIFO) Cap() int {
+	return len(q.buf)
+}
+
+// Push appends a task, doubling the buffer when it is full
+func (q *FIFO) Push(t *models.QueuedTask) {
+	if q.count == len(q.buf) {
+		q.resize(max(2*len(q.buf), shrinkMin))
+	}
+	q.buf[(q.head+q.count)&(len(q.buf)-1)] = t
+	q.count++
+}
+
+// Peek returns the oldest task without removing it, or nil when the queue is empty
+func (q *FIFO) Peek() *models.QueuedTask {
+	if q.count == 0 {
+		return nil
+	}
+	return q.buf[q.head]
+}
+
+// Pop removes and returns the oldest task, or nil when the queue is empty
+func (q *FIFO) Pop() *models.QueuedTask {
+	if q.count == 0 {
+		return nil
+	}
+	t := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) & (len(q.buf) - 1)
+	q.count--
+
+	// Give memory back once a burst has been served
+	if len(q.buf) > shrinkMin && q.count < len(q.buf)/4 {
+		q.resize(len(q.buf) / 2)
+	}
+	return t
+}
+
+// resize moves the tasks to a buffer of the given capacity, starting at index 0
+func (q *FIFO) resize(capacity int) {
+	buf := make([]*models.QueuedTask, capacity)
+	for i := 0; i < q.count; i++ {
+		buf[i] = q.buf[(q.head+i)&(len(q.buf)-1)]
+	}
+	q.buf = buf
+	q.head = 0
+}
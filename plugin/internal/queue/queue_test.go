@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// TestFIFOOrderWrapAndShrink verifies arrival order across wrap-arounds, growth and shrinking
+func TestFIFOOrderWrapAndShrink(t *testing.T) {
+	var q FIFO
+	if q.Pop() != nil || q.Peek() != nil {
+		t.Fatal("Empty queue returned a task")
+	}
+
+	next, want := int32(1), int32(1)
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			q.Push(&models.QueuedTask{Pid: next})
+			next++
+		}
+	}
+	pop := func(n int) {
+		for i := 0; i < n; i++ {
+			if peek := q.Peek(); peek == nil || peek.Pid != want {
+				t.Fatalf("Peek = %v; want PID %d", peek, want)
+			}
+			if task := q.Pop(); task == nil || task.Pid != want {
+				t.Fatalf("Pop = %v; want PID %d", task, want)
+			}
+			want++
+		}
+	}
+
+	push(48)
+	pop(40)
+	push(60) // Wraps around the end of the buffer
+	pop(30)
+	push(200) // Grows while wrapped
+	if q.Len() != 238 || len(q.buf) != 256 {
+		t.Fatalf("Len = %d with capacity %d; want 238 with 256", q.Len(), len(q.buf))
+	}
+	pop(230)
+	if len(q.buf) >= 256 {
+		t.Errorf("Capacity = %d after draining; want it shrunk", len(q.buf))
+	}
+	pop(8)
+	if q.Len() != 0 || q.Pop() != nil {
+		t.Errorf("Len = %d after popping every task; want 0", q.Len())
+	}
+}
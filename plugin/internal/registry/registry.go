@@ -3,6 +3,8 @@ package registry
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"os"
 	"sync"
 
 	"github.com/Gthulhu/plugin/models"
@@ -36,6 +38,49 @@ type CustomScheduler interface {
 type Scheduler struct {
 	SliceNsDefault uint64 `yaml:"slice_ns_default"`
 	SliceNsMin     uint64 `yaml:"slice_ns_min"`
+
+	// EDFBandwidth is the percentage of each EDF period that deadline tasks may consume
+	// before they are demoted to the fair-share class (Gthulhu plugin)
+	EDFBandwidth uint64 `yaml:"edf_bandwidth"`
+	EDFPeriodNs  uint64 `yaml:"edf_period_ns"`
+
+	// TaskStateSweepInterval is the interval in seconds between sweeps that drop exited PIDs
+	// from per-task state tables (0 disables the sweep)
+	TaskStateSweepInterval int `yaml:"task_state_sweep_interval"`
+
+	// TaskPoolLimit is the number of tasks the Gthulhu plugin pool may hold before it stops
+	// draining the kernel queue (0 uses the default)
+	TaskPoolLimit int `yaml:"task_pool_limit"`
+
+	// StarvationThresholdNs is the time a task may wait in the Gthulhu plugin pool before it is
+	// promoted ahead of priority tasks (0 uses the default)
+	StarvationThresholdNs uint64 `yaml:"starvation_threshold_ns"`
+
+	// CgroupFairness shares CPU time between cgroups in proportion to cpu.weight before sharing
+	// it between the tasks of each cgroup (Gthulhu plugin)
+	CgroupFairness bool `yaml:"cgroup_fairness"`
+
+	// DispatchPolicy is "local" to dispatch tasks directly to the idle CPU found by
+	// DefaultSelectCPU, or "global" to queue every task to the global pool (Simple plugin)
+	DispatchPolicy string `yaml:"dispatch_policy"`
+
+	// MLFQLevels is the number of levels of the MLFQ plugin (0 uses the default), the quantum of
+	// the top level is SliceNsDefault and doubles at each level below
+	MLFQLevels int `yaml:"mlfq_levels"`
+	// MLFQBoostIntervalNs is the interval between boosts of every MLFQ task to the top level
+	// (0 uses the default)
+	MLFQBoostIntervalNs uint64 `yaml:"mlfq_boost_interval_ns"`
+
+	// LotterySeed seeds the random number generator of the lottery plugin so that runs can be
+	// reproduced (0 seeds it from the clock)
+	LotterySeed int64 `yaml:"lottery_seed"`
+
+	// EnergyPackThreshold is the utilization in percent up to which the energy plugin keeps
+	// packing tasks onto a busy CPU (0 uses the default)
+	EnergyPackThreshold uint64 `yaml:"energy_pack_threshold"`
+	// EnergySpreadThreshold is the average utilization of the CPUs in percent above which the
+	// energy plugin spreads tasks over idle CPUs (0 uses the default)
+	EnergySpreadThreshold uint64 `yaml:"energy_spread_threshold"`
 }
 
 // MTLSConfig holds the mutual TLS configuration used for plugin → API server communication.
@@ -51,7 +96,7 @@ type MTLSConfig struct {
 type APIConfig struct {
 	PublicKeyPath string     `yaml:"public_key_path"`
 	BaseURL       string     `yaml:"base_url"`
-	Interval      int        `yaml:"interval"`
+	Interval      int        `yaml:"interval"` // Seconds between strategy fetches, 10 if unset
 	Enabled       bool       `yaml:"enabled"`
 	AuthEnabled   bool       `yaml:"auth_enabled"`
 	MTLS          MTLSConfig `yaml:"mtls"`
@@ -68,6 +113,26 @@ type SchedConfig struct {
 
 	// API configuration
 	APIConfig APIConfig `yaml:"api_config"`
+
+	// Host holds the filesystems plugins inspect the host through
+	Host Host `yaml:"-"`
+}
+
+// Host holds the filesystems plugins read the CPU topology, task affinity and cgroups from. Nil
+// filesystems are those of the running host; replay and tests set fake ones so that the
+// decisions of a plugin do not depend on the machine it runs on.
+type Host struct {
+	SysfsCPU fs.FS // Rooted at /sys/devices/system/cpu
+	Proc     fs.FS // Rooted at /proc
+	Cgroupfs fs.FS // Rooted at /sys/fs/cgroup
+}
+
+// HostFS returns fsys, or the directory dir of the running host when fsys is nil
+func HostFS(fsys fs.FS, dir string) fs.FS {
+	if fsys != nil {
+		return fsys
+	}
+	return os.DirFS(dir)
 }
 
 // PluginFactory is a function type that creates a CustomScheduler instance
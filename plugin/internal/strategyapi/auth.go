@@ -1,4 +1,4 @@
-package gthulhu
+package strategyapi
 
 import (
 	"bytes"
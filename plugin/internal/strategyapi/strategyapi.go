@@ -0,0 +1,116 @@
+// Package strategyapi follows the scheduling strategies published by the API server, for every
+// plugin that applies them
+package strategyapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// DefaultInterval is the interval between fetches when APIConfig.Interval is not set
+const DefaultInterval = 10 * time.Second
+
+// strategiesPath is the API endpoint listing the scheduling strategies
+const strategiesPath = "/api/v1/scheduling/strategies"
+
+// Fetch fetches scheduling strategies from the API server with JWT authentication
+func Fetch(jwtClient *JWTClient, apiUrl string) ([]util.SchedulingStrategy, error) {
+	if jwtClient == nil {
+		return nil, fmt.Errorf("JWT client not initialized")
+	}
+	resp, err := jwtClient.MakeAuthenticatedRequest("GET", apiUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = resp.Body.Close()
+		if err != nil {
+			fmt.Printf("Body.Close() failed: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(body)
+}
+
+// Decode decodes the strategies of an API response, nil if the request failed
+func Decode(body []byte) ([]util.SchedulingStrategy, error) {
+	var response util.SchedulingStrategiesResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	// Only update if successful
+	if response.Success {
+		return response.Scheduling, nil
+	}
+
+	return nil, nil
+}
+
+// Start follows the scheduling strategies of the API server. When the API is enabled in config
+// it creates a JWT client and periodically passes the fetched strategies to update, otherwise it
+// does nothing.
+func Start(ctx context.Context, config reg.APIConfig, update func([]util.SchedulingStrategy)) error {
+	if !config.Enabled || config.PublicKeyPath == "" || config.BaseURL == "" {
+		return nil
+	}
+	jwtClient, err := NewJWTClient(config.PublicKeyPath, config.BaseURL, config.AuthEnabled, config.MTLS)
+	if err != nil {
+		return err
+	}
+	fetch := func(apiUrl string) ([]util.SchedulingStrategy, error) {
+		return Fetch(jwtClient, apiUrl)
+	}
+	StartFetcher(ctx, fetch, config.BaseURL, time.Duration(config.Interval)*time.Second, update)
+	return nil
+}
+
+// StartFetcher starts a background goroutine passing the strategies returned by fetch to update,
+// immediately and then at every interval. A non-positive interval selects DefaultInterval.
+func StartFetcher(
+	ctx context.Context,
+	fetch func(apiUrl string) ([]util.SchedulingStrategy, error),
+	baseURL string,
+	interval time.Duration,
+	update func([]util.SchedulingStrategy),
+) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		// Fetch immediately on start
+		if strategies, err := fetch(baseURL + strategiesPath); err == nil && strategies != nil {
+			log.Printf("Initial scheduling strategies fetched: %d strategies", len(strategies))
+			update(strategies)
+		} else if err != nil {
+			log.Printf("Failed to fetch initial scheduling strategies: %v", err)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				if strategies, err := fetch(baseURL + strategiesPath); err == nil && strategies != nil {
+					log.Printf("Scheduling strategies updated: %d strategies", len(strategies))
+					update(strategies)
+				} else if err != nil {
+					log.Printf("Failed to fetch scheduling strategies: %v", err)
+				}
+			}
+		}
+	}()
+}
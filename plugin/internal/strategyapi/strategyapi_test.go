@@ -0,0 +1,46 @@
+package strategyapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestDecodeSchedulingStrategies verifies that only successful responses yield strategies
+func TestDecodeSchedulingStrategies(t *testing.T) {
+	strategies, err := Decode([]byte(`{"success":true,"scheduling":[{"pid":100,"priority":1}]}`))
+	if err != nil || len(strategies) != 1 || strategies[0].PID != 100 {
+		t.Errorf("Decode = %v, %v; want PID 100", strategies, err)
+	}
+	strategies, err = Decode([]byte(`{"success":false,"scheduling":[{"pid":100}]}`))
+	if err != nil || strategies != nil {
+		t.Errorf("Decode = %v, %v; want nothing for a failed request", strategies, err)
+	}
+	if _, err := Decode([]byte(`{"success":true,"scheduling":{}}`)); err == nil {
+		t.Error("Decode accepted a malformed response")
+	}
+}
+
+// TestStartFetcherZeroInterval verifies that an unset interval falls back to DefaultInterval
+// instead of panicking in the ticker
+func TestStartFetcherZeroInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	urls := make(chan string, 1)
+	fetch := func(apiUrl string) ([]util.SchedulingStrategy, error) {
+		urls <- apiUrl
+		return nil, nil
+	}
+	StartFetcher(ctx, fetch, "http://api", 0, func([]util.SchedulingStrategy) {})
+	select {
+	case url := <-urls:
+		if url != "http://api"+strategiesPath {
+			t.Errorf("Fetched %q; want %q", url, "http://api"+strategiesPath)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fetcher did not fetch on start")
+	}
+}
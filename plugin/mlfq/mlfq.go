@@ -0,0 +1,277 @@
+// Package mlfq implements a multi-level feedback queue scheduler. Tasks start at the top level
+// and are demoted each time they run for the whole quantum of their level, so CPU-bound tasks
+// sink while interactive tasks that block early stay on top. All tasks are periodically boosted back
+// to the top level so that no task starves.
+package mlfq
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+func init() {
+	err := reg.RegisterNewPlugin("mlfq", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		mlfqPlugin, err := newMLFQPlugin(config.Scheduler.MLFQLevels, config.Scheduler.SliceNsDefault,
+			reg.HostFS(config.Host.Proc, affinity.ProcPath))
+		if err != nil {
+			return nil, err
+		}
+		if config.Scheduler.MLFQBoostIntervalNs > 0 {
+			mlfqPlugin.SetBoostInterval(config.Scheduler.MLFQBoostIntervalNs)
+		}
+		if config.Scheduler.TaskStateSweepInterval > 0 {
+			mlfqPlugin.levels.StartSweeper(ctx, time.Duration(config.Scheduler.TaskStateSweepInterval)*time.Second)
+		}
+		return mlfqPlugin, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	nrLevelsDefault      = 4
+	nrLevelsMax          = 16
+	quantumBaseDefault   = 2000 * 1000        // 2ms in nanoseconds, quanta double at each level
+	boostIntervalDefault = 1000 * 1000 * 1000 // 1s in nanoseconds
+	cpuAny               = 1 << 20            // Let the kernel pick any CPU
+)
+
+// taskLevel is the MLFQ level of a task, only valid for the boost epoch it was recorded in
+type taskLevel struct {
+	level int
+	epoch uint64
+}
+
+// MLFQPlugin implements a multi-level feedback queue scheduler
+type MLFQPlugin struct {
+	// Protects everything below
+	mu sync.Mutex
+
+	// Quantum of each level, level 0 is the highest priority
+	quanta []uint64
+	queues []queue.FIFO
+	count  int
+
+	// Tasks are boosted back to level 0 every boostInterval, which starts a new epoch
+	boostInterval uint64
+	nextBoost     uint64
+	epoch         uint64
+
+	levels *taskstate.Table[taskLevel]
+	now    func() uint64
+
+	stats Stats
+}
+
+// Stats holds the counters of the plugin
+type Stats struct {
+	// Queued is the number of tasks queued at each level
+	Queued []int
+	// Dispatched is the number of tasks dispatched from each level
+	Dispatched  []uint64
+	NrDemotions uint64
+	NrBoosts    uint64
+}
+
+// Verify that MLFQPlugin implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*MLFQPlugin)(nil)
+
+// NewMLFQPlugin creates a new MLFQPlugin with the given number of levels, and quantum of the top
+// level, which doubles at each level below. Zero values use the defaults.
+func NewMLFQPlugin(nrLevels int, quantumBase uint64) (*MLFQPlugin, error) {
+	return newMLFQPlugin(nrLevels, quantumBase, os.DirFS(affinity.ProcPath))
+}
+
+// newMLFQPlugin creates a plugin detecting exited tasks through the given /proc filesystem
+func newMLFQPlugin(nrLevels int, quantumBase uint64, procFS fs.FS) (*MLFQPlugin, error) {
+	if nrLevels == 0 {
+		nrLevels = nrLevelsDefault
+	}
+	if nrLevels < 1 || nrLevels > nrLevelsMax {
+		return nil, fmt.Errorf("invalid number of MLFQ levels %d (1-%d)", nrLevels, nrLevelsMax)
+	}
+	if quantumBase == 0 {
+		quantumBase = quantumBaseDefault
+	}
+
+	m := &MLFQPlugin{
+		quanta:        make([]uint64, nrLevels),
+		queues:        make([]queue.FIFO, nrLevels),
+		boostInterval: boostIntervalDefault,
+		now:           util.Now,
+		stats:         Stats{Dispatched: make([]uint64, nrLevels)},
+	}
+	for level := range m.quanta {
+		m.quanta[level] = quantumBase << level
+	}
+	m.levels = taskstate.New[taskLevel](taskstate.Options{
+		Now:    func() uint64 { return m.now() },
+		ProcFS: procFS,
+	})
+	return m, nil
+}
+
+// SetClock replaces the clock used for boosts and per-task state, it must be called before
+// scheduling starts
+func (m *MLFQPlugin) SetClock(now func() uint64) {
+	m.now = now
+}
+
+// SetBoostInterval sets the interval in nanoseconds between boosts of every task to the top level
+func (m *MLFQPlugin) SetBoostInterval(interval uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.boostInterval = interval
+	m.nextBoost = 0
+}
+
+// GetBoostInterval returns the interval in nanoseconds between boosts
+func (m *MLFQPlugin) GetBoostInterval() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.boostInterval
+}
+
+// GetQuanta returns the quantum of each level
+func (m *MLFQPlugin) GetQuanta() []uint64 {
+	return append([]uint64(nil), m.quanta...)
+}
+
+// DrainQueuedTask drains tasks from the scheduler queue, demoting those that used the whole
+// quantum of their level
+func (m *MLFQPlugin) DrainQueuedTask(s reg.Sched) int {
+	count := 0
+	for {
+		task := &models.QueuedTask{}
+		s.DequeueTask(task)
+		if task.Pid <= 0 {
+			return count
+		}
+
+		m.mu.Lock()
+		m.maybeBoost()
+		m.queues[m.chargeTask(task)].Push(task)
+		m.count++
+		m.mu.Unlock()
+		count++
+	}
+}
+
+// chargeTask compares the last run of the task with the quantum of its level and returns the
+// level it is queued at. Must be called with mu held.
+func (m *MLFQPlugin) chargeTask(task *models.QueuedTask) int {
+	var ran uint64
+	if task.StopTs > task.StartTs {
+		ran = task.StopTs - task.StartTs
+	}
+
+	level := 0
+	m.levels.Update(task.Pid, func(state *taskLevel) {
+		if state.epoch != m.epoch {
+			*state = taskLevel{epoch: m.epoch}
+		}
+		if ran >= m.quanta[state.level] && state.level < len(m.quanta)-1 {
+			state.level++
+			m.stats.NrDemotions++
+		}
+		level = state.level
+	})
+	return level
+}
+
+// maybeBoost moves every task back to the top level once the boost interval has elapsed. Must be
+// called with mu held.
+func (m *MLFQPlugin) maybeBoost() {
+	now := m.now()
+	if m.nextBoost == 0 {
+		m.nextBoost = now + m.boostInterval
+		return
+	}
+	if now < m.nextBoost {
+		return
+	}
+	m.nextBoost = now + m.boostInterval
+
+	// Older tasks of the lower levels queue behind those of the top level
+	m.epoch++
+	m.stats.NrBoosts++
+	for level := 1; level < len(m.queues); level++ {
+		for task := m.queues[level].Pop(); task != nil; task = m.queues[level].Pop() {
+			m.queues[0].Push(task)
+		}
+	}
+}
+
+// SelectQueuedTask returns the oldest task of the highest non-empty level
+func (m *MLFQPlugin) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maybeBoost()
+	for level := range m.queues {
+		if task := m.queues[level].Pop(); task != nil {
+			m.count--
+			m.stats.Dispatched[level]++
+			return task
+		}
+	}
+	return nil
+}
+
+// SelectCPU lets the kernel pick any CPU
+func (m *MLFQPlugin) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	return nil, cpuAny
+}
+
+// DetermineTimeSlice returns the quantum of the level of the task
+func (m *MLFQPlugin) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quanta[m.levelOf(t.Pid)]
+}
+
+// levelOf returns the current level of a task. Must be called with mu held.
+func (m *MLFQPlugin) levelOf(pid int32) int {
+	state, ok := m.levels.Get(pid)
+	if !ok || state.epoch != m.epoch {
+		return 0
+	}
+	return state.level
+}
+
+// GetPoolCount returns the number of queued tasks
+func (m *MLFQPlugin) GetPoolCount() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return uint64(m.count)
+}
+
+// GetStats returns the level occupancy and counters of the plugin
+func (m *MLFQPlugin) GetStats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Queued = make([]int, len(m.queues))
+	for level := range m.queues {
+		stats.Queued[level] = m.queues[level].Len()
+	}
+	stats.Dispatched = append([]uint64(nil), m.stats.Dispatched...)
+	return stats
+}
+
+func (m *MLFQPlugin) SendMetrics(data interface{}) {}
+
+func (m *MLFQPlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return nil, nil
+}
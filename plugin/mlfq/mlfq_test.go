@@ -0,0 +1,196 @@
+package mlfq
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+)
+
+// newTestPlugin creates an MLFQPlugin with 3 levels of 1000, 2000 and 4000ns driven by clock
+func newTestPlugin(t *testing.T, clock *uint64) *MLFQPlugin {
+	t.Helper()
+	m, err := NewMLFQPlugin(3, 1000)
+	if err != nil {
+		t.Fatalf("NewMLFQPlugin: %v", err)
+	}
+	m.now = func() uint64 { return *clock }
+	return m
+}
+
+// run dispatches the next task, lets it run for the given time, at most its slice, and returns
+// it to the mock scheduler
+func run(t *testing.T, m *MLFQPlugin, sched *plugintest.Sched, clock *uint64, ran func(*models.QueuedTask) uint64) *models.QueuedTask {
+	t.Helper()
+	m.DrainQueuedTask(sched)
+	task := m.SelectQueuedTask(sched)
+	if task == nil {
+		t.Fatal("SelectQueuedTask returned nil")
+	}
+	task.StartTs = *clock
+	*clock += min(ran(task), m.DetermineTimeSlice(sched, task))
+	task.StopTs = *clock
+	sched.Enqueue(task)
+	return task
+}
+
+// TestNewMLFQPlugin verifies level configuration
+func TestNewMLFQPlugin(t *testing.T) {
+	m, err := NewMLFQPlugin(0, 0)
+	if err != nil {
+		t.Fatalf("NewMLFQPlugin: %v", err)
+	}
+	quanta := m.GetQuanta()
+	if len(quanta) != nrLevelsDefault || quanta[0] != quantumBaseDefault || quanta[3] != 8*quantumBaseDefault {
+		t.Errorf("Default quanta = %v", quanta)
+	}
+
+	for _, nrLevels := range []int{-1, nrLevelsMax + 1} {
+		if _, err := NewMLFQPlugin(nrLevels, 0); err == nil {
+			t.Errorf("NewMLFQPlugin(%d) succeeded; want an error", nrLevels)
+		}
+	}
+}
+
+// TestMLFQDemotion verifies that CPU-bound tasks sink while interactive tasks stay on top
+func TestMLFQDemotion(t *testing.T) {
+	var clock uint64 = 1
+	m := newTestPlugin(t, &clock)
+	sched := plugintest.NewSched(1)
+	hog := &models.QueuedTask{Pid: 100, Weight: 100}
+	interactive := &models.QueuedTask{Pid: 200, Weight: 100}
+	sched.Enqueue(hog)
+	sched.Enqueue(interactive)
+
+	// The interactive task runs for 100ns and sleeps for 3000ns, the hog never blocks
+	var wakeup, maxLatency uint64
+	sleeping := false
+	for i := 0; i < 100; i++ {
+		if sleeping && clock >= wakeup {
+			sched.Enqueue(interactive)
+			sleeping = false
+		}
+		m.DrainQueuedTask(sched)
+		task := m.SelectQueuedTask(sched)
+		if task == nil {
+			t.Fatal("SelectQueuedTask returned nil")
+		}
+		slice := m.DetermineTimeSlice(sched, task)
+
+		task.StartTs = clock
+		if task.Pid == interactive.Pid {
+			maxLatency = max(maxLatency, clock-wakeup)
+			clock += min(100, slice)
+			task.StopTs = clock
+			interactive, wakeup, sleeping = task, clock+3000, true
+			continue
+		}
+		clock += slice
+		task.StopTs = clock
+		sched.Enqueue(task)
+	}
+
+	if level := m.levelOf(hog.Pid); level != 2 {
+		t.Errorf("CPU-bound task level = %d; want 2", level)
+	}
+	if level := m.levelOf(interactive.Pid); level != 0 {
+		t.Errorf("Interactive task level = %d; want 0", level)
+	}
+	if stats := m.GetStats(); stats.NrDemotions != 2 {
+		t.Errorf("NrDemotions = %d; want 2", stats.NrDemotions)
+	}
+
+	// A waking interactive task waits at most for the slice of the bottom level
+	if maxLatency > 4000 {
+		t.Errorf("Interactive task waited %dns; want at most 4000", maxLatency)
+	}
+}
+
+// TestMLFQYieldKeepsLevel verifies that tasks blocking before the end of their quantum keep their level
+func TestMLFQYieldKeepsLevel(t *testing.T) {
+	var clock uint64 = 1
+	m := newTestPlugin(t, &clock)
+	sched := plugintest.NewSched(1)
+	sched.Enqueue(&models.QueuedTask{Pid: 100, Weight: 100})
+
+	// Use the whole quantum once, then block just before its end
+	run(t, m, sched, &clock, func(*models.QueuedTask) uint64 { return 1 << 30 })
+	for i := 0; i < 5; i++ {
+		run(t, m, sched, &clock, func(task *models.QueuedTask) uint64 {
+			return m.quanta[m.levelOf(task.Pid)] - 1
+		})
+	}
+	m.DrainQueuedTask(sched)
+	if level := m.levelOf(100); level != 1 {
+		t.Errorf("Level = %d; want 1", level)
+	}
+	if stats := m.GetStats(); stats.NrDemotions != 1 || stats.Queued[1] != 1 {
+		t.Errorf("Stats = %+v; want 1 demotion and the task queued at level 1", stats)
+	}
+}
+
+// TestMLFQBoost verifies that demoted tasks are periodically boosted back to the top level
+func TestMLFQBoost(t *testing.T) {
+	var clock uint64 = 1
+	m := newTestPlugin(t, &clock)
+	m.SetBoostInterval(100000)
+	sched := plugintest.NewSched(1)
+	for pid := int32(100); pid < 103; pid++ {
+		sched.Enqueue(&models.QueuedTask{Pid: pid, Weight: 100})
+	}
+
+	cpuBound := func(*models.QueuedTask) uint64 { return 1 << 30 }
+	for i := 0; i < 9; i++ {
+		run(t, m, sched, &clock, cpuBound)
+	}
+	m.DrainQueuedTask(sched)
+	if stats := m.GetStats(); stats.Queued[2] != 3 || stats.NrBoosts != 0 {
+		t.Fatalf("Before boost: %+v; want 3 tasks queued at level 2 and no boost", stats)
+	}
+
+	clock += 100000
+	task := m.SelectQueuedTask(sched)
+	if task == nil || m.levelOf(task.Pid) != 0 {
+		t.Fatalf("SelectQueuedTask = %v; want a task boosted to level 0", task)
+	}
+	stats := m.GetStats()
+	if stats.NrBoosts != 1 || stats.Queued[0] != 2 || stats.Queued[2] != 0 {
+		t.Errorf("After boost: %+v; want 1 boost and 2 tasks queued at level 0", stats)
+	}
+	if slice := m.DetermineTimeSlice(sched, task); slice != 1000 {
+		t.Errorf("Slice after boost = %d; want 1000", slice)
+	}
+}
+
+// TestMLFQFactory verifies that the factory applies the scheduler configuration and host
+func TestMLFQFactory(t *testing.T) {
+	config := &reg.SchedConfig{
+		Mode:      "mlfq",
+		Scheduler: reg.Scheduler{SliceNsDefault: 500, MLFQLevels: 2, MLFQBoostIntervalNs: 7000},
+		Host:      reg.Host{Proc: fstest.MapFS{}},
+	}
+	scheduler, err := reg.NewSchedulerPlugin(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin: %v", err)
+	}
+	m := scheduler.(*MLFQPlugin)
+	if quanta := m.GetQuanta(); len(quanta) != 2 || quanta[0] != 500 || quanta[1] != 1000 {
+		t.Errorf("Quanta = %v; want [500 1000]", quanta)
+	}
+	if interval := m.GetBoostInterval(); interval != 7000 {
+		t.Errorf("Boost interval = %d; want 7000", interval)
+	}
+	// PID 1 is missing from the fake /proc of the host
+	m.levels.Update(1, func(*taskLevel) {})
+	if dead := m.levels.SweepDead(); dead != 1 {
+		t.Errorf("SweepDead = %d; want 1 with the host /proc", dead)
+	}
+
+	config.Scheduler.MLFQLevels = nrLevelsMax + 1
+	if _, err := reg.NewSchedulerPlugin(context.Background(), config); err == nil {
+		t.Error("NewSchedulerPlugin succeeded with too many levels")
+	}
+}
@@ -13,6 +13,7 @@ type (
 	Scheduler       = reg.Scheduler
 	MTLSConfig      = reg.MTLSConfig
 	APIConfig       = reg.APIConfig
+	Host            = reg.Host
 	SchedConfig     = reg.SchedConfig
 	PluginFactory   = reg.PluginFactory
 )
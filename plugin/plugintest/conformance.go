@@ -0,0 +1,341 @@
+// Package plugintest is a conformance suite for CustomScheduler implementations. Run creates
+// plugins with a PluginFactory and checks the invariants every plugin must keep, whatever its
+// policy: drained tasks are selected exactly once, the pool count is accurate, invalid PIDs are
+// dropped, time slices are sane and the pool is safe for concurrent use.
+//
+//	func TestConformance(t *testing.T) {
+//		plugintest.Run(t, myFactory, &plugin.SchedConfig{Mode: "mine"})
+//	}
+package plugintest
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+)
+
+const (
+	nrCPUs = 4
+	// maxSlice is the longest time slice considered sane
+	maxSlice = 1000 * 1000 * 1000 // 1s in nanoseconds
+	// concurrentTimeout bounds the concurrency check
+	concurrentTimeout = 10 * time.Second
+)
+
+// Run runs the conformance suite against the plugins created by factory with config. Every
+// check creates a new plugin, which must hand out every task it drains without a strategy
+// holding tasks back.
+func Run(t *testing.T, factory reg.PluginFactory, config *reg.SchedConfig) {
+	t.Helper()
+	checks := []struct {
+		name  string
+		check func(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig)
+	}{
+		{"EmptyPool", checkEmptyPool},
+		{"NoLossOrDuplication", checkNoLossOrDuplication},
+		{"PoolCount", checkPoolCount},
+		{"InvalidPIDs", checkInvalidPIDs},
+		{"TimeSlice", checkTimeSlice},
+		{"Concurrent", checkConcurrent},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, newPlugin(t, factory, config), config)
+		})
+	}
+}
+
+// newPlugin creates a plugin with a copy of config, stopped at the end of the test
+func newPlugin(t *testing.T, factory reg.PluginFactory, config *reg.SchedConfig) reg.CustomScheduler {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c := *config
+	s, err := factory(ctx, &c)
+	if err != nil {
+		t.Fatalf("Factory failed: %v", err)
+	}
+	if s == nil {
+		t.Fatal("Factory returned a nil plugin")
+	}
+	return s
+}
+
+// newTasks returns n runnable tasks with consecutive PIDs from first and varied weights
+func newTasks(first int32, n int) []*models.QueuedTask {
+	weights := []uint64{100, 50, 200, 100, 1000}
+	tasks := make([]*models.QueuedTask, n)
+	for i := range tasks {
+		pid := first + int32(i)
+		tasks[i] = &models.QueuedTask{
+			Pid:           pid,
+			Tgid:          pid,
+			Cpu:           -1,
+			NrCpusAllowed: nrCPUs,
+			Weight:        weights[i%len(weights)],
+		}
+	}
+	return tasks
+}
+
+// drainAll drains the queue of sched into s and returns the number of tasks s reported
+func drainAll(t *testing.T, s reg.CustomScheduler, sched *Sched) int {
+	t.Helper()
+	var drained int
+	for sched.GetNrQueued() > 0 {
+		before := sched.GetNrQueued()
+		drained += s.DrainQueuedTask(sched)
+		if sched.GetNrQueued() == before {
+			t.Fatalf("DrainQueuedTask made no progress with %d tasks queued", before)
+		}
+	}
+	return drained
+}
+
+// selectAll selects tasks from s until it returns nil, checking that the pool count drops by one
+// with each task, and returns copies of the selected tasks
+func selectAll(t *testing.T, s reg.CustomScheduler, sched *Sched) []models.QueuedTask {
+	t.Helper()
+	var selected []models.QueuedTask
+	for count := s.GetPoolCount(); ; count-- {
+		task := s.SelectQueuedTask(sched)
+		if task == nil {
+			if count != 0 {
+				t.Errorf("SelectQueuedTask returned nil with a pool count of %d", count)
+			}
+			return selected
+		}
+		if count == 0 {
+			t.Fatalf("SelectQueuedTask returned PID %d with a pool count of 0", task.Pid)
+		}
+		selected = append(selected, *task)
+		if got := s.GetPoolCount(); got != count-1 {
+			t.Errorf("GetPoolCount = %d after selecting PID %d; want %d", got, task.Pid, count-1)
+			count = got + 1
+		}
+	}
+}
+
+// checkSelectedOnce checks that every task was selected exactly once
+func checkSelectedOnce(t *testing.T, tasks []*models.QueuedTask, selected []models.QueuedTask) {
+	t.Helper()
+	seen := make(map[int32]int, len(selected))
+	for _, task := range selected {
+		seen[task.Pid]++
+	}
+	for _, task := range tasks {
+		switch n := seen[task.Pid]; n {
+		case 0:
+			t.Errorf("PID %d was lost", task.Pid)
+		case 1:
+		default:
+			t.Errorf("PID %d was selected %d times", task.Pid, n)
+		}
+		delete(seen, task.Pid)
+	}
+	pids := make([]int32, 0, len(seen))
+	for pid := range seen {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	for _, pid := range pids {
+		t.Errorf("PID %d was selected but never queued", pid)
+	}
+}
+
+// checkEmptyPool checks that a new plugin has nothing to select
+func checkEmptyPool(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	sched := NewSched(nrCPUs)
+	if count := s.GetPoolCount(); count != 0 {
+		t.Errorf("GetPoolCount = %d; want 0", count)
+	}
+	if drained := s.DrainQueuedTask(sched); drained != 0 {
+		t.Errorf("DrainQueuedTask on an empty queue = %d; want 0", drained)
+	}
+	if task := s.SelectQueuedTask(sched); task != nil {
+		t.Errorf("SelectQueuedTask on an empty pool = PID %d; want nil", task.Pid)
+	}
+	if count := s.GetPoolCount(); count != 0 {
+		t.Errorf("GetPoolCount = %d; want 0", count)
+	}
+}
+
+// checkNoLossOrDuplication checks over several rounds that every drained task is selected
+// exactly once
+func checkNoLossOrDuplication(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	const (
+		nrTasks  = 7 // Odd, to catch tasks lost at the end of a batch
+		nrRounds = 4
+		ran      = 2 * 1000 * 1000
+	)
+	sched := NewSched(nrCPUs)
+	tasks := newTasks(100, nrTasks)
+	var now uint64 = 1
+	for round := 0; round < nrRounds; round++ {
+		sched.Enqueue(tasks...)
+		if drained := drainAll(t, s, sched); drained != nrTasks {
+			t.Errorf("Round %d: DrainQueuedTask reported %d tasks; want %d", round, drained, nrTasks)
+		}
+		if count := s.GetPoolCount(); count != nrTasks {
+			t.Errorf("Round %d: GetPoolCount = %d; want %d", round, count, nrTasks)
+		}
+		selected := selectAll(t, s, sched)
+		checkSelectedOnce(t, tasks, selected)
+
+		// Tasks come back having run, with the vtime the plugin set
+		byPid := make(map[int32]models.QueuedTask, len(selected))
+		for _, task := range selected {
+			byPid[task.Pid] = task
+		}
+		for i, task := range tasks {
+			task.Vtime = byPid[task.Pid].Vtime
+			task.Cpu = int32(i % nrCPUs)
+			task.StartTs = now
+			task.StopTs = now + ran
+			task.SumExecRuntime += ran
+		}
+		now += ran
+	}
+}
+
+// checkPoolCount checks the pool count while drains and selections interleave
+func checkPoolCount(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	sched := NewSched(nrCPUs)
+	var pool, next int
+	steps := []struct{ enqueue, selects int }{{5, 2}, {4, 3}, {0, 1}, {6, 0}, {1, 10}}
+	for i, step := range steps {
+		sched.Enqueue(newTasks(int32(100+next), step.enqueue)...)
+		next += step.enqueue
+		pool += drainAll(t, s, sched)
+		if count := s.GetPoolCount(); count != uint64(pool) {
+			t.Fatalf("Step %d: GetPoolCount = %d after draining; want %d", i, count, pool)
+		}
+		for j := 0; j < step.selects && pool > 0; j++ {
+			if task := s.SelectQueuedTask(sched); task == nil {
+				t.Fatalf("Step %d: SelectQueuedTask returned nil with %d tasks drained", i, pool)
+			}
+			pool--
+			if count := s.GetPoolCount(); count != uint64(pool) {
+				t.Fatalf("Step %d: GetPoolCount = %d after selecting; want %d", i, count, pool)
+			}
+		}
+	}
+	if task := s.SelectQueuedTask(sched); task != nil {
+		t.Errorf("SelectQueuedTask on an empty pool = PID %d; want nil", task.Pid)
+	}
+}
+
+// checkInvalidPIDs checks that tasks with the PIDs 0 and -1 are never selected and do not cost
+// the valid tasks queued around them
+func checkInvalidPIDs(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	sched := NewSched(nrCPUs)
+	valid := newTasks(100, 3)
+	sched.Enqueue(&models.QueuedTask{Pid: 0}, valid[0], valid[1])
+	sched.Enqueue(&models.QueuedTask{Pid: -1}, valid[2], &models.QueuedTask{Pid: 0})
+	drainAll(t, s, sched)
+
+	selected := selectAll(t, s, sched)
+	checkSelectedOnce(t, valid, selected)
+
+	// Calls with invalid tasks must not panic
+	for _, pid := range []int32{0, -1} {
+		invalid := &models.QueuedTask{Pid: pid, Cpu: -1}
+		s.DetermineTimeSlice(sched, invalid)
+		s.SelectCPU(sched, invalid)
+	}
+}
+
+// checkTimeSlice checks that selected tasks get a time slice of at most 1s, and at least the
+// configured minimum unless it is 0 for the default slice
+func checkTimeSlice(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	sched := NewSched(nrCPUs)
+	tasks := newTasks(100, 5)
+	sched.Enqueue(tasks...)
+	drainAll(t, s, sched)
+	for _, task := range tasks {
+		selected := s.SelectQueuedTask(sched)
+		if selected == nil {
+			t.Fatalf("SelectQueuedTask returned nil; want PID %d", task.Pid)
+		}
+		slice := s.DetermineTimeSlice(sched, selected)
+		if slice > maxSlice {
+			t.Errorf("PID %d has a time slice of %dns; want at most %dns", selected.Pid, slice, maxSlice)
+		}
+		if slice != 0 && slice < config.Scheduler.SliceNsMin {
+			t.Errorf("PID %d has a time slice of %dns; want at least %dns", selected.Pid, slice,
+				config.Scheduler.SliceNsMin)
+		}
+	}
+}
+
+// checkConcurrent drains batches of tasks while several goroutines select them, checking that
+// every task is selected exactly once
+func checkConcurrent(t *testing.T, s reg.CustomScheduler, config *reg.SchedConfig) {
+	const (
+		nrTasks     = 400
+		batchSize   = 10
+		nrSelectors = 4
+	)
+	sched := NewSched(nrCPUs)
+	tasks := newTasks(100, nrTasks)
+	deadline := time.Now().Add(concurrentTimeout)
+
+	var (
+		mu       sync.Mutex
+		selected []models.QueuedTask
+		wg       sync.WaitGroup
+	)
+	done := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(selected) >= nrTasks || time.Now().After(deadline)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < nrTasks; i += batchSize {
+			sched.Enqueue(tasks[i:min(i+batchSize, nrTasks)]...)
+			s.DrainQueuedTask(sched)
+		}
+		// Drain what a full pool left behind
+		for !done() {
+			if sched.GetNrQueued() > 0 {
+				s.DrainQueuedTask(sched)
+			}
+			runtime.Gosched()
+		}
+	}()
+	for i := 0; i < nrSelectors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done() {
+				s.GetPoolCount()
+				task := s.SelectQueuedTask(sched)
+				if task == nil {
+					runtime.Gosched()
+					continue
+				}
+				mu.Lock()
+				selected = append(selected, *task)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(selected) < nrTasks {
+		t.Errorf("%d of %d tasks selected within %v", len(selected), nrTasks, concurrentTimeout)
+	}
+	checkSelectedOnce(t, tasks, selected)
+	if count := s.GetPoolCount(); count != 0 {
+		t.Errorf("GetPoolCount = %d after every task was selected; want 0", count)
+	}
+}
@@ -0,0 +1,64 @@
+package plugintest
+
+import (
+	"sync"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+)
+
+// Sched is a Sched backed by a FIFO queue, safe for concurrent use
+type Sched struct {
+	nrCPUs int32
+
+	mu    sync.Mutex
+	queue []models.QueuedTask
+}
+
+// Verify that Sched implements the plugin.Sched interface
+var _ reg.Sched = (*Sched)(nil)
+
+// NewSched creates a Sched for a host with the given number of CPUs (1 if not positive)
+func NewSched(nrCPUs int) *Sched {
+	return &Sched{nrCPUs: int32(max(nrCPUs, 1))}
+}
+
+// Enqueue appends tasks to the queue, DequeueTask returns copies of them
+func (s *Sched) Enqueue(tasks ...*models.QueuedTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range tasks {
+		s.queue = append(s.queue, *task)
+	}
+}
+
+// DequeueTask implements plugin.Sched.DequeueTask, setting the PID to -1 when the queue is empty
+func (s *Sched) DequeueTask(task *models.QueuedTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		task.Pid = -1
+		return
+	}
+	*task = s.queue[0]
+	s.queue = s.queue[1:]
+}
+
+// DefaultSelectCPU implements plugin.Sched.DefaultSelectCPU: the previous CPU of the task if it is
+// valid, else a CPU derived from its PID
+func (s *Sched) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	if t.Cpu >= 0 && t.Cpu < s.nrCPUs {
+		return nil, t.Cpu
+	}
+	if t.Pid <= 0 {
+		return nil, 0
+	}
+	return nil, t.Pid % s.nrCPUs
+}
+
+// GetNrQueued implements plugin.Sched.GetNrQueued
+func (s *Sched) GetNrQueued() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint64(len(s.queue))
+}
@@ -0,0 +1,160 @@
+package replay
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// Recorder is a CustomScheduler that forwards every call to a plugin and records it. Only the
+// CustomScheduler methods are forwarded, other methods of the plugin, such as
+// UpdateStrategyMap, must be called on the plugin itself.
+type Recorder struct {
+	scheduler reg.CustomScheduler
+	now       func() uint64
+
+	mu  sync.Mutex // Protects enc and err
+	enc *json.Encoder
+	err error
+}
+
+// Verify that Recorder implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*Recorder)(nil)
+
+// NewRecorder creates a recorder forwarding calls to scheduler and writing them to w as JSON
+// lines. Callers wrapping w in a buffer must flush it once done.
+func NewRecorder(scheduler reg.CustomScheduler, w io.Writer) *Recorder {
+	return &Recorder{
+		scheduler: scheduler,
+		now:       util.Now,
+		enc:       json.NewEncoder(w),
+	}
+}
+
+// SetClock replaces the clock used to timestamp calls, and that of the plugin if it can be
+// replaced. Must be called before scheduling starts.
+func (r *Recorder) SetClock(now func() uint64) {
+	r.now = now
+	if clocked, ok := r.scheduler.(interface{ SetClock(func() uint64) }); ok {
+		clocked.SetClock(now)
+	}
+}
+
+// Err returns the first error writing the recording, calls are no longer recorded after it
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// DrainQueuedTask implements plugin.CustomScheduler.DrainQueuedTask
+func (r *Recorder) DrainQueuedTask(s reg.Sched) int {
+	call := Call{Time: r.now(), Op: OpDrain}
+	rs := &recordingSched{sched: s}
+	n := r.scheduler.DrainQueuedTask(rs)
+	call.Count = uint64(n)
+	call.Sched = rs.calls
+	r.write(&call)
+	return n
+}
+
+// SelectQueuedTask implements plugin.CustomScheduler.SelectQueuedTask
+func (r *Recorder) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	call := Call{Time: r.now(), Op: OpSelect}
+	rs := &recordingSched{sched: s}
+	task := r.scheduler.SelectQueuedTask(rs)
+	call.Task = copyTask(task)
+	call.Sched = rs.calls
+	r.write(&call)
+	return task
+}
+
+// SelectCPU implements plugin.CustomScheduler.SelectCPU
+func (r *Recorder) SelectCPU(s reg.Sched, t *models.QueuedTask) (error, int32) {
+	call := Call{Time: r.now(), Op: OpSelectCPU, Task: copyTask(t)}
+	rs := &recordingSched{sched: s}
+	err, cpu := r.scheduler.SelectCPU(rs, t)
+	call.CPU = cpu
+	call.Err = errString(err)
+	call.Sched = rs.calls
+	r.write(&call)
+	return err, cpu
+}
+
+// DetermineTimeSlice implements plugin.CustomScheduler.DetermineTimeSlice
+func (r *Recorder) DetermineTimeSlice(s reg.Sched, t *models.QueuedTask) uint64 {
+	call := Call{Time: r.now(), Op: OpTimeSlice, Task: copyTask(t)}
+	rs := &recordingSched{sched: s}
+	slice := r.scheduler.DetermineTimeSlice(rs, t)
+	call.Slice = slice
+	call.Sched = rs.calls
+	r.write(&call)
+	return slice
+}
+
+// GetPoolCount implements plugin.CustomScheduler.GetPoolCount
+func (r *Recorder) GetPoolCount() uint64 {
+	call := Call{Time: r.now(), Op: OpPoolCount}
+	call.Count = r.scheduler.GetPoolCount()
+	r.write(&call)
+	return call.Count
+}
+
+// SendMetrics implements plugin.CustomScheduler.SendMetrics, it is not recorded
+func (r *Recorder) SendMetrics(data interface{}) {
+	r.scheduler.SendMetrics(data)
+}
+
+// GetChangedStrategies implements plugin.CustomScheduler.GetChangedStrategies, it is not recorded
+func (r *Recorder) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return r.scheduler.GetChangedStrategies()
+}
+
+// write appends a call to the recording
+func (r *Recorder) write(call *Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(call)
+}
+
+// recordingSched records the Sched calls made by the plugin during one call
+type recordingSched struct {
+	sched reg.Sched
+	calls []SchedCall
+}
+
+func (s *recordingSched) DequeueTask(task *models.QueuedTask) {
+	s.sched.DequeueTask(task)
+	s.calls = append(s.calls, SchedCall{Op: OpDequeue, Task: copyTask(task)})
+}
+
+func (s *recordingSched) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	call := SchedCall{Op: OpDefaultSelectCPU, Task: copyTask(t)}
+	err, cpu := s.sched.DefaultSelectCPU(t)
+	call.CPU = cpu
+	call.Err = errString(err)
+	s.calls = append(s.calls, call)
+	return err, cpu
+}
+
+func (s *recordingSched) GetNrQueued() uint64 {
+	n := s.sched.GetNrQueued()
+	s.calls = append(s.calls, SchedCall{Op: OpNrQueued, NrQueued: n})
+	return n
+}
+
+// copyTask returns a copy of a task that later changes do not affect, or nil
+func copyTask(task *models.QueuedTask) *models.QueuedTask {
+	if task == nil {
+		return nil
+	}
+	c := *task
+	return &c
+}
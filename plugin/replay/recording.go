@@ -0,0 +1,90 @@
+// Package replay records what a plugin sees and decides in production and replays recordings into
+// any plugin to find the decisions that changed.
+//
+// A Recorder wraps a plugin: every CustomScheduler call is written as one JSON line holding the
+// call, its result and the Sched calls the plugin made while handling it, such as the tasks
+// returned by DequeueTask and the answers of DefaultSelectCPU. Replay calls another plugin with
+// the same arguments, answers its Sched calls from the recording and reports every result that
+// differs.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// Op is a recorded call
+type Op string
+
+const (
+	// Plugin calls
+	OpDrain     Op = "drain"
+	OpSelect    Op = "select"
+	OpTimeSlice Op = "time_slice"
+	OpSelectCPU Op = "select_cpu"
+	OpPoolCount Op = "pool_count"
+
+	// Sched calls made by the plugin
+	OpDequeue          Op = "dequeue"
+	OpDefaultSelectCPU Op = "default_select_cpu"
+	OpNrQueued         Op = "nr_queued"
+)
+
+// Call is a recorded plugin call
+type Call struct {
+	// Time is when the call was made, in nanoseconds
+	Time uint64 `json:"time"`
+	Op   Op     `json:"op"`
+	// Task is the argument of DetermineTimeSlice and SelectCPU, or the task returned by
+	// SelectQueuedTask
+	Task *models.QueuedTask `json:"task,omitempty"`
+
+	// Results, depending on the call
+	Count uint64 `json:"count,omitempty"` // Tasks drained, or the pool count
+	Slice uint64 `json:"slice,omitempty"`
+	CPU   int32  `json:"cpu,omitempty"`
+	Err   string `json:"err,omitempty"`
+
+	// Sched holds the Sched calls made by the plugin during the call, in order
+	Sched []SchedCall `json:"sched,omitempty"`
+}
+
+// SchedCall is a recorded Sched call
+type SchedCall struct {
+	Op Op `json:"op"`
+	// Task is the task returned by DequeueTask, or the argument of DefaultSelectCPU
+	Task *models.QueuedTask `json:"task,omitempty"`
+	// CPU and Err are the answer of DefaultSelectCPU
+	CPU int32  `json:"cpu,omitempty"`
+	Err string `json:"err,omitempty"`
+	// NrQueued is the answer of GetNrQueued
+	NrQueued uint64 `json:"nr_queued,omitempty"`
+}
+
+// ReadRecording reads the calls of a recording
+func ReadRecording(r io.Reader) ([]Call, error) {
+	var calls []Call
+	dec := json.NewDecoder(r)
+	for {
+		var call Call
+		err := dec.Decode(&call)
+		if err == io.EOF {
+			return calls, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", len(calls), err)
+		}
+		calls = append(calls, call)
+	}
+}
+
+// errString returns the message of an error, or "" if it is nil
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,259 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+)
+
+// Diff is a call whose result differs from the recording
+type Diff struct {
+	// Index is the index of the call in the recording
+	Index int
+	Op    Op
+	// Pid is the PID of the task of the call in the recording, 0 if there is none
+	Pid  int32
+	Want string
+	Got  string
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("call %d %s (PID %d): want %s, got %s", d.Index, d.Op, d.Pid, d.Want, d.Got)
+}
+
+// Replay makes the recorded calls on scheduler and returns the results that differ from the
+// recording. The Sched calls of the plugin are answered from those recorded during the same call,
+// and plugins whose clock can be replaced see the recorded time. The recorded arguments are used
+// even after the plugin made a different decision, so only the first diff is guaranteed to come
+// from a difference in behavior rather than in state.
+func Replay(scheduler reg.CustomScheduler, calls []Call) []Diff {
+	var now uint64
+	if clocked, ok := scheduler.(interface{ SetClock(func() uint64) }); ok {
+		clocked.SetClock(func() uint64 { return now })
+	}
+
+	var diffs []Diff
+	for i, call := range calls {
+		now = call.Time
+		s := newReplaySched(call.Sched)
+		want, got := "", ""
+		switch call.Op {
+		case OpDrain:
+			want = fmt.Sprintf("%d tasks", call.Count)
+			got = fmt.Sprintf("%d tasks", scheduler.DrainQueuedTask(s))
+		case OpSelect:
+			want, got = diffTasks(call.Task, scheduler.SelectQueuedTask(s))
+		case OpTimeSlice:
+			want = fmt.Sprintf("%dns", call.Slice)
+			got = fmt.Sprintf("%dns", scheduler.DetermineTimeSlice(s, copyTask(call.Task)))
+		case OpSelectCPU:
+			want = describeCPU(call.Err, call.CPU)
+			err, cpu := scheduler.SelectCPU(s, copyTask(call.Task))
+			got = describeCPU(errString(err), cpu)
+		case OpPoolCount:
+			want = fmt.Sprintf("%d tasks", call.Count)
+			got = fmt.Sprintf("%d tasks", scheduler.GetPoolCount())
+		default:
+			continue
+		}
+		if want != got {
+			diff := Diff{Index: i, Op: call.Op, Want: want, Got: got}
+			if call.Task != nil {
+				diff.Pid = call.Task.Pid
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// ReplayMode creates the plugin of a registered mode and replays the recorded calls on it. The
+// filesystems of config.Host left nil are replaced by those of FakeHost with the CPUs seen in the
+// recording, so that the plugin does not inspect the machine running the replay.
+func ReplayMode(ctx context.Context, config *reg.SchedConfig, calls []Call) ([]Diff, error) {
+	replayConfig := *config
+	fake := FakeHost(RecordedCPUs(calls))
+	if replayConfig.Host.SysfsCPU == nil {
+		replayConfig.Host.SysfsCPU = fake.SysfsCPU
+	}
+	if replayConfig.Host.Proc == nil {
+		replayConfig.Host.Proc = fake.Proc
+	}
+	if replayConfig.Host.Cgroupfs == nil {
+		replayConfig.Host.Cgroupfs = fake.Cgroupfs
+	}
+
+	scheduler, err := plugin.NewSchedulerPlugin(ctx, &replayConfig)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(scheduler, calls), nil
+}
+
+// FakeHost returns a host with nrCPUs online CPUs, each a core of its own, sharing one LLC and
+// NUMA node. Its tasks have no known affinity and belong to no cgroup.
+func FakeHost(nrCPUs int) reg.Host {
+	nrCPUs = max(nrCPUs, 1)
+	all := "0-" + strconv.Itoa(nrCPUs-1)
+	sysfs := fstest.MapFS{
+		"online": &fstest.MapFile{Data: []byte(all + "\n")},
+	}
+	for cpu := 0; cpu < nrCPUs; cpu++ {
+		dir := "cpu" + strconv.Itoa(cpu)
+		sysfs[dir+"/topology/thread_siblings_list"] = &fstest.MapFile{Data: []byte(strconv.Itoa(cpu))}
+		sysfs[dir+"/node0/cpulist"] = &fstest.MapFile{Data: []byte(all)}
+		sysfs[dir+"/cache/index3/level"] = &fstest.MapFile{Data: []byte("3")}
+		sysfs[dir+"/cache/index3/shared_cpu_list"] = &fstest.MapFile{Data: []byte(all)}
+	}
+	return reg.Host{SysfsCPU: sysfs, Proc: fstest.MapFS{}, Cgroupfs: fstest.MapFS{}}
+}
+
+// RecordedCPUs returns the number of CPUs needed to hold every CPU named in a recording
+func RecordedCPUs(calls []Call) int {
+	highest := int32(0)
+	see := func(task *models.QueuedTask, cpu int32) {
+		if task != nil {
+			highest = max(highest, task.Cpu)
+		}
+		highest = max(highest, cpu)
+	}
+	for _, call := range calls {
+		cpu := call.CPU
+		if cpu >= 1<<16 {
+			cpu = 0 // Plugins answer SelectCPU with a value such as 1<<20 to let the kernel pick
+		}
+		see(call.Task, cpu)
+		for _, sc := range call.Sched {
+			see(sc.Task, sc.CPU)
+		}
+	}
+	return int(highest) + 1
+}
+
+// taskFields are the fields of a task compared by replay
+var taskFields = []struct {
+	name  string
+	value func(t *models.QueuedTask) any
+}{
+	{"Pid", func(t *models.QueuedTask) any { return t.Pid }},
+	{"Cpu", func(t *models.QueuedTask) any { return t.Cpu }},
+	{"NrCpusAllowed", func(t *models.QueuedTask) any { return t.NrCpusAllowed }},
+	{"Flags", func(t *models.QueuedTask) any { return t.Flags }},
+	{"StartTs", func(t *models.QueuedTask) any { return t.StartTs }},
+	{"StopTs", func(t *models.QueuedTask) any { return t.StopTs }},
+	{"SumExecRuntime", func(t *models.QueuedTask) any { return t.SumExecRuntime }},
+	{"Weight", func(t *models.QueuedTask) any { return t.Weight }},
+	{"Vtime", func(t *models.QueuedTask) any { return t.Vtime }},
+	{"Tgid", func(t *models.QueuedTask) any { return t.Tgid }},
+}
+
+// diffTasks describes the fields that differ between the recorded task and the one selected by
+// a plugin, both descriptions are empty when the tasks are the same
+func diffTasks(want, got *models.QueuedTask) (string, string) {
+	if want == nil || got == nil {
+		if want == nil && got == nil {
+			return "", ""
+		}
+		return describeTask(want), describeTask(got)
+	}
+	var wantFields, gotFields []string
+	for _, field := range taskFields {
+		w, g := field.value(want), field.value(got)
+		if w != g {
+			wantFields = append(wantFields, fmt.Sprintf("%s %v", field.name, w))
+			gotFields = append(gotFields, fmt.Sprintf("%s %v", field.name, g))
+		}
+	}
+	if len(wantFields) == 0 {
+		return "", ""
+	}
+	// Name the task when its PID is not among the differences
+	if want.Pid == got.Pid {
+		return fmt.Sprintf("PID %d with %s", want.Pid, strings.Join(wantFields, ", ")),
+			fmt.Sprintf("PID %d with %s", got.Pid, strings.Join(gotFields, ", "))
+	}
+	return strings.Join(wantFields, ", "), strings.Join(gotFields, ", ")
+}
+
+// describeTask describes a task selected by a plugin
+func describeTask(task *models.QueuedTask) string {
+	if task == nil {
+		return "no task"
+	}
+	return fmt.Sprintf("PID %d", task.Pid)
+}
+
+// describeCPU describes a CPU selected by a plugin
+func describeCPU(err string, cpu int32) string {
+	if err != "" {
+		return fmt.Sprintf("error %q", err)
+	}
+	return fmt.Sprintf("CPU %d", cpu)
+}
+
+// replaySched answers the Sched calls of a plugin from those recorded during the same call
+type replaySched struct {
+	dequeued []*models.QueuedTask
+	nrQueued []uint64
+	selected []SchedCall
+}
+
+func newReplaySched(calls []SchedCall) *replaySched {
+	s := &replaySched{}
+	for _, call := range calls {
+		switch call.Op {
+		case OpDequeue:
+			if call.Task != nil && call.Task.Pid > 0 {
+				s.dequeued = append(s.dequeued, call.Task)
+			}
+		case OpNrQueued:
+			s.nrQueued = append(s.nrQueued, call.NrQueued)
+		case OpDefaultSelectCPU:
+			s.selected = append(s.selected, call)
+		}
+	}
+	return s
+}
+
+// DequeueTask returns the recorded tasks in order, then sets the PID to -1
+func (s *replaySched) DequeueTask(task *models.QueuedTask) {
+	if len(s.dequeued) == 0 {
+		task.Pid = -1
+		return
+	}
+	*task = *s.dequeued[0]
+	s.dequeued = s.dequeued[1:]
+}
+
+// DefaultSelectCPU returns the first unused answer recorded for the PID, or the previous CPU of
+// the task if there is none
+func (s *replaySched) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	for i, call := range s.selected {
+		if call.Task == nil || call.Task.Pid != t.Pid {
+			continue
+		}
+		s.selected = append(s.selected[:i], s.selected[i+1:]...)
+		if call.Err != "" {
+			return errors.New(call.Err), call.CPU
+		}
+		return nil, call.CPU
+	}
+	return nil, t.Cpu
+}
+
+// GetNrQueued returns the recorded answers in order, then the number of tasks left to dequeue
+func (s *replaySched) GetNrQueued() uint64 {
+	if len(s.nrQueued) == 0 {
+		return uint64(len(s.dequeued))
+	}
+	n := s.nrQueued[0]
+	s.nrQueued = s.nrQueued[1:]
+	return n
+}
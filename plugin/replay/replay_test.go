@@ -0,0 +1,237 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin"
+	"github.com/Gthulhu/plugin/plugin/baseline"
+	"github.com/Gthulhu/plugin/plugin/eevdf"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/sim"
+)
+
+const ms = 1000 * 1000
+
+// simulate runs a mix of tasks on two CPUs under scheduler
+func simulate(t *testing.T, scheduler reg.CustomScheduler) *sim.Report {
+	t.Helper()
+	s := sim.New(scheduler, sim.Config{NrCPUs: 2})
+	for _, spec := range []sim.TaskSpec{
+		{Pid: 1, Model: sim.CPUBound()},
+		{Pid: 2, Weight: 300, Model: sim.CPUBound()},
+		{Pid: 3, Model: sim.IOBound(500*1000, 3*ms)},
+		{Pid: 4, Model: sim.Periodic(2*ms, 16*ms), Delay: 7 * ms},
+	} {
+		if err := s.AddTask(spec); err != nil {
+			t.Fatalf("AddTask: %v", err)
+		}
+	}
+	report, err := s.Run(100 * ms)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return report
+}
+
+// record simulates scheduler wrapped in a recorder and returns the recording
+func record(t *testing.T, scheduler reg.CustomScheduler) []Call {
+	t.Helper()
+	var buf bytes.Buffer
+	recorder := NewRecorder(scheduler, &buf)
+	simulate(t, recorder)
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("Recording failed: %v", err)
+	}
+	calls, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecording: %v", err)
+	}
+	return calls
+}
+
+// TestRecorderTransparent verifies that recording does not change the decisions of the plugin
+func TestRecorderTransparent(t *testing.T) {
+	want := simulate(t, eevdf.NewEEVDFPlugin(0))
+	got := simulate(t, NewRecorder(eevdf.NewEEVDFPlugin(0), &bytes.Buffer{}))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Report with recorder = %+v; want %+v", got, want)
+	}
+}
+
+// TestRecording verifies that every kind of call is recorded with the Sched calls made during it
+func TestRecording(t *testing.T) {
+	calls := record(t, eevdf.NewEEVDFPlugin(0))
+
+	ops := make(map[Op]int)
+	var dequeued int
+	for i, call := range calls {
+		ops[call.Op]++
+		if i > 0 && call.Time < calls[i-1].Time {
+			t.Errorf("Call %d at %d before call %d at %d", i, call.Time, i-1, calls[i-1].Time)
+		}
+		for _, sc := range call.Sched {
+			if sc.Op == OpDequeue && sc.Task.Pid > 0 {
+				dequeued++
+			}
+		}
+	}
+	for _, op := range []Op{OpDrain, OpSelect, OpTimeSlice, OpSelectCPU} {
+		if ops[op] == 0 {
+			t.Errorf("No %s call recorded", op)
+		}
+	}
+	if dequeued < ops[OpTimeSlice] {
+		t.Errorf("%d tasks dequeued; want at least one per dispatch (%d)", dequeued, ops[OpTimeSlice])
+	}
+}
+
+// TestReplaySamePlugin verifies that replaying a recording into the recorded plugin shows no
+// difference
+func TestReplaySamePlugin(t *testing.T) {
+	calls := record(t, eevdf.NewEEVDFPlugin(0))
+	if diffs := Replay(eevdf.NewEEVDFPlugin(0), calls); len(diffs) != 0 {
+		t.Errorf("Replay found %d diffs, first %v; want none", len(diffs), diffs[0])
+	}
+}
+
+// TestReplayOtherPlugin verifies that replaying a recording into another plugin shows the
+// decisions that changed
+func TestReplayOtherPlugin(t *testing.T) {
+	calls := record(t, eevdf.NewEEVDFPlugin(0))
+	diffs := Replay(baseline.NewBaselinePlugin(baseline.PolicyRR), calls)
+	if len(diffs) == 0 {
+		t.Fatal("Replay found no diffs between EEVDF and round-robin")
+	}
+	first := diffs[0]
+	if calls[first.Index].Op != first.Op || first.Want == first.Got {
+		t.Errorf("First diff %v does not match call %+v", first, calls[first.Index])
+	}
+	if !strings.Contains(first.String(), first.Want) {
+		t.Errorf("Diff.String() = %q; want it to show %q", first.String(), first.Want)
+	}
+}
+
+// TestReplayMode verifies replaying into a plugin created from a registered mode
+func TestReplayMode(t *testing.T) {
+	config := &reg.SchedConfig{Mode: "rr"}
+	scheduler, err := plugin.NewSchedulerPlugin(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin: %v", err)
+	}
+	calls := record(t, scheduler)
+
+	diffs, err := ReplayMode(context.Background(), config, calls)
+	if err != nil {
+		t.Fatalf("ReplayMode: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Replay found %d diffs, first %v; want none", len(diffs), diffs[0])
+	}
+
+	if _, err := ReplayMode(context.Background(), &reg.SchedConfig{Mode: "unknown"}, calls); err == nil {
+		t.Error("ReplayMode succeeded with an unknown mode")
+	}
+}
+
+// TestReplayModeFakeHost verifies that plugins inspecting the host replay the same decisions on
+// the fake host built from the recording, whatever the machine running the replay
+func TestReplayModeFakeHost(t *testing.T) {
+	for _, mode := range []string{"gthulhu", "energy", "simple"} {
+		t.Run(mode, func(t *testing.T) {
+			config := &reg.SchedConfig{Mode: mode, Host: FakeHost(2)}
+			scheduler, err := plugin.NewSchedulerPlugin(context.Background(), config)
+			if err != nil {
+				t.Fatalf("NewSchedulerPlugin: %v", err)
+			}
+			calls := record(t, scheduler)
+			if n := RecordedCPUs(calls); n != 2 {
+				t.Errorf("RecordedCPUs = %d; want 2", n)
+			}
+
+			diffs, err := ReplayMode(context.Background(), &reg.SchedConfig{Mode: mode}, calls)
+			if err != nil {
+				t.Fatalf("ReplayMode: %v", err)
+			}
+			if len(diffs) != 0 {
+				t.Errorf("Replay found %d diffs, first %v; want none", len(diffs), diffs[0])
+			}
+		})
+	}
+}
+
+// TestDiffTasks verifies that selected tasks are compared field by field
+func TestDiffTasks(t *testing.T) {
+	task := &models.QueuedTask{Pid: 1, Cpu: 2, Weight: 100, Vtime: 5000}
+	tests := []struct {
+		name      string
+		want, got *models.QueuedTask
+		wantDesc  string
+		gotDesc   string
+	}{
+		{name: "Same", want: task, got: &models.QueuedTask{Pid: 1, Cpu: 2, Weight: 100, Vtime: 5000}},
+		{name: "NoTask", want: nil, got: nil},
+		{name: "Missing", want: task, got: nil, wantDesc: "PID 1", gotDesc: "no task"},
+		{
+			name: "OtherTask", want: task, got: &models.QueuedTask{Pid: 3, Cpu: 2, Weight: 100, Vtime: 6000},
+			wantDesc: "Pid 1, Vtime 5000", gotDesc: "Pid 3, Vtime 6000",
+		},
+		{
+			name: "SameTaskOtherFields", want: task, got: &models.QueuedTask{Pid: 1, Cpu: 0, Weight: 100, Vtime: 5000},
+			wantDesc: "PID 1 with Cpu 2", gotDesc: "PID 1 with Cpu 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, got := diffTasks(tt.want, tt.got)
+			if want != tt.wantDesc || got != tt.gotDesc {
+				t.Errorf("diffTasks = %q, %q; want %q, %q", want, got, tt.wantDesc, tt.gotDesc)
+			}
+		})
+	}
+}
+
+// TestReplaySched verifies that Sched calls are answered from the recording
+func TestReplaySched(t *testing.T) {
+	s := newReplaySched([]SchedCall{
+		{Op: OpDequeue, Task: &models.QueuedTask{Pid: 1, Cpu: 2}},
+		{Op: OpDefaultSelectCPU, Task: &models.QueuedTask{Pid: 1}, CPU: 3},
+		{Op: OpDequeue, Task: &models.QueuedTask{Pid: 2, Cpu: 1}},
+		{Op: OpDefaultSelectCPU, Task: &models.QueuedTask{Pid: 2}, Err: "no CPU"},
+		{Op: OpDequeue, Task: &models.QueuedTask{Pid: -1}},
+	})
+
+	if n := s.GetNrQueued(); n != 2 {
+		t.Errorf("GetNrQueued() = %d; want 2", n)
+	}
+	var first, second, empty models.QueuedTask
+	s.DequeueTask(&first)
+	s.DequeueTask(&second)
+	s.DequeueTask(&empty)
+	if first.Pid != 1 || second.Pid != 2 || empty.Pid != -1 {
+		t.Errorf("Dequeued PIDs %d, %d, %d; want 1, 2, -1", first.Pid, second.Pid, empty.Pid)
+	}
+
+	// Answers are matched by PID, then the previous CPU is used
+	if err, cpu := s.DefaultSelectCPU(&second); err == nil || err.Error() != "no CPU" {
+		t.Errorf("DefaultSelectCPU(PID 2) = %v, %d; want the recorded error", err, cpu)
+	}
+	if err, cpu := s.DefaultSelectCPU(&first); err != nil || cpu != 3 {
+		t.Errorf("DefaultSelectCPU(PID 1) = %v, %d; want CPU 3", err, cpu)
+	}
+	if err, cpu := s.DefaultSelectCPU(&first); err != nil || cpu != 2 {
+		t.Errorf("DefaultSelectCPU(PID 1) again = %v, %d; want previous CPU 2", err, cpu)
+	}
+}
+
+// TestReadRecordingInvalid verifies that malformed recordings are rejected
+func TestReadRecordingInvalid(t *testing.T) {
+	_, err := ReadRecording(strings.NewReader("{\"op\":\"drain\"}\n{\"op\":"))
+	if err == nil || !strings.Contains(err.Error(), "call 1") {
+		t.Errorf("ReadRecording error = %v; want an error at call 1", err)
+	}
+}
@@ -0,0 +1,23 @@
+package share
+
+// drawLottery removes and returns the client holding a ticket drawn uniformly among the tickets of
+// the queued clients, the queue must not be empty. Must be called with mu held.
+func (s *SharePlugin) drawLottery() *client {
+	winner := uint64(s.rng.Int63n(int64(s.totalTickets)))
+	idx := len(s.clients) - 1
+	for i, c := range s.clients {
+		if winner < c.tickets {
+			idx = i
+			break
+		}
+		winner -= c.tickets
+	}
+
+	// Order does not matter to the draw, the last client fills the hole
+	c := s.clients[idx]
+	last := len(s.clients) - 1
+	s.clients[idx] = s.clients[last]
+	s.clients[last] = nil
+	s.clients = s.clients[:last]
+	return c
+}
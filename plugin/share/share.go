@@ -0,0 +1,281 @@
+// Package share implements proportional-share schedulers for experiments and teaching: lottery
+// scheduling, where each dispatch is a random draw weighted by the tickets of the queued tasks, and
+// its deterministic counterpart, stride scheduling. Tickets come from the weight of a task, or from
+// its scheduling strategy so that the API can reassign shares at runtime.
+package share
+
+import (
+	"context"
+	"io/fs"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/internal/strategyapi"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+func init() {
+	// Register the lottery plugin
+	err := reg.RegisterNewPlugin("lottery", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		return newFromConfig(ctx, PolicyLottery, config)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Register the stride plugin
+	err = reg.RegisterNewPlugin("stride", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
+		return newFromConfig(ctx, PolicyStride, config)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newFromConfig creates a SharePlugin with the given policy and the quantum and seed of the config,
+// following the tickets of the API strategies when the API is enabled
+func newFromConfig(ctx context.Context, policy Policy, config *reg.SchedConfig) (*SharePlugin, error) {
+	sharePlugin := newSharePlugin(policy, config.Scheduler.LotterySeed, reg.HostFS(config.Host.Proc, affinity.ProcPath))
+	if config.Scheduler.SliceNsDefault > 0 {
+		sharePlugin.SetQuantum(config.Scheduler.SliceNsDefault)
+	}
+	if config.Scheduler.TaskStateSweepInterval > 0 {
+		sharePlugin.passes.StartSweeper(ctx, time.Duration(config.Scheduler.TaskStateSweepInterval)*time.Second)
+	}
+	if err := strategyapi.Start(ctx, config.APIConfig, sharePlugin.UpdateStrategyMap); err != nil {
+		return nil, err
+	}
+	return sharePlugin, nil
+}
+
+// Policy selects how the share plugin picks the next task
+type Policy int
+
+const (
+	// PolicyLottery dispatches the winner of a random draw over the tickets of the queued tasks
+	PolicyLottery Policy = iota
+	// PolicyStride dispatches the task with the smallest pass, which advances by the time the
+	// task ran divided by its tickets
+	PolicyStride
+)
+
+const (
+	quantumDefault = 5000 * 1000 // 5ms in nanoseconds
+	ticketsDefault = 100         // Tickets of a nice 0 task without strategy
+	ticketsMax     = 1 << 20     // Tickets of a task are capped so that the total of a draw fits an int63
+	cpuAny         = 1 << 20     // Let the kernel pick any CPU
+)
+
+// client is a queued task with its share
+type client struct {
+	task    *models.QueuedTask
+	tickets uint64
+	pass    uint64
+}
+
+// SharePlugin implements the lottery and stride policies
+type SharePlugin struct {
+	policy Policy
+
+	// Protects everything below except the strategy tickets
+	mu      sync.Mutex
+	quantum uint64
+	rng     *rand.Rand
+
+	// Queued clients, in no particular order for lottery and ordered by pass for stride
+	clients      []*client
+	strideQueue  queue.Heap[*client, byPass]
+	totalTickets uint64
+
+	// Pass of the last client dispatched by stride, clients joining start no earlier so that
+	// they cannot bank credit while they sleep
+	globalPass uint64
+	passes     *taskstate.Table[uint64]
+	now        func() uint64
+
+	// Per-PID tickets set by strategies
+	strategyMu sync.RWMutex
+	tickets    map[int32]uint64
+
+	nrDispatched uint64
+}
+
+// Verify that SharePlugin implements the plugin.CustomScheduler interface
+var _ reg.CustomScheduler = (*SharePlugin)(nil)
+
+// NewSharePlugin creates a new SharePlugin with the given policy. The seed drives the draws of the
+// lottery policy, 0 seeds it from the clock.
+func NewSharePlugin(policy Policy, seed int64) *SharePlugin {
+	return newSharePlugin(policy, seed, os.DirFS(affinity.ProcPath))
+}
+
+// newSharePlugin creates a plugin detecting exited tasks through the given /proc filesystem
+func newSharePlugin(policy Policy, seed int64, procFS fs.FS) *SharePlugin {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &SharePlugin{
+		policy:  policy,
+		quantum: quantumDefault,
+		rng:     rand.New(rand.NewSource(seed)),
+		tickets: make(map[int32]uint64),
+		now:     util.Now,
+	}
+	s.passes = taskstate.New[uint64](taskstate.Options{
+		Now:    func() uint64 { return s.now() },
+		ProcFS: procFS,
+	})
+	return s
+}
+
+// SetClock replaces the clock used for per-task state, it must be called before scheduling starts
+func (s *SharePlugin) SetClock(now func() uint64) {
+	s.now = now
+}
+
+// SetQuantum sets the time slice of every task
+func (s *SharePlugin) SetQuantum(quantum uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quantum = quantum
+}
+
+// GetQuantum returns the time slice of every task
+func (s *SharePlugin) GetQuantum() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quantum
+}
+
+// GetPolicy returns the policy of the plugin
+func (s *SharePlugin) GetPolicy() Policy {
+	return s.policy
+}
+
+// UpdateStrategyMap sets the tickets of the PIDs whose strategy has tickets. The new shares apply
+// from the next time the tasks are queued.
+func (s *SharePlugin) UpdateStrategyMap(strategies []util.SchedulingStrategy) {
+	tickets := make(map[int32]uint64)
+	for _, strategy := range strategies {
+		if strategy.Tickets > 0 && !strategy.IsModeSwitch() {
+			tickets[int32(strategy.PID)] = min(strategy.Tickets, ticketsMax)
+		}
+	}
+	s.strategyMu.Lock()
+	s.tickets = tickets
+	s.strategyMu.Unlock()
+}
+
+// ticketsOf returns the tickets of a task: those of its strategy, else its weight, at most ticketsMax
+func (s *SharePlugin) ticketsOf(task *models.QueuedTask) uint64 {
+	s.strategyMu.RLock()
+	tickets, ok := s.tickets[task.Pid]
+	s.strategyMu.RUnlock()
+	if ok {
+		return tickets
+	}
+	if task.Weight > 0 {
+		return min(task.Weight, ticketsMax)
+	}
+	return ticketsDefault
+}
+
+// DrainQueuedTask drains tasks from the scheduler queue
+func (s *SharePlugin) DrainQueuedTask(sched reg.Sched) int {
+	count := 0
+	for {
+		task := &models.QueuedTask{}
+		sched.DequeueTask(task)
+		if task.Pid <= 0 {
+			return count
+		}
+
+		c := &client{task: task, tickets: s.ticketsOf(task)}
+		s.mu.Lock()
+		if s.policy == PolicyStride {
+			s.pushStride(c)
+		} else {
+			s.clients = append(s.clients, c)
+		}
+		s.totalTickets += c.tickets
+		s.mu.Unlock()
+		count++
+	}
+}
+
+// SelectQueuedTask returns the winner of the lottery or the task with the smallest pass
+func (s *SharePlugin) SelectQueuedTask(sched reg.Sched) *models.QueuedTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queued() == 0 {
+		return nil
+	}
+
+	var c *client
+	if s.policy == PolicyStride {
+		c = s.popStride()
+	} else {
+		c = s.drawLottery()
+	}
+	s.totalTickets -= c.tickets
+	s.nrDispatched++
+	return c.task
+}
+
+// SelectCPU lets the kernel pick any CPU
+func (s *SharePlugin) SelectCPU(sched reg.Sched, t *models.QueuedTask) (error, int32) {
+	return nil, cpuAny
+}
+
+// DetermineTimeSlice returns the quantum
+func (s *SharePlugin) DetermineTimeSlice(sched reg.Sched, t *models.QueuedTask) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quantum
+}
+
+// GetPoolCount returns the number of queued tasks
+func (s *SharePlugin) GetPoolCount() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint64(s.queued())
+}
+
+// queued returns the number of queued clients. Must be called with mu held.
+func (s *SharePlugin) queued() int {
+	return len(s.clients) + s.strideQueue.Len()
+}
+
+// Stats holds the counters of the plugin
+type Stats struct {
+	Queued        int
+	QueuedTickets uint64
+	NrDispatched  uint64
+	// GlobalPass is the pass of the last task dispatched by stride
+	GlobalPass uint64
+}
+
+// GetStats returns the counters of the plugin
+func (s *SharePlugin) GetStats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Queued:        s.queued(),
+		QueuedTickets: s.totalTickets,
+		NrDispatched:  s.nrDispatched,
+		GlobalPass:    s.globalPass,
+	}
+}
+
+func (s *SharePlugin) SendMetrics(data interface{}) {}
+
+func (s *SharePlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
+	return nil, nil
+}
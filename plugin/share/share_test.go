@@ -0,0 +1,255 @@
+package share
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// newSched queues a task per weight, with PIDs starting at 100
+func newSched(weights ...uint64) *plugintest.Sched {
+	sched := plugintest.NewSched(1)
+	for i, weight := range weights {
+		sched.Enqueue(&models.QueuedTask{Pid: int32(100 + i), Weight: weight})
+	}
+	return sched
+}
+
+// runShares dispatches rounds CPU-bound tasks that each run for the quantum and returns the CPU
+// time received by each PID
+func runShares(t *testing.T, s *SharePlugin, sched *plugintest.Sched, rounds int) map[int32]uint64 {
+	t.Helper()
+	var clock uint64
+	service := make(map[int32]uint64)
+	for i := 0; i < rounds; i++ {
+		s.DrainQueuedTask(sched)
+		task := s.SelectQueuedTask(sched)
+		if task == nil {
+			t.Fatal("SelectQueuedTask returned nil")
+		}
+		task.StartTs = clock
+		clock += s.DetermineTimeSlice(sched, task)
+		task.StopTs = clock
+		service[task.Pid] += task.StopTs - task.StartTs
+		sched.Enqueue(task)
+	}
+	return service
+}
+
+// shareError returns the largest relative error between the CPU time of each task and its share
+// of the tickets
+func shareError(service map[int32]uint64, tickets ...uint64) float64 {
+	var totalTime, totalTickets uint64
+	for _, ran := range service {
+		totalTime += ran
+	}
+	for _, n := range tickets {
+		totalTickets += n
+	}
+	worst := 0.0
+	for i, n := range tickets {
+		ideal := float64(totalTime) * float64(n) / float64(totalTickets)
+		worst = math.Max(worst, math.Abs(float64(service[int32(100+i)])-ideal)/ideal)
+	}
+	return worst
+}
+
+// TestShareAccuracy verifies that both policies give each task its share of the CPU
+func TestShareAccuracy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		tolerance float64
+	}{
+		// Over 20000 draws the standard deviation of the smallest share is about 2%
+		{name: "Lottery", policy: PolicyLottery, tolerance: 0.05},
+		// Stride is off by at most one quantum per task
+		{name: "Stride", policy: PolicyStride, tolerance: 0.001},
+	}
+
+	weights := []uint64{100, 200, 300, 400}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSharePlugin(tt.policy, 42)
+			service := runShares(t, s, newSched(weights...), 20000)
+			err := shareError(service, weights...)
+			t.Logf("Largest share error: %.3f%%", err*100)
+			if err > tt.tolerance {
+				t.Errorf("Share error = %.3f; want at most %.3f", err, tt.tolerance)
+			}
+		})
+	}
+}
+
+// TestStrideShortTermAccuracy verifies that stride keeps every task within one quantum of its
+// share after each round of dispatches
+func TestStrideShortTermAccuracy(t *testing.T) {
+	weights := []uint64{100, 300, 600}
+	for rounds := 10; rounds <= 200; rounds += 10 {
+		service := runShares(t, NewSharePlugin(PolicyStride, 0), newSched(weights...), rounds)
+		total := uint64(rounds) * quantumDefault
+		for i, weight := range weights {
+			ideal := float64(total) * float64(weight) / 1000
+			if diff := math.Abs(float64(service[int32(100+i)]) - ideal); diff > quantumDefault {
+				t.Fatalf("After %d rounds PID %d is %.0fns off its share; want at most one quantum", rounds, 100+i, diff)
+			}
+		}
+	}
+}
+
+// TestLotterySeed verifies that the same seed reproduces the same schedule
+func TestLotterySeed(t *testing.T) {
+	order := func(seed int64) []int32 {
+		s := NewSharePlugin(PolicyLottery, seed)
+		sched := plugintest.NewSched(1)
+		for pid := int32(100); pid < 105; pid++ {
+			sched.Enqueue(&models.QueuedTask{Pid: pid, Weight: 100})
+		}
+		var pids []int32
+		for i := 0; i < 50; i++ {
+			s.DrainQueuedTask(sched)
+			task := s.SelectQueuedTask(sched)
+			pids = append(pids, task.Pid)
+			sched.Enqueue(task)
+		}
+		return pids
+	}
+
+	first, second, other := order(7), order(7), order(8)
+	same := true
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Draw %d differs with the same seed: %d != %d", i, first[i], second[i])
+		}
+		same = same && first[i] == other[i]
+	}
+	if same {
+		t.Error("Different seeds produced the same schedule")
+	}
+}
+
+// TestStrategyTickets verifies that strategy tickets override weights and can be reassigned
+func TestStrategyTickets(t *testing.T) {
+	for _, policy := range []Policy{PolicyLottery, PolicyStride} {
+		s := NewSharePlugin(policy, 1)
+		s.UpdateStrategyMap([]util.SchedulingStrategy{
+			{PID: 100, Tickets: 300},
+			{Mode: "fifo", Tickets: 1000},
+		})
+		sched := newSched(100, 100)
+		service := runShares(t, s, sched, 8000)
+		if err := shareError(service, 300, 100); err > 0.05 {
+			t.Errorf("Policy %d: share error with strategy tickets = %.3f; want at most 0.05", policy, err)
+		}
+
+		// Reassigning the tickets changes the shares from the next dispatches
+		s.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 101, Tickets: 300}})
+		service = runShares(t, s, sched, 8000)
+		if err := shareError(service, 100, 300); err > 0.05 {
+			t.Errorf("Policy %d: share error after reassigning tickets = %.3f; want at most 0.05", policy, err)
+		}
+	}
+}
+
+// TestHugeTickets verifies that huge tickets are capped instead of overflowing the draw
+func TestHugeTickets(t *testing.T) {
+	for _, policy := range []Policy{PolicyLottery, PolicyStride} {
+		s := NewSharePlugin(policy, 1)
+		s.UpdateStrategyMap([]util.SchedulingStrategy{
+			{PID: 100, Tickets: math.MaxUint64},
+			{PID: 101, Tickets: math.MaxInt64},
+		})
+		sched := newSched(100, 100, math.MaxUint64)
+		s.DrainQueuedTask(sched)
+		if queued := s.GetStats().QueuedTickets; queued != 3*ticketsMax {
+			t.Errorf("Policy %d: queued tickets = %d; want %d", policy, queued, 3*ticketsMax)
+		}
+		service := runShares(t, s, sched, 3000)
+		if err := shareError(service, 1, 1, 1); err > 0.1 {
+			t.Errorf("Policy %d: share error with capped tickets = %.3f; want at most 0.1", policy, err)
+		}
+	}
+}
+
+// TestStrideSleeperCannotBankCredit verifies that a task joining late starts at the current pass
+func TestStrideSleeperCannotBankCredit(t *testing.T) {
+	s := NewSharePlugin(PolicyStride, 0)
+	sched := newSched(100)
+	runShares(t, s, sched, 100)
+
+	// PID 200 wakes up after PID 100 ran alone for 100 quanta
+	sched.Enqueue(&models.QueuedTask{Pid: 200, Weight: 100})
+	s.DrainQueuedTask(sched)
+
+	// PID 200 only gets its share, rather than running until its pass catches up
+	counts := make(map[int32]int)
+	for i := 0; i < 10; i++ {
+		task := s.SelectQueuedTask(sched)
+		counts[task.Pid]++
+		task.StartTs, task.StopTs = 0, s.GetQuantum()
+		sched.Enqueue(task)
+		s.DrainQueuedTask(sched)
+	}
+	if counts[100] != 5 || counts[200] != 5 {
+		t.Errorf("Dispatches = %v; want 5 each", counts)
+	}
+}
+
+// TestShareFactory verifies that the factory applies the scheduler configuration and host
+func TestShareFactory(t *testing.T) {
+	for mode, policy := range map[string]Policy{"lottery": PolicyLottery, "stride": PolicyStride} {
+		config := &reg.SchedConfig{
+			Mode:      mode,
+			Scheduler: reg.Scheduler{SliceNsDefault: 1234, LotterySeed: 5},
+			Host:      reg.Host{Proc: fstest.MapFS{}},
+		}
+		scheduler, err := reg.NewSchedulerPlugin(context.Background(), config)
+		if err != nil {
+			t.Fatalf("NewSchedulerPlugin(%s): %v", mode, err)
+		}
+		s := scheduler.(*SharePlugin)
+		if s.GetPolicy() != policy || s.GetQuantum() != 1234 {
+			t.Errorf("Mode %s: policy %d, quantum %d; want %d, 1234", mode, s.GetPolicy(), s.GetQuantum(), policy)
+		}
+		// PID 1 is missing from the fake /proc of the host
+		s.passes.Update(1, func(*uint64) {})
+		if dead := s.passes.SweepDead(); dead != 1 {
+			t.Errorf("Mode %s: SweepDead = %d; want 1 with the host /proc", mode, dead)
+		}
+	}
+}
+
+// TestShareFactoryAPIStrategies verifies that the factory applies the tickets fetched from the API server
+func TestShareFactoryAPIStrategies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":true,"scheduling":[{"pid":100,"tickets":300}]}`))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := newFromConfig(ctx, PolicyStride, &reg.SchedConfig{APIConfig: reg.APIConfig{
+		Enabled:       true,
+		PublicKeyPath: "unused.pem",
+		BaseURL:       server.URL,
+		Interval:      1,
+	}})
+	if err != nil {
+		t.Fatalf("newFromConfig error: %v", err)
+	}
+	task := &models.QueuedTask{Pid: 100, Weight: 100}
+	for deadline := time.Now().Add(5 * time.Second); s.ticketsOf(task) != 300; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Tickets from the API were not applied")
+		}
+	}
+}
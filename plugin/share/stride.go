@@ -0,0 +1,41 @@
+package share
+
+// pushStride charges the time a task ran to its pass and queues it. The pass advances by the
+// execution time scaled by ticketsDefault / tickets, so that a task with twice the tickets runs
+// twice as long for the same pass. Must be called with mu held.
+func (s *SharePlugin) pushStride(c *client) {
+	var ran uint64
+	if c.task.StopTs > c.task.StartTs {
+		ran = c.task.StopTs - c.task.StartTs
+	}
+	pass, _ := s.passes.Get(c.task.Pid)
+	c.pass = max(pass+ran*ticketsDefault/c.tickets, s.globalPass)
+	s.passes.Update(c.task.Pid, func(saved *uint64) {
+		*saved = c.pass
+	})
+
+	s.strideQueue.Push(c)
+}
+
+// popStride removes and returns the client with the smallest pass, the queue must not be empty.
+// Must be called with mu held.
+func (s *SharePlugin) popStride() *client {
+	c := s.strideQueue.Pop()
+	s.globalPass = max(s.globalPass, c.pass)
+	return c
+}
+
+// byPass orders the stride queue by lessPass
+type byPass struct{}
+
+func (byPass) Less(a, b **client) bool {
+	return lessPass(*a, *b)
+}
+
+// lessPass orders clients by pass, then PID so that ties are broken deterministically
+func lessPass(a, b *client) bool {
+	if a.pass != b.pass {
+		return a.pass < b.pass
+	}
+	return a.task.Pid < b.task.Pid
+}
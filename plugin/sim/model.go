@@ -0,0 +1,68 @@
+package sim
+
+import "math"
+
+// Model describes the behavior of a simulated task: the CPU time it needs each time it is
+// released, and when it is released again once that burst completed
+type Model interface {
+	// Burst returns the CPU time the task needs before it blocks
+	Burst() uint64
+	// Wakeup returns when the task is released again, given when its last burst was released and
+	// when it completed
+	Wakeup(release, done uint64) uint64
+}
+
+// cpuBound never blocks
+type cpuBound struct{}
+
+// CPUBound returns the model of a task that never blocks
+func CPUBound() Model {
+	return cpuBound{}
+}
+
+func (cpuBound) Burst() uint64 {
+	return math.MaxUint64
+}
+
+func (cpuBound) Wakeup(release, done uint64) uint64 {
+	return done
+}
+
+// ioBound runs for a burst, then waits for IO
+type ioBound struct {
+	burst, sleep uint64
+}
+
+// IOBound returns the model of a task that runs for burst, then blocks for sleep, such as a task
+// waiting for the disk or the network after handling each request
+func IOBound(burst, sleep uint64) Model {
+	return ioBound{burst: max(burst, 1), sleep: sleep}
+}
+
+func (m ioBound) Burst() uint64 {
+	return m.burst
+}
+
+func (m ioBound) Wakeup(release, done uint64) uint64 {
+	return done + m.sleep
+}
+
+// periodic is released at a fixed rate
+type periodic struct {
+	runtime, period uint64
+}
+
+// Periodic returns the model of a task released every period that runs for runtime each time,
+// such as a media or control loop. A release that completes after the next one is due is
+// released again immediately.
+func Periodic(runtime, period uint64) Model {
+	return periodic{runtime: max(runtime, 1), period: max(period, 1)}
+}
+
+func (m periodic) Burst() uint64 {
+	return m.runtime
+}
+
+func (m periodic) Wakeup(release, done uint64) uint64 {
+	return max(release+m.period, done)
+}
@@ -0,0 +1,71 @@
+package sim
+
+// TaskReport holds what a simulated task experienced
+type TaskReport struct {
+	Pid    int32
+	Weight uint64
+
+	// Runtime is the CPU time the task received
+	Runtime uint64
+	// Share is the fraction of the CPU time of all tasks the task received
+	Share float64
+	// Wait is the time the task spent runnable without running, MaxWait the longest such period
+	Wait    uint64
+	MaxWait uint64
+	// NrRuns is the number of times the task was dispatched
+	NrRuns uint64
+	// NrWakeups is the number of times the task was released after blocking
+	NrWakeups uint64
+}
+
+// AvgWait returns the average time the task waited before each run
+func (r TaskReport) AvgWait() uint64 {
+	if r.NrRuns == 0 {
+		return r.Wait
+	}
+	return r.Wait / r.NrRuns
+}
+
+// Report holds the results of a simulation
+type Report struct {
+	// Duration is the simulated time
+	Duration uint64
+	// Tasks are ordered by PID
+	Tasks []TaskReport
+	// FairnessIndex is the Jain fairness index of the runtime of the tasks divided by their
+	// weight: 1 when every task received CPU time in proportion to its weight, down to 1/n when
+	// one task received all of it. Tasks that block do not ask for their full share, so the index
+	// is only meaningful for tasks that are always runnable.
+	FairnessIndex float64
+	// CPUBusy is the time each CPU spent running tasks
+	CPUBusy []uint64
+
+	NrDispatches uint64
+	// NrSelectCPUErrors counts SelectCPU calls that returned an error, those tasks were
+	// dispatched to any CPU
+	NrSelectCPUErrors uint64
+}
+
+// Task returns the report of a PID
+func (r *Report) Task(pid int32) (TaskReport, bool) {
+	for _, task := range r.Tasks {
+		if task.Pid == pid {
+			return task, true
+		}
+	}
+	return TaskReport{}, false
+}
+
+// JainIndex returns the Jain fairness index of the values, (sum x)^2 / (n * sum x^2), or 1 when
+// every value is 0
+func JainIndex(values []float64) float64 {
+	var sum, sumSquares float64
+	for _, x := range values {
+		sum += x
+		sumSquares += x * x
+	}
+	if sumSquares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(values)) * sumSquares)
+}
@@ -0,0 +1,474 @@
+// Package sim is a deterministic scheduler simulator for evaluating plugins offline. It drives any
+// CustomScheduler through the loop of the Gthulhu scheduler (DrainQueuedTask, SelectQueuedTask,
+// DetermineTimeSlice, SelectCPU, then dispatch) on virtual CPUs with a virtual clock, running
+// tasks whose behavior is described by a Model, and reports the wait time, CPU share and
+// fairness of every task.
+//
+// Tasks are selected only while a CPU is idle, so the plugin decides which task runs next.
+// Dispatched tasks run on the CPU returned by SelectCPU, in the order they were dispatched there.
+// CPUs outside of the simulated range, such as the "any CPU" value plugins return to let the
+// kernel decide, send the task to a global queue that every idle CPU consumes. A task runs until
+// its slice expires or its burst completes, it is then queued again or blocks until its model
+// releases it.
+package sim
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Gthulhu/plugin/models"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+)
+
+const (
+	sliceDefault  = 5000 * 1000 // 5ms in nanoseconds
+	tickDefault   = 1000 * 1000 // 1ms in nanoseconds
+	weightDefault = 100         // Weight of a nice 0 task
+	clockStart    = 1           // Plugins treat a zero timestamp as unset
+)
+
+// Config describes the simulated host
+type Config struct {
+	// NrCPUs is the number of virtual CPUs (1 if 0)
+	NrCPUs int
+	// SliceDefault is the time slice of tasks for which DetermineTimeSlice returns 0 (5ms if 0)
+	SliceDefault uint64
+	// Tick is the interval at which the scheduler loop runs while a CPU is idle and tasks are
+	// waiting in the scheduler queue or the plugin without any other event (1ms if 0)
+	Tick uint64
+}
+
+// TaskSpec describes a simulated task
+type TaskSpec struct {
+	Pid int32
+	// Tgid defaults to Pid
+	Tgid int32
+	// Weight defaults to 100, the weight of a nice 0 task
+	Weight uint64
+	Model  Model
+	// Delay is the time after which the task is first released, from when it is added
+	Delay uint64
+}
+
+// Clocked is implemented by plugins whose clock can be replaced, the simulator drives them with
+// its virtual clock
+type Clocked interface {
+	SetClock(now func() uint64)
+}
+
+// taskState is where a simulated task is
+type taskState int
+
+const (
+	stateSleeping   taskState = iota
+	stateQueued               // In the scheduler queue or held by the plugin
+	stateDispatched           // In the queue of a CPU
+	stateRunning
+)
+
+func (s taskState) String() string {
+	switch s {
+	case stateSleeping:
+		return "sleeping"
+	case stateQueued:
+		return "queued"
+	case stateDispatched:
+		return "dispatched"
+	}
+	return "running"
+}
+
+// simTask is a simulated task
+type simTask struct {
+	spec  TaskSpec
+	task  models.QueuedTask // What the kernel reports about the task
+	state taskState
+
+	release       uint64 // When the current burst was released
+	remaining     uint64 // CPU time left in the current burst
+	runnableSince uint64
+	released      bool
+	cpu           int // CPU the task is running on
+
+	report TaskReport
+}
+
+// dispatch is a task in the queue of a CPU
+type dispatch struct {
+	task  *simTask
+	slice uint64
+}
+
+// cpu is a virtual CPU
+type cpu struct {
+	local   []dispatch
+	running *simTask
+	start   uint64
+	end     uint64
+	busy    uint64
+}
+
+// Simulator runs a plugin against simulated tasks. It is the Sched the plugin is called with.
+type Simulator struct {
+	scheduler reg.CustomScheduler
+	config    Config
+
+	start uint64
+	now   uint64
+
+	tasks   []*simTask
+	byPid   map[int32]*simTask
+	cpus    []cpu
+	global  []dispatch
+	pending []*simTask // Scheduler queue drained by DequeueTask
+	timers  timerHeap
+
+	nrDispatches      uint64
+	nrSelectCPUErrors uint64
+}
+
+// Verify that Simulator implements the plugin.Sched interface
+var _ reg.Sched = (*Simulator)(nil)
+
+// New creates a simulator driving the given plugin. Plugins implementing Clocked are switched to
+// the virtual clock.
+func New(scheduler reg.CustomScheduler, config Config) *Simulator {
+	if config.NrCPUs <= 0 {
+		config.NrCPUs = 1
+	}
+	if config.SliceDefault == 0 {
+		config.SliceDefault = sliceDefault
+	}
+	if config.Tick == 0 {
+		config.Tick = tickDefault
+	}
+
+	s := &Simulator{
+		scheduler: scheduler,
+		config:    config,
+		start:     clockStart,
+		now:       clockStart,
+		byPid:     make(map[int32]*simTask),
+		cpus:      make([]cpu, config.NrCPUs),
+	}
+	if clocked, ok := scheduler.(Clocked); ok {
+		clocked.SetClock(s.Now)
+	}
+	return s
+}
+
+// Now returns the virtual time in nanoseconds
+func (s *Simulator) Now() uint64 {
+	return s.now
+}
+
+// AddTask adds a task, first released after its delay
+func (s *Simulator) AddTask(spec TaskSpec) error {
+	if spec.Pid <= 0 {
+		return fmt.Errorf("invalid PID %d", spec.Pid)
+	}
+	if _, ok := s.byPid[spec.Pid]; ok {
+		return fmt.Errorf("duplicate PID %d", spec.Pid)
+	}
+	if spec.Model == nil {
+		return fmt.Errorf("PID %d has no model", spec.Pid)
+	}
+	if spec.Tgid == 0 {
+		spec.Tgid = spec.Pid
+	}
+	if spec.Weight == 0 {
+		spec.Weight = weightDefault
+	}
+
+	t := &simTask{
+		spec: spec,
+		task: models.QueuedTask{
+			Pid:           spec.Pid,
+			Tgid:          spec.Tgid,
+			Cpu:           -1,
+			NrCpusAllowed: uint64(len(s.cpus)),
+			Weight:        spec.Weight,
+		},
+		report: TaskReport{Pid: spec.Pid, Weight: spec.Weight},
+	}
+	s.tasks = append(s.tasks, t)
+	s.byPid[spec.Pid] = t
+	s.timers.push(s.now+spec.Delay, t)
+	return nil
+}
+
+// Run advances the simulation by duration and returns the report of the whole simulation so far.
+// It fails when the plugin dispatches a task that is not waiting to be dispatched.
+func (s *Simulator) Run(duration uint64) (*Report, error) {
+	end := s.now + duration
+	for {
+		if err := s.schedule(); err != nil {
+			return nil, err
+		}
+		next, ok := s.nextEvent()
+		if !ok || next > end {
+			s.now = end
+			break
+		}
+		s.now = next
+		s.completeRuns()
+		s.fireTimers()
+		if s.now == end {
+			// Tasks released now are scheduled by the next call
+			break
+		}
+	}
+	return s.report(), nil
+}
+
+// schedule runs one iteration of the scheduler loop: it drains the scheduler queue, then
+// dispatches the tasks selected by the plugin while some CPU has nothing to run, starting them on
+// the idle CPUs
+func (s *Simulator) schedule() error {
+	s.scheduler.DrainQueuedTask(s)
+	for {
+		s.startRuns()
+		if !s.hasIdleCPU() {
+			return nil
+		}
+		task := s.scheduler.SelectQueuedTask(s)
+		if task == nil {
+			return nil
+		}
+		if err := s.dispatch(task); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch queues a task selected by the plugin to the CPU returned by SelectCPU
+func (s *Simulator) dispatch(task *models.QueuedTask) error {
+	t, ok := s.byPid[task.Pid]
+	if !ok {
+		return fmt.Errorf("plugin dispatched unknown PID %d", task.Pid)
+	}
+	if t.state != stateQueued {
+		return fmt.Errorf("plugin dispatched PID %d while %s", task.Pid, t.state)
+	}
+
+	slice := s.scheduler.DetermineTimeSlice(s, task)
+	if slice == 0 {
+		slice = s.config.SliceDefault
+	}
+	err, cpu := s.scheduler.SelectCPU(s, task)
+	if err != nil {
+		s.nrSelectCPUErrors++
+		cpu = -1
+	}
+
+	// The vtime set by the plugin is what the kernel reports next time
+	t.task.Vtime = task.Vtime
+	t.state = stateDispatched
+	d := dispatch{task: t, slice: slice}
+	if cpu >= 0 && int(cpu) < len(s.cpus) {
+		s.cpus[cpu].local = append(s.cpus[cpu].local, d)
+	} else {
+		s.global = append(s.global, d)
+	}
+	s.nrDispatches++
+	return nil
+}
+
+// startRuns starts the dispatched tasks on the idle CPUs, local tasks first
+func (s *Simulator) startRuns() {
+	for id := range s.cpus {
+		c := &s.cpus[id]
+		if c.running != nil {
+			continue
+		}
+		var d dispatch
+		switch {
+		case len(c.local) > 0:
+			d, c.local = c.local[0], c.local[1:]
+		case len(s.global) > 0:
+			d, s.global = s.global[0], s.global[1:]
+		default:
+			continue
+		}
+		s.startRun(id, d)
+	}
+}
+
+// hasIdleCPU reports whether a CPU runs nothing
+func (s *Simulator) hasIdleCPU() bool {
+	for id := range s.cpus {
+		if s.cpus[id].running == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// startRun runs a dispatched task on an idle CPU until its slice expires or its burst completes
+func (s *Simulator) startRun(id int, d dispatch) {
+	c, t := &s.cpus[id], d.task
+	wait := s.now - t.runnableSince
+	t.report.Wait += wait
+	t.report.MaxWait = max(t.report.MaxWait, wait)
+	t.report.NrRuns++
+
+	t.state = stateRunning
+	t.cpu = id
+	c.running = t
+	c.start = s.now
+	c.end = s.now + max(min(d.slice, t.remaining), 1)
+}
+
+// nextEvent returns when the next run completes or timer fires, or the next tick while tasks are
+// waiting to be dispatched to an idle CPU
+func (s *Simulator) nextEvent() (uint64, bool) {
+	next, ok := uint64(0), false
+	at := func(t uint64) {
+		if !ok || t < next {
+			next, ok = t, true
+		}
+	}
+	for id := range s.cpus {
+		if s.cpus[id].running != nil {
+			at(s.cpus[id].end)
+		}
+	}
+	if s.timers.len() > 0 {
+		at(max(s.timers.peek().at, s.now))
+	}
+	if s.hasIdleCPU() && (len(s.pending) > 0 || s.scheduler.GetPoolCount() > 0) {
+		at(s.now + s.config.Tick)
+	}
+	return next, ok
+}
+
+// completeRuns stops the tasks whose run ends now, queuing them again if their burst is not
+// complete
+func (s *Simulator) completeRuns() {
+	for id := range s.cpus {
+		c := &s.cpus[id]
+		if c.running == nil || c.end > s.now {
+			continue
+		}
+		t := c.running
+		ran := s.now - c.start
+		c.busy += ran
+		c.running = nil
+
+		t.report.Runtime += ran
+		t.remaining -= min(ran, t.remaining)
+		t.task.Cpu = int32(id)
+		t.task.StartTs = c.start
+		t.task.StopTs = s.now
+		t.task.SumExecRuntime += ran
+
+		if t.remaining > 0 {
+			s.enqueue(t)
+			continue
+		}
+		t.state = stateSleeping
+		s.timers.push(max(t.spec.Model.Wakeup(t.release, s.now), s.now), t)
+	}
+}
+
+// fireTimers releases the tasks whose timer is due
+func (s *Simulator) fireTimers() {
+	for s.timers.len() > 0 && s.timers.peek().at <= s.now {
+		t := s.timers.pop().task
+		if t.released {
+			t.report.NrWakeups++
+		}
+		t.released = true
+		t.release = s.now
+		t.remaining = t.spec.Model.Burst()
+		s.enqueue(t)
+	}
+}
+
+// enqueue puts a runnable task in the scheduler queue
+func (s *Simulator) enqueue(t *simTask) {
+	t.state = stateQueued
+	t.runnableSince = s.now
+	s.pending = append(s.pending, t)
+}
+
+// DequeueTask implements plugin.Sched.DequeueTask, setting the PID to -1 when no task is queued
+func (s *Simulator) DequeueTask(task *models.QueuedTask) {
+	if len(s.pending) == 0 {
+		task.Pid = -1
+		return
+	}
+	*task = s.pending[0].task
+	s.pending[0] = nil
+	s.pending = s.pending[1:]
+}
+
+// DefaultSelectCPU implements plugin.Sched.DefaultSelectCPU: the previous CPU of the task if it is
+// idle, else the first idle CPU, else the previous CPU
+func (s *Simulator) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	prev := t.Cpu
+	valid := prev >= 0 && int(prev) < len(s.cpus)
+	if valid && s.idle(prev) {
+		return nil, prev
+	}
+	for id := range s.cpus {
+		if s.idle(int32(id)) {
+			return nil, int32(id)
+		}
+	}
+	if valid {
+		return nil, prev
+	}
+	return nil, 0
+}
+
+// GetNrQueued implements plugin.Sched.GetNrQueued
+func (s *Simulator) GetNrQueued() uint64 {
+	return uint64(len(s.pending))
+}
+
+// idle reports whether a CPU runs nothing and has nothing dispatched to it
+func (s *Simulator) idle(id int32) bool {
+	return s.cpus[id].running == nil && len(s.cpus[id].local) == 0
+}
+
+// report summarizes the simulation so far, counting the runs and waits in progress
+func (s *Simulator) report() *Report {
+	r := &Report{
+		Duration:          s.now - s.start,
+		CPUBusy:           make([]uint64, len(s.cpus)),
+		NrDispatches:      s.nrDispatches,
+		NrSelectCPUErrors: s.nrSelectCPUErrors,
+	}
+	for id := range s.cpus {
+		r.CPUBusy[id] = s.cpus[id].busy
+	}
+
+	var total uint64
+	for _, t := range s.tasks {
+		tr := t.report
+		switch t.state {
+		case stateQueued, stateDispatched:
+			wait := s.now - t.runnableSince
+			tr.Wait += wait
+			tr.MaxWait = max(tr.MaxWait, wait)
+		case stateRunning:
+			ran := s.now - s.cpus[t.cpu].start
+			tr.Runtime += ran
+			r.CPUBusy[t.cpu] += ran
+		}
+		total += tr.Runtime
+		r.Tasks = append(r.Tasks, tr)
+	}
+	sort.Slice(r.Tasks, func(i, j int) bool { return r.Tasks[i].Pid < r.Tasks[j].Pid })
+
+	normalized := make([]float64, len(r.Tasks))
+	for i := range r.Tasks {
+		if total > 0 {
+			r.Tasks[i].Share = float64(r.Tasks[i].Runtime) / float64(total)
+		}
+		normalized[i] = float64(r.Tasks[i].Runtime) / float64(r.Tasks[i].Weight)
+	}
+	r.FairnessIndex = JainIndex(normalized)
+	return r
+}
@@ -0,0 +1,210 @@
+package sim
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/baseline"
+	"github.com/Gthulhu/plugin/plugin/eevdf"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/simple"
+)
+
+const ms = 1000 * 1000
+
+// newSimulator creates a simulator with the given tasks
+func newSimulator(t *testing.T, scheduler reg.CustomScheduler, nrCPUs int, specs ...TaskSpec) *Simulator {
+	t.Helper()
+	s := New(scheduler, Config{NrCPUs: nrCPUs})
+	for _, spec := range specs {
+		if err := s.AddTask(spec); err != nil {
+			t.Fatalf("AddTask: %v", err)
+		}
+	}
+	return s
+}
+
+// run runs a simulation and fails the test on error
+func run(t *testing.T, s *Simulator, duration uint64) *Report {
+	t.Helper()
+	report, err := s.Run(duration)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return report
+}
+
+// TestSimulatorWeightedShares verifies that CPU-bound tasks get their weighted share under the
+// weighted vtime plugin
+func TestSimulatorWeightedShares(t *testing.T) {
+	s := newSimulator(t, simple.NewSimplePlugin(false), 1,
+		TaskSpec{Pid: 1, Weight: 100, Model: CPUBound()},
+		TaskSpec{Pid: 2, Weight: 200, Model: CPUBound()},
+		TaskSpec{Pid: 3, Weight: 300, Model: CPUBound()},
+	)
+	report := run(t, s, 3000*ms)
+
+	for _, task := range report.Tasks {
+		want := float64(task.Weight) / 600
+		if math.Abs(task.Share-want) > 0.05*want {
+			t.Errorf("PID %d share = %.3f; want %.3f", task.Pid, task.Share, want)
+		}
+	}
+	if report.FairnessIndex < 0.99 {
+		t.Errorf("FairnessIndex = %.3f; want at least 0.99", report.FairnessIndex)
+	}
+	if report.CPUBusy[0] != report.Duration {
+		t.Errorf("CPU busy for %d of %d; want always busy", report.CPUBusy[0], report.Duration)
+	}
+}
+
+// TestSimulatorModels verifies the behavior of the task models on an otherwise idle CPU
+func TestSimulatorModels(t *testing.T) {
+	s := newSimulator(t, baseline.NewBaselinePlugin(baseline.PolicyRR), 2,
+		TaskSpec{Pid: 1, Model: Periodic(1*ms, 10*ms)},
+		TaskSpec{Pid: 2, Model: IOBound(2*ms, 8*ms), Delay: 5 * ms},
+	)
+	report := run(t, s, 1000*ms)
+
+	periodicTask, _ := report.Task(1)
+	if periodicTask.NrRuns != 100 || periodicTask.NrWakeups != 100 || periodicTask.Runtime != 100*ms {
+		t.Errorf("Periodic task = %+v; want 100 runs of 1ms", periodicTask)
+	}
+	ioTask, _ := report.Task(2)
+	if ioTask.NrRuns != 100 || ioTask.Runtime != 200*ms {
+		t.Errorf("IO-bound task = %+v; want 100 runs of 2ms", ioTask)
+	}
+	if periodicTask.Wait != 0 || ioTask.Wait != 0 {
+		t.Errorf("Waits = %d, %d; want 0 with a CPU each", periodicTask.Wait, ioTask.Wait)
+	}
+}
+
+// TestSimulatorWaitTime verifies that wait times account for the tasks running in between
+func TestSimulatorWaitTime(t *testing.T) {
+	s := newSimulator(t, baseline.NewBaselinePlugin(baseline.PolicyRR), 1,
+		TaskSpec{Pid: 1, Model: CPUBound()},
+		TaskSpec{Pid: 2, Model: IOBound(1*ms, 20*ms)},
+	)
+	report := run(t, s, 1000*ms)
+
+	// The IO-bound task waits at most for the 5ms quantum of the CPU-bound task
+	ioTask, _ := report.Task(2)
+	if ioTask.MaxWait > 5*ms || ioTask.NrRuns < 35 {
+		t.Errorf("IO-bound task = %+v; want at least 35 runs waiting at most 5ms", ioTask)
+	}
+	cpuTask, _ := report.Task(1)
+	if cpuTask.Runtime+ioTask.Runtime != report.Duration {
+		t.Errorf("Runtimes %d + %d; want %d", cpuTask.Runtime, ioTask.Runtime, report.Duration)
+	}
+	if report.FairnessIndex > 0.9 {
+		t.Errorf("FairnessIndex = %.3f; want low with a task that mostly sleeps", report.FairnessIndex)
+	}
+}
+
+// TestSimulatorMultiCPU verifies that tasks dispatched to any CPU keep every CPU busy
+func TestSimulatorMultiCPU(t *testing.T) {
+	var specs []TaskSpec
+	for pid := int32(1); pid <= 6; pid++ {
+		specs = append(specs, TaskSpec{Pid: pid, Model: CPUBound()})
+	}
+	s := newSimulator(t, baseline.NewBaselinePlugin(baseline.PolicyRR), 4, specs...)
+	report := run(t, s, 600*ms)
+
+	for cpu, busy := range report.CPUBusy {
+		if busy != report.Duration {
+			t.Errorf("CPU %d busy for %d of %d; want always busy", cpu, busy, report.Duration)
+		}
+	}
+	for _, task := range report.Tasks {
+		if task.Runtime != 400*ms {
+			t.Errorf("PID %d ran for %d; want 400ms", task.Pid, task.Runtime)
+		}
+	}
+}
+
+// TestSimulatorDeterministic verifies that simulations are reproducible, also with a plugin
+// using the virtual clock
+func TestSimulatorDeterministic(t *testing.T) {
+	simulate := func() *Report {
+		s := newSimulator(t, eevdf.NewEEVDFPlugin(0), 2,
+			TaskSpec{Pid: 1, Model: CPUBound()},
+			TaskSpec{Pid: 2, Weight: 300, Model: CPUBound()},
+			TaskSpec{Pid: 3, Model: IOBound(500*1000, 3*ms)},
+			TaskSpec{Pid: 4, Model: Periodic(2*ms, 16*ms), Delay: 7 * ms},
+		)
+		run(t, s, 200*ms)
+		return run(t, s, 300*ms)
+	}
+
+	first, second := simulate(), simulate()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Reports differ:\n%+v\n%+v", first, second)
+	}
+	if first.Duration != 500*ms {
+		t.Errorf("Duration = %d; want 500ms", first.Duration)
+	}
+}
+
+// doubleDispatcher dispatches its first task twice
+type doubleDispatcher struct {
+	*baseline.BaselinePlugin
+	last *models.QueuedTask
+}
+
+func (d *doubleDispatcher) SelectQueuedTask(s reg.Sched) *models.QueuedTask {
+	if d.last != nil {
+		return d.last
+	}
+	d.last = d.BaselinePlugin.SelectQueuedTask(s)
+	return d.last
+}
+
+// TestSimulatorDetectsInvalidDispatch verifies that plugins dispatching a task twice are reported
+func TestSimulatorDetectsInvalidDispatch(t *testing.T) {
+	plugin := &doubleDispatcher{BaselinePlugin: baseline.NewBaselinePlugin(baseline.PolicyRR)}
+	s := newSimulator(t, plugin, 2, TaskSpec{Pid: 1, Model: CPUBound()})
+	_, err := s.Run(10 * ms)
+	if err == nil || !strings.Contains(err.Error(), "dispatched PID 1 while running") {
+		t.Errorf("Run error = %v; want a double dispatch", err)
+	}
+}
+
+// TestAddTask verifies task validation
+func TestAddTask(t *testing.T) {
+	s := New(baseline.NewBaselinePlugin(baseline.PolicyRR), Config{})
+	for _, spec := range []TaskSpec{
+		{Pid: 0, Model: CPUBound()},
+		{Pid: 1},
+	} {
+		if err := s.AddTask(spec); err == nil {
+			t.Errorf("AddTask(%+v) succeeded; want an error", spec)
+		}
+	}
+	if err := s.AddTask(TaskSpec{Pid: 1, Model: CPUBound()}); err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+	if err := s.AddTask(TaskSpec{Pid: 1, Model: CPUBound()}); err == nil {
+		t.Error("AddTask succeeded with a duplicate PID")
+	}
+}
+
+// TestJainIndex verifies the fairness index bounds
+func TestJainIndex(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{values: []float64{1, 1, 1, 1}, want: 1},
+		{values: []float64{1, 0, 0, 0}, want: 0.25},
+		{values: []float64{0, 0}, want: 1},
+		{values: []float64{1, 3}, want: 0.8},
+	}
+	for _, tt := range tests {
+		if got := JainIndex(tt.values); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("JainIndex(%v) = %f; want %f", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package sim
+
+import "github.com/Gthulhu/plugin/plugin/internal/queue"
+
+// timer releases a task at a given time
+type timer struct {
+	at   uint64
+	seq  uint64 // Timers due at the same time fire in the order they were set
+	task *simTask
+}
+
+// timerHeap holds the pending timers ordered by time
+type timerHeap struct {
+	timers queue.Heap[timer, byTime]
+	seq    uint64
+}
+
+// len returns the number of pending timers
+func (h *timerHeap) len() int {
+	return h.timers.Len()
+}
+
+// peek returns the next timer to fire, the heap must not be empty
+func (h *timerHeap) peek() timer {
+	return *h.timers.Peek()
+}
+
+// push sets a timer releasing task at the given time
+func (h *timerHeap) push(at uint64, task *simTask) {
+	h.seq++
+	h.timers.Push(timer{at: at, seq: h.seq, task: task})
+}
+
+// pop removes and returns the next timer to fire, the heap must not be empty
+func (h *timerHeap) pop() timer {
+	return h.timers.Pop()
+}
+
+// byTime orders timers by time, then by the order they were set
+type byTime struct{}
+
+func (byTime) Less(a, b *timer) bool {
+	if a.at != b.at {
+		return a.at < b.at
+	}
+	return a.seq < b.seq
+}
@@ -0,0 +1,127 @@
+package simple
+
+import (
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestSimplePluginSelectCPUMask verifies that SelectCPU honors strategy CPU masks and task affinity
+func TestSimplePluginSelectCPUMask(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/status": &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t2-5\n")},
+		"200/status": &fstest.MapFile{Data: []byte("Cpus_allowed_list:\t0-1\n")},
+	}
+
+	tests := []struct {
+		name        string
+		task        models.QueuedTask
+		want        int32
+		wantDefault int
+	}{
+		{name: "NoMask", task: models.QueuedTask{Pid: 400, Tgid: 400, Cpu: 1}, want: cpuAny},
+		{name: "PreviousCPUInMask", task: models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 5}, want: 5},
+		{name: "PreviousCPUOutsideMask", task: models.QueuedTask{Pid: 300, Tgid: 300, Cpu: 0}, want: 4},
+		{name: "MaskAndAffinity", task: models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 0, NrCpusAllowed: 4}, want: 4},
+		{name: "EmptyIntersection", task: models.QueuedTask{Pid: 200, Tgid: 200, Cpu: 0, NrCpusAllowed: 2}, want: 0, wantDefault: 1},
+		{name: "UnknownAffinity", task: models.QueuedTask{Pid: 500, Tgid: 500, Cpu: 0, NrCpusAllowed: 2}, want: 0, wantDefault: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSimplePlugin(false)
+			s.affinity = affinity.NewResolver(procFS, 8)
+			s.UpdateStrategyMap([]util.SchedulingStrategy{
+				{PID: 100, CPUs: "4-7"},
+				{PID: 200, CPUs: "4-7"},
+				{PID: 300, CPUs: "4-7"},
+				{PID: 500, CPUs: "4-7"},
+			})
+			mockSched := NewMockScheduler()
+
+			err, cpu := s.SelectCPU(mockSched, &tt.task)
+			if err != nil {
+				t.Fatalf("SelectCPU error: %v", err)
+			}
+			if cpu != tt.want || mockSched.selectCPUCall != tt.wantDefault {
+				t.Errorf("SelectCPU = %d with %d default calls; want %d with %d", cpu, mockSched.selectCPUCall, tt.want, tt.wantDefault)
+			}
+		})
+	}
+}
+
+// TestSimplePluginSelectCPUSpread verifies that tasks off their mask are spread over it
+func TestSimplePluginSelectCPUSpread(t *testing.T) {
+	s := NewSimplePlugin(false)
+	s.affinity = affinity.NewResolver(fstest.MapFS{}, 4)
+	s.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, CPUs: "2,3"}, {PID: 200, CPUs: "bogus"}, {PID: 300, CPUs: "3-4"}})
+	mockSched := NewMockScheduler()
+
+	var got []int32
+	for i := 0; i < 4; i++ {
+		_, cpu := s.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 0})
+		got = append(got, cpu)
+	}
+	want := []int32{2, 3, 2, 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("SelectCPU sequence = %v; want %v", got, want)
+		}
+	}
+
+	// Invalid and offline masks leave the task unrestricted
+	for _, pid := range []int32{200, 300} {
+		if _, cpu := s.SelectCPU(mockSched, &models.QueuedTask{Pid: pid, Tgid: pid}); cpu != cpuAny {
+			t.Errorf("SelectCPU of PID %d with invalid mask = %d; want %d", pid, cpu, cpuAny)
+		}
+	}
+}
+
+// TestSimplePluginSparseOnlineCPUs verifies that masks are checked against the online CPU IDs of
+// the topology rather than the number of online CPUs
+func TestSimplePluginSparseOnlineCPUs(t *testing.T) {
+	s := NewSimplePlugin(false)
+	s.procFS = fstest.MapFS{}
+	if err := s.InitTopology(fstest.MapFS{"online": &fstest.MapFile{Data: []byte("0-3,8-11\n")}}); err != nil {
+		t.Fatalf("InitTopology error: %v", err)
+	}
+	s.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, CPUs: "8-11"}, {PID: 200, CPUs: "3-4"}})
+	mockSched := NewMockScheduler()
+
+	if _, cpu := s.SelectCPU(mockSched, &models.QueuedTask{Pid: 100, Tgid: 100, Cpu: 9}); cpu != 9 {
+		t.Errorf("SelectCPU of PID 100 = %d; want 9 from its mask", cpu)
+	}
+	if _, cpu := s.SelectCPU(mockSched, &models.QueuedTask{Pid: 200, Tgid: 200}); cpu != cpuAny {
+		t.Errorf("SelectCPU of PID 200 naming offline CPU 4 = %d; want %d", cpu, cpuAny)
+	}
+}
+
+// BenchmarkSimplePluginSelectCPUMask measures the strategy CPU mask lookup of SelectCPU with 10k
+// strategies, half of the tasks placed having none
+func BenchmarkSimplePluginSelectCPUMask(b *testing.B) {
+	const (
+		nrStrategies = 10000
+		nrCPUs       = 8
+	)
+	s := NewSimplePlugin(false)
+	s.affinity = affinity.NewResolver(fstest.MapFS{}, nrCPUs)
+	strategies := make([]util.SchedulingStrategy, nrStrategies)
+	for i := range strategies {
+		first := i % 4
+		strategies[i] = util.SchedulingStrategy{PID: 1000 + i, CPUs: strconv.Itoa(first) + "-" + strconv.Itoa(first+3)}
+	}
+	s.UpdateStrategyMap(strategies)
+	mockSched := NewMockScheduler()
+	task := models.QueuedTask{NrCpusAllowed: nrCPUs}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pid := int32(1000 + i%(2*nrStrategies))
+		task.Pid, task.Tgid, task.Cpu = pid, pid, int32(i%nrCPUs)
+		s.SelectCPU(mockSched, &task)
+	}
+}
@@ -0,0 +1,121 @@
+package simple
+
+import (
+	"fmt"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+)
+
+// DispatchPolicy selects where drained tasks are queued
+type DispatchPolicy string
+
+const (
+	// DispatchGlobal queues every task to the global pool
+	DispatchGlobal DispatchPolicy = "global"
+	// DispatchLocal queues a task to the local queue of an idle CPU when DefaultSelectCPU finds
+	// one, and to the global pool otherwise
+	DispatchLocal DispatchPolicy = "local"
+)
+
+// maxLocalStreak is the number of local queue tasks selected in a row before a waiting task of
+// the global pool goes first
+const maxLocalStreak = 8
+
+// ParseDispatchPolicy parses a dispatch policy name, the empty string selects DispatchGlobal
+func ParseDispatchPolicy(name string) (DispatchPolicy, error) {
+	switch policy := DispatchPolicy(name); policy {
+	case "":
+		return DispatchGlobal, nil
+	case DispatchGlobal, DispatchLocal:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown dispatch policy %q", name)
+	}
+}
+
+// SetDispatchPolicy sets the dispatch policy, tasks already queued stay where they are
+func (s *SimplePlugin) SetDispatchPolicy(policy DispatchPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatchPolicy = policy
+}
+
+// GetDispatchPolicy returns the current dispatch policy
+func (s *SimplePlugin) GetDispatchPolicy() DispatchPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dispatchPolicy
+}
+
+// idleCPU returns the idle CPU a task should be dispatched to directly, or -1 when it belongs in
+// the global pool. It must be called without mu held, as DefaultSelectCPU goes to the kernel.
+func (s *SimplePlugin) idleCPU(sched reg.Sched, task *models.QueuedTask) int32 {
+	s.mu.Lock()
+	policy := s.dispatchPolicy
+	s.mu.Unlock()
+	if policy != DispatchLocal {
+		return -1
+	}
+
+	// Tasks with a strategy CPU mask are placed by SelectCPU
+	s.strategyMu.RLock()
+	_, masked := s.cpuMasks[task.Tgid]
+	maxCPU := s.maxCPU()
+	s.strategyMu.RUnlock()
+	if masked {
+		return -1
+	}
+
+	err, cpu := sched.DefaultSelectCPU(task)
+	if err != nil || cpu < 0 || cpu > maxCPU {
+		return -1
+	}
+	return cpu
+}
+
+// maxCPU returns the highest CPU ID a local queue may exist for. Must be called with strategyMu
+// held.
+func (s *SimplePlugin) maxCPU() int32 {
+	if s.topology != nil {
+		return s.topology.MaxCPU()
+	}
+	return int32(s.affinity.NrCPUs() - 1)
+}
+
+// pushLocal queues a task to the local queue of the given CPU. Must be called with mu held.
+func (s *SimplePlugin) pushLocal(cpu int32, task *models.QueuedTask) {
+	if int(cpu) >= len(s.localQueues) {
+		s.localQueues = append(s.localQueues, make([]queue.FIFO, int(cpu)+1-len(s.localQueues))...)
+	}
+	s.localQueues[cpu].Push(task)
+	s.localCount++
+}
+
+// popLocal removes the oldest task of the next non-empty local queue, visiting the CPUs in
+// round-robin order, and records the CPU for SelectCPU. Must be called with mu held.
+func (s *SimplePlugin) popLocal() *models.QueuedTask {
+	if s.localCount == 0 {
+		return nil
+	}
+	for i := range s.localQueues {
+		cpu := (s.nextLocal + i) % len(s.localQueues)
+		task := s.localQueues[cpu].Pop()
+		if task == nil {
+			continue
+		}
+		s.localCount--
+		s.nextLocal = cpu + 1
+		s.localCPU.Update(task.Pid, func(v *int32) { *v = int32(cpu) })
+		return task
+	}
+	return nil
+}
+
+// clearLocalCPU forgets the CPU recorded for a task popped from a local queue that never reached
+// SelectCPU, so that the task is not sent there when it is selected from the global pool. Must be
+// called with mu held.
+func (s *SimplePlugin) clearLocalCPU(task *models.QueuedTask) {
+	s.localCPU.Delete(task.Pid)
+}
@@ -0,0 +1,275 @@
+package simple
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// busyScheduler is a MockScheduler without idle CPUs
+type busyScheduler struct {
+	*MockScheduler
+}
+
+// DefaultSelectCPU implements plugin.Sched.DefaultSelectCPU
+func (b busyScheduler) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	b.selectCPUCall++
+	return errors.New("no idle CPU"), -16
+}
+
+// TestParseDispatchPolicy verifies dispatch policy parsing
+func TestParseDispatchPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    DispatchPolicy
+		wantErr bool
+	}{
+		{name: "", want: DispatchGlobal},
+		{name: "global", want: DispatchGlobal},
+		{name: "local", want: DispatchLocal},
+		{name: "bogus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		policy, err := ParseDispatchPolicy(tt.name)
+		if (err != nil) != tt.wantErr || policy != tt.want {
+			t.Errorf("ParseDispatchPolicy(%q) = %q, %v; want %q, error %v", tt.name, policy, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestSimplePluginDispatchLocal verifies that tasks finding an idle CPU are dispatched to it directly
+func TestSimplePluginDispatchLocal(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+	simplePlugin.SetDispatchPolicy(DispatchLocal)
+	simplePlugin.affinity = affinity.NewResolver(nil, 4)
+	mockSched := NewMockScheduler()
+	for i := 0; i < 6; i++ {
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: int32(100 + i), Tgid: int32(100 + i), Weight: 100})
+	}
+
+	if drained := simplePlugin.DrainQueuedTask(mockSched); drained != 6 {
+		t.Fatalf("DrainQueuedTask = %d; want 6", drained)
+	}
+	if local, global := simplePlugin.GetStats(); local != 6 || global != 0 {
+		t.Errorf("GetStats = (%d, %d); want (6, 0)", local, global)
+	}
+	if count := simplePlugin.GetPoolCount(); count != 6 {
+		t.Errorf("GetPoolCount = %d; want 6", count)
+	}
+
+	// Each task runs on the CPU DefaultSelectCPU found for it at drain time
+	want := mockSched.GetCPUMapping()
+	for i := 0; i < 6; i++ {
+		task := simplePlugin.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatalf("SelectQueuedTask returned nil after %d tasks", i)
+		}
+		err, cpu := simplePlugin.SelectCPU(mockSched, task)
+		if err != nil || cpu != want[task.Pid] {
+			t.Errorf("SelectCPU(%d) = %d, %v; want %d", task.Pid, cpu, err, want[task.Pid])
+		}
+	}
+	if calls := mockSched.GetSelectCPUCount(); calls != 6 {
+		t.Errorf("DefaultSelectCPU calls = %d; want 6", calls)
+	}
+	if count := simplePlugin.GetPoolCount(); count != 0 {
+		t.Errorf("GetPoolCount after selecting = %d; want 0", count)
+	}
+}
+
+// TestSimplePluginDispatchLocalBusy verifies that tasks go to the global pool when no CPU is idle
+func TestSimplePluginDispatchLocalBusy(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+	simplePlugin.SetDispatchPolicy(DispatchLocal)
+	sched := busyScheduler{NewMockScheduler()}
+	for i := 0; i < 3; i++ {
+		sched.EnqueueTask(&models.QueuedTask{Pid: int32(100 + i), Tgid: int32(100 + i), Weight: 100, Vtime: uint64(3 - i)})
+	}
+
+	simplePlugin.DrainQueuedTask(sched)
+	if local, global := simplePlugin.GetStats(); local != 0 || global != 3 {
+		t.Errorf("GetStats = (%d, %d); want (0, 3)", local, global)
+	}
+
+	// The global pool keeps its vtime order and lets the kernel pick the CPU
+	for _, pid := range []int32{102, 101, 100} {
+		task := simplePlugin.SelectQueuedTask(sched)
+		if task == nil || task.Pid != pid {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, pid)
+		}
+		if _, cpu := simplePlugin.SelectCPU(sched, task); cpu != cpuAny {
+			t.Errorf("SelectCPU(%d) = %d; want cpuAny", pid, cpu)
+		}
+	}
+}
+
+// TestSimplePluginDispatchLocalRefill verifies that a CPU refilling its local queue after every
+// selection does not starve the global pool
+func TestSimplePluginDispatchLocalRefill(t *testing.T) {
+	for _, fifoMode := range []bool{false, true} {
+		simplePlugin := NewSimplePlugin(fifoMode)
+		simplePlugin.affinity = affinity.NewResolver(nil, 4)
+		mockSched := NewMockScheduler()
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+		simplePlugin.DrainQueuedTask(mockSched)
+
+		simplePlugin.SetDispatchPolicy(DispatchLocal)
+		mockSched.defaultCPU = 1
+		selected := 0
+		for pid := int32(200); pid < 200+2*maxLocalStreak; pid++ {
+			mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: pid, Weight: 100})
+			simplePlugin.DrainQueuedTask(mockSched)
+			task := simplePlugin.SelectQueuedTask(mockSched)
+			if task == nil {
+				t.Fatalf("fifoMode %v: SelectQueuedTask returned nil", fifoMode)
+			}
+			selected++
+			if task.Pid == 100 {
+				break
+			}
+		}
+		if selected > maxLocalStreak+1 {
+			t.Errorf("fifoMode %v: global task selected after %d selections; want at most %d", fifoMode, selected, maxLocalStreak+1)
+		}
+	}
+}
+
+// TestSimplePluginDispatchPaths verifies how tasks are split between local queues and the global pool
+func TestSimplePluginDispatchPaths(t *testing.T) {
+	t.Run("GlobalPolicy", func(t *testing.T) {
+		simplePlugin := NewSimplePlugin(false)
+		mockSched := NewMockScheduler()
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Tgid: 200, Weight: 100})
+
+		simplePlugin.DrainQueuedTask(mockSched)
+		if local, global := simplePlugin.GetStats(); local != 0 || global != 2 {
+			t.Errorf("GetStats = (%d, %d); want (0, 2)", local, global)
+		}
+		if calls := mockSched.GetSelectCPUCount(); calls != 0 {
+			t.Errorf("DefaultSelectCPU calls = %d; want 0", calls)
+		}
+	})
+
+	t.Run("MaskedTaskGoesGlobal", func(t *testing.T) {
+		simplePlugin := NewSimplePlugin(false)
+		simplePlugin.SetDispatchPolicy(DispatchLocal)
+		simplePlugin.affinity = affinity.NewResolver(nil, 4)
+		simplePlugin.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 200, CPUs: "2"}})
+		mockSched := NewMockScheduler()
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Tgid: 200, Weight: 100, Cpu: 2})
+
+		simplePlugin.DrainQueuedTask(mockSched)
+		if local, global := simplePlugin.GetStats(); local != 1 || global != 1 {
+			t.Errorf("GetStats = (%d, %d); want (1, 1)", local, global)
+		}
+	})
+
+	t.Run("LocalBeforeGlobal", func(t *testing.T) {
+		simplePlugin := NewSimplePlugin(false)
+		mockSched := NewMockScheduler()
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100, Vtime: 1})
+		simplePlugin.DrainQueuedTask(mockSched)
+
+		simplePlugin.SetDispatchPolicy(DispatchLocal)
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: 200, Tgid: 200, Weight: 100, Vtime: 1000})
+		simplePlugin.DrainQueuedTask(mockSched)
+
+		for _, pid := range []int32{200, 100} {
+			if task := simplePlugin.SelectQueuedTask(mockSched); task == nil || task.Pid != pid {
+				t.Fatalf("SelectQueuedTask = %v; want PID %d", task, pid)
+			}
+		}
+	})
+}
+
+// farScheduler is a MockScheduler whose DefaultSelectCPU returns a CPU beyond any topology
+type farScheduler struct {
+	*MockScheduler
+}
+
+// DefaultSelectCPU implements plugin.Sched.DefaultSelectCPU
+func (f farScheduler) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	f.selectCPUCall++
+	return nil, 1<<20 - 1
+}
+
+// TestSimplePluginDispatchLocalBounded verifies that CPUs beyond the highest CPU ID get no local queue
+func TestSimplePluginDispatchLocalBounded(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+	simplePlugin.SetDispatchPolicy(DispatchLocal)
+	simplePlugin.affinity = affinity.NewResolver(nil, 4)
+	sched := farScheduler{NewMockScheduler()}
+	sched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+
+	simplePlugin.DrainQueuedTask(sched)
+	if local, global := simplePlugin.GetStats(); local != 0 || global != 1 {
+		t.Errorf("GetStats = (%d, %d); want (0, 1)", local, global)
+	}
+	if n := len(simplePlugin.localQueues); n != 0 {
+		t.Errorf("Local queues = %d; want none", n)
+	}
+}
+
+// TestSimplePluginLocalCPUCleared verifies that a task popped from a local queue without reaching
+// SelectCPU is not sent back to that CPU once it is selected from the global pool
+func TestSimplePluginLocalCPUCleared(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+	simplePlugin.SetDispatchPolicy(DispatchLocal)
+	simplePlugin.affinity = affinity.NewResolver(nil, 4)
+	mockSched := NewMockScheduler()
+	mockSched.defaultCPU = 3
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+	simplePlugin.DrainQueuedTask(mockSched)
+	if task := simplePlugin.SelectQueuedTask(mockSched); task == nil || task.Pid != 100 {
+		t.Fatalf("SelectQueuedTask = %v; want PID 100", task)
+	}
+
+	// The task comes back before SelectCPU was called for it and no CPU is idle
+	simplePlugin.SetDispatchPolicy(DispatchGlobal)
+	mockSched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+	simplePlugin.DrainQueuedTask(mockSched)
+	task := simplePlugin.SelectQueuedTask(mockSched)
+	if task == nil || task.Pid != 100 {
+		t.Fatalf("SelectQueuedTask = %v; want PID 100", task)
+	}
+	if _, cpu := simplePlugin.SelectCPU(mockSched, task); cpu != cpuAny {
+		t.Errorf("SelectCPU = %d; want cpuAny instead of the stale local CPU 3", cpu)
+	}
+}
+
+// lockCheckScheduler is a MockScheduler recording whether the plugin lock was free during
+// DefaultSelectCPU
+type lockCheckScheduler struct {
+	*MockScheduler
+	plugin   *SimplePlugin
+	unlocked bool
+}
+
+// DefaultSelectCPU implements plugin.Sched.DefaultSelectCPU
+func (l *lockCheckScheduler) DefaultSelectCPU(t *models.QueuedTask) (error, int32) {
+	if l.plugin.mu.TryLock() {
+		l.unlocked = true
+		l.plugin.mu.Unlock()
+	}
+	return l.MockScheduler.DefaultSelectCPU(t)
+}
+
+// TestSimplePluginDispatchLocalUnlocked verifies that DefaultSelectCPU is called without the
+// plugin lock, so that dispatches do not wait behind a kernel round trip
+func TestSimplePluginDispatchLocalUnlocked(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+	simplePlugin.SetDispatchPolicy(DispatchLocal)
+	sched := &lockCheckScheduler{MockScheduler: NewMockScheduler(), plugin: simplePlugin}
+	sched.EnqueueTask(&models.QueuedTask{Pid: 100, Tgid: 100, Weight: 100})
+
+	simplePlugin.DrainQueuedTask(sched)
+	if !sched.unlocked {
+		t.Error("DefaultSelectCPU was called with the plugin lock held")
+	}
+}
@@ -0,0 +1,97 @@
+package simple
+
+import (
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+)
+
+// runFairnessSimulation runs CPU-bound tasks with the given weights on a single CPU for the
+// given number of slices and returns the runtime each task received
+func runFairnessSimulation(t *testing.T, weights []uint64, rounds int) []uint64 {
+	t.Helper()
+	simplePlugin := NewSimplePlugin(false)
+	mockSched := NewMockScheduler()
+
+	index := make(map[int32]int, len(weights))
+	for i, weight := range weights {
+		pid := int32(100 + i)
+		index[pid] = i
+		mockSched.EnqueueTask(&models.QueuedTask{Pid: pid, Tgid: pid, Weight: weight})
+	}
+
+	runtime := make([]uint64, len(weights))
+	var clock uint64
+	for i := 0; i < rounds; i++ {
+		simplePlugin.DrainQueuedTask(mockSched)
+		task := simplePlugin.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatalf("round %d: no task selected", i)
+		}
+
+		// The task consumes its whole slice and goes back to the queue
+		task.StartTs = clock
+		clock += sliceDefault
+		task.StopTs = clock
+		runtime[index[task.Pid]] += sliceDefault
+		mockSched.EnqueueTask(task)
+	}
+	return runtime
+}
+
+// TestSimplePluginFairnessConvergence verifies that CPU time converges to the task weights
+func TestSimplePluginFairnessConvergence(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []uint64
+	}{
+		{name: "EqualWeights", weights: []uint64{100, 100, 100, 100}},
+		{name: "DoubleWeight", weights: []uint64{100, 200}},
+		{name: "MixedWeights", weights: []uint64{100, 200, 300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := runFairnessSimulation(t, tt.weights, 1200)
+
+			var totalWeight, totalRuntime uint64
+			for i, weight := range tt.weights {
+				totalWeight += weight
+				totalRuntime += runtime[i]
+			}
+			for i, weight := range tt.weights {
+				share := float64(runtime[i]) / float64(totalRuntime)
+				want := float64(weight) / float64(totalWeight)
+				if share < want*0.95 || share > want*1.05 {
+					t.Errorf("task %d (weight %d) got %.3f of the CPU; want %.3f", i, weight, share, want)
+				}
+			}
+		})
+	}
+}
+
+// TestSimplePluginEnqueueChargesRuntime verifies that enqueueTask charges the last run scaled by weight
+func TestSimplePluginEnqueueChargesRuntime(t *testing.T) {
+	simplePlugin := NewSimplePlugin(false)
+
+	light := &models.QueuedTask{Pid: 100, Weight: 100, Vtime: 1000, StartTs: 0, StopTs: 4000}
+	heavy := &models.QueuedTask{Pid: 200, Weight: 400, Vtime: 1000, StartTs: 0, StopTs: 4000}
+	noWeight := &models.QueuedTask{Pid: 300, Vtime: 1000, StartTs: 0, StopTs: 4000}
+
+	if task := simplePlugin.enqueueTask(light); task.VTime != 5000 {
+		t.Errorf("weight 100 vtime = %d; want 5000", task.VTime)
+	}
+	if task := simplePlugin.enqueueTask(heavy); task.VTime != 2000 {
+		t.Errorf("weight 400 vtime = %d; want 2000", task.VTime)
+	}
+	if task := simplePlugin.enqueueTask(noWeight); task.VTime != 5000 {
+		t.Errorf("weight 0 vtime = %d; want 5000", task.VTime)
+	}
+
+	// FIFO mode does not charge runtime
+	simplePlugin.SetMode(true)
+	fifo := &models.QueuedTask{Pid: 400, Weight: 100, Vtime: 1000, StartTs: 0, StopTs: 4000}
+	if task := simplePlugin.enqueueTask(fifo); task.VTime != 1000 {
+		t.Errorf("FIFO vtime = %d; want 1000", task.VTime)
+	}
+}
@@ -0,0 +1,150 @@
+package simple
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// TestSimplePluginSetModeRequeuesByVtime verifies that switching to weighted vtime mode orders the
+// FIFO queue by vtime and limits the budget of idle tasks
+func TestSimplePluginSetModeRequeuesByVtime(t *testing.T) {
+	s := NewSimplePlugin(true)
+	s.vtimeNow = 10 * sliceDefault
+	for i, vtime := range []uint64{30 * sliceDefault, 5, 9*sliceDefault + 1} {
+		task := &models.QueuedTask{Pid: int32(100 + i), Weight: 100, Vtime: vtime}
+		s.insertTaskToPool(s.enqueueTask(task))
+	}
+
+	s.SetMode(false)
+	want := []struct {
+		pid   int32
+		vtime uint64
+	}{
+		{101, 9 * sliceDefault},
+		{102, 9*sliceDefault + 1},
+		{100, 30 * sliceDefault},
+	}
+	for _, w := range want {
+		task := s.SelectQueuedTask(nil)
+		if task == nil || task.Pid != w.pid || task.Vtime != w.vtime {
+			t.Fatalf("SelectQueuedTask = %+v; want PID %d with vtime %d", task, w.pid, w.vtime)
+		}
+	}
+}
+
+// TestSimplePluginModeSwitchStrategy verifies that mode switch strategies change the scheduling mode
+func TestSimplePluginModeSwitchStrategy(t *testing.T) {
+	s := NewSimplePlugin(false)
+	s.affinity = affinity.NewResolver(nil, 2)
+
+	s.UpdateStrategyMap([]util.SchedulingStrategy{{PID: 100, CPUs: "1"}, {Mode: ModeFIFO}})
+	if !s.GetMode() {
+		t.Error("Mode switch to fifo was not applied")
+	}
+	s.strategyMu.RLock()
+	mask := s.cpuMasks[100]
+	_, maskedZero := s.cpuMasks[0]
+	s.strategyMu.RUnlock()
+	if len(mask) != 1 || maskedZero {
+		t.Errorf("CPU masks = %v; want only PID 100 masked", s.cpuMasks)
+	}
+
+	// Unknown modes are ignored, and so are modes set on a process strategy
+	s.UpdateStrategyMap([]util.SchedulingStrategy{{Mode: "bogus"}, {PID: 100, Mode: ModeVtime}})
+	if !s.GetMode() {
+		t.Error("Invalid mode switches changed the mode")
+	}
+
+	s.UpdateStrategyMap([]util.SchedulingStrategy{{Mode: ModeVtime}})
+	if s.GetMode() {
+		t.Error("Mode switch to vtime was not applied")
+	}
+}
+
+// TestSimplePluginAPIModeSwitch verifies that the simple factory applies the strategies fetched
+// from the API server
+func TestSimplePluginAPIModeSwitch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/scheduling/strategies" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true,"scheduling":[{"pid":0,"mode":"fifo"}]}`))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := newFromConfig(ctx, false, &reg.SchedConfig{APIConfig: reg.APIConfig{
+		Enabled:       true,
+		PublicKeyPath: "unused.pem",
+		BaseURL:       server.URL,
+		Interval:      1,
+	}})
+	if err != nil {
+		t.Fatalf("newFromConfig error: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !s.GetMode(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Mode switch strategy from the API was not applied")
+		}
+	}
+}
+
+// TestSimplePluginConcurrentModeSwitch verifies that switching modes while the scheduler runs
+// neither loses nor duplicates tasks
+func TestSimplePluginConcurrentModeSwitch(t *testing.T) {
+	s := NewSimplePlugin(false)
+	const nrTasks = 2000
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for fifo := true; ; fifo = !fifo {
+			select {
+			case <-done:
+				return
+			default:
+				s.SetMode(fifo)
+			}
+		}
+	}()
+
+	seen := make(map[int32]bool)
+	sched := NewMockScheduler()
+	for i := 0; i < nrTasks; i++ {
+		sched.EnqueueTask(&models.QueuedTask{Pid: int32(i + 1), Weight: 100, Vtime: uint64(i)})
+		if i%4 == 3 {
+			s.DrainQueuedTask(sched)
+			if task := s.SelectQueuedTask(sched); task != nil {
+				if seen[task.Pid] {
+					t.Fatalf("PID %d selected twice", task.Pid)
+				}
+				seen[task.Pid] = true
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for task := s.SelectQueuedTask(sched); task != nil; task = s.SelectQueuedTask(sched) {
+		if seen[task.Pid] {
+			t.Fatalf("PID %d selected twice", task.Pid)
+		}
+		seen[task.Pid] = true
+	}
+	if len(seen) != nrTasks {
+		t.Errorf("Selected %d tasks; want %d", len(seen), nrTasks)
+	}
+}
@@ -0,0 +1,13 @@
+package simple
+
+import "github.com/Gthulhu/plugin/plugin/internal/queue"
+
+// taskHeap is a min-heap of tasks ordered by lessTask, used in weighted vtime mode
+type taskHeap = queue.Heap[Task, byVtime]
+
+// byVtime orders the tasks of a taskHeap by lessTask
+type byVtime struct{}
+
+func (byVtime) Less(a, b *Task) bool {
+	return lessTask(a, b)
+}
@@ -0,0 +1,294 @@
+package simple
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
+)
+
+// TestTaskHeapOrder verifies that the heap pops tasks by vtime, timestamp and PID
+func TestTaskHeapOrder(t *testing.T) {
+	var h taskHeap
+	vtimes := []uint64{50, 10, 40, 10, 30, 20}
+	for i, vtime := range vtimes {
+		h.Push(Task{QueuedTask: &models.QueuedTask{Pid: int32(100 + i)}, VTime: vtime})
+	}
+
+	want := []int32{101, 103, 105, 104, 102, 100}
+	for _, pid := range want {
+		if got := h.Pop().QueuedTask.Pid; got != pid {
+			t.Fatalf("Pop = PID %d; want %d", got, pid)
+		}
+	}
+}
+
+// TestSimplePluginSetModeKeepsTasks verifies that switching modes keeps queued tasks in vtime order
+func TestSimplePluginSetModeKeepsTasks(t *testing.T) {
+	s := NewSimplePlugin(false)
+	for i, vtime := range []uint64{300, 100, 200} {
+		s.insertTaskToPool(Task{QueuedTask: &models.QueuedTask{Pid: int32(100 + i), Vtime: vtime}, VTime: vtime})
+	}
+
+	s.SetMode(true)
+	for _, want := range []int32{101, 102, 100} {
+		if task := s.SelectQueuedTask(nil); task == nil || task.Pid != want {
+			t.Fatalf("SelectQueuedTask = %v; want PID %d", task, want)
+		}
+	}
+	if s.GetPoolCount() != 0 {
+		t.Errorf("Pool count = %d; want 0", s.GetPoolCount())
+	}
+}
+
+// TestSimplePluginConcurrentAccess verifies that concurrent drains and selects neither lose nor
+// duplicate tasks
+func TestSimplePluginConcurrentAccess(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		t.Run("fifo="+strconv.FormatBool(fifo), func(t *testing.T) {
+			s := NewSimplePlugin(fifo)
+			const producers, perProducer = 4, 500
+
+			var wg sync.WaitGroup
+			for p := 0; p < producers; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					sched := NewMockScheduler()
+					for i := 0; i < perProducer; i++ {
+						sched.EnqueueTask(&models.QueuedTask{Pid: int32(p*perProducer + i + 1), Weight: 100, Vtime: uint64(i)})
+					}
+					s.DrainQueuedTask(sched)
+				}(p)
+			}
+
+			var mu sync.Mutex
+			seen := make(map[int32]bool)
+			record := func(task *models.QueuedTask) {
+				mu.Lock()
+				defer mu.Unlock()
+				if seen[task.Pid] {
+					t.Errorf("PID %d selected twice", task.Pid)
+				}
+				seen[task.Pid] = true
+			}
+			for c := 0; c < 2; c++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < producers*perProducer/4; i++ {
+						if task := s.SelectQueuedTask(nil); task != nil {
+							record(task)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			for task := s.SelectQueuedTask(nil); task != nil; task = s.SelectQueuedTask(nil) {
+				record(task)
+			}
+			if len(seen) != producers*perProducer {
+				t.Errorf("Selected %d tasks; want %d", len(seen), producers*perProducer)
+			}
+		})
+	}
+}
+
+// slicePool is the previous pool implementation, a sorted slice with linear insertion that
+// reslices on every pop, kept as a baseline for the benchmarks
+type slicePool struct {
+	tasks []Task
+}
+
+func (p *slicePool) push(newTask Task) {
+	insertIdx := len(p.tasks)
+	for i := range p.tasks {
+		if lessTask(&newTask, &p.tasks[i]) {
+			insertIdx = i
+			break
+		}
+	}
+	p.tasks = append(p.tasks, Task{})
+	copy(p.tasks[insertIdx+1:], p.tasks[insertIdx:])
+	p.tasks[insertIdx] = newTask
+}
+
+func (p *slicePool) pop() Task {
+	t := p.tasks[0]
+	p.tasks = p.tasks[1:]
+	return t
+}
+
+// benchmarkPool fills a pool with n tasks of pseudo-random vtime and drains it
+func benchmarkPool(b *testing.B, n int, push func(Task), pop func() Task) {
+	tasks := make([]Task, n)
+	vtime := uint64(1)
+	for i := range tasks {
+		vtime = vtime*6364136223846793005 + 1442695040888963407
+		tasks[i] = Task{QueuedTask: &models.QueuedTask{Pid: int32(i + 1)}, VTime: vtime >> 40}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, t := range tasks {
+			push(t)
+		}
+		for range tasks {
+			pop()
+		}
+	}
+}
+
+func BenchmarkSimplePoolWeighted(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run("heap/"+strconv.Itoa(n), func(b *testing.B) {
+			var h taskHeap
+			benchmarkPool(b, n, h.Push, h.Pop)
+		})
+		b.Run("slice/"+strconv.Itoa(n), func(b *testing.B) {
+			var p slicePool
+			benchmarkPool(b, n, p.push, p.pop)
+		})
+	}
+}
+
+func BenchmarkSimplePoolFIFO(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run("ring/"+strconv.Itoa(n), func(b *testing.B) {
+			var r queue.FIFO
+			benchmarkPool(b, n, func(t Task) { r.Push(t.QueuedTask) }, func() Task { return Task{QueuedTask: r.Pop()} })
+		})
+		b.Run("slice/"+strconv.Itoa(n), func(b *testing.B) {
+			var tasks []Task
+			benchmarkPool(b, n, func(t Task) { tasks = append(tasks, t) }, func() Task {
+				t := tasks[0]
+				tasks = tasks[1:]
+				return t
+			})
+		})
+	}
+}
+
+// BenchmarkSimplePoolFIFOSteady keeps 1000 tasks queued while tasks flow through the pool, where
+// reslicing keeps reallocating the backing array and the ring does not allocate at all
+func BenchmarkSimplePoolFIFOSteady(b *testing.B) {
+	task := Task{QueuedTask: &models.QueuedTask{Pid: 1}}
+	b.Run("ring", func(b *testing.B) {
+		var r queue.FIFO
+		for i := 0; i < 1000; i++ {
+			r.Push(task.QueuedTask)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			r.Push(task.QueuedTask)
+			r.Pop()
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		tasks := make([]Task, 1000)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tasks = append(tasks, task)
+			tasks = tasks[1:]
+		}
+	})
+}
+
+// BenchmarkSimplePluginDrainSelect measures a full drain and select cycle through the plugin API
+func BenchmarkSimplePluginDrainSelect(b *testing.B) {
+	for _, fifo := range []bool{false, true} {
+		b.Run("fifo="+strconv.FormatBool(fifo), func(b *testing.B) {
+			s := NewSimplePlugin(fifo)
+			sched := NewMockScheduler()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sched.Reset()
+				for pid := 1; pid <= 1000; pid++ {
+					sched.EnqueueTask(&models.QueuedTask{Pid: int32(pid), Weight: 100, Vtime: uint64(pid * 7919 % 1000)})
+				}
+				s.DrainQueuedTask(sched)
+				for s.SelectQueuedTask(sched) != nil {
+				}
+			}
+		})
+	}
+}
+
+// benchmarkTasks returns n tasks with distinct PIDs and runtimes, so that they spread over the pool
+func benchmarkTasks(n int) []models.QueuedTask {
+	tasks := make([]models.QueuedTask, n)
+	for i := range tasks {
+		pid := int32(1000 + i)
+		tasks[i] = models.QueuedTask{
+			Pid:     pid,
+			Tgid:    pid,
+			Cpu:     -1,
+			Weight:  100,
+			StartTs: uint64(i) * 1000,
+			StopTs:  uint64(i)*1000 + uint64(i%97)*10000,
+		}
+	}
+	return tasks
+}
+
+// BenchmarkSimplePluginDrain measures draining n tasks into an empty pool
+func BenchmarkSimplePluginDrain(b *testing.B) {
+	for _, fifo := range []bool{false, true} {
+		for _, n := range []int{10, 1000, 4000} {
+			b.Run("fifo="+strconv.FormatBool(fifo)+"/pool="+strconv.Itoa(n), func(b *testing.B) {
+				s := NewSimplePlugin(fifo)
+				sched := NewMockScheduler()
+				tasks := benchmarkTasks(n)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					sched.Reset()
+					for j := range tasks {
+						task := tasks[j]
+						sched.EnqueueTask(&task)
+					}
+					b.StartTimer()
+					s.DrainQueuedTask(sched)
+					b.StopTimer()
+					for s.SelectQueuedTask(sched) != nil {
+					}
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/task")
+			})
+		}
+	}
+}
+
+// BenchmarkSimplePluginSelect measures selecting a task from a pool of n tasks, then draining it
+// back after it ran so that the pool keeps its size
+func BenchmarkSimplePluginSelect(b *testing.B) {
+	for _, fifo := range []bool{false, true} {
+		for _, n := range []int{10, 1000, 4000} {
+			b.Run("fifo="+strconv.FormatBool(fifo)+"/pool="+strconv.Itoa(n), func(b *testing.B) {
+				s := NewSimplePlugin(fifo)
+				sched := NewMockScheduler()
+				for _, task := range benchmarkTasks(n) {
+					sched.EnqueueTask(&task)
+				}
+				s.DrainQueuedTask(sched)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					task := *s.SelectQueuedTask(sched)
+					task.StartTs = task.StopTs
+					task.StopTs += 10000
+					sched.EnqueueTask(&task)
+					s.DrainQueuedTask(sched)
+				}
+			})
+		}
+	}
+}
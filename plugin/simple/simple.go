@@ -2,22 +2,29 @@ package simple
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/Gthulhu/plugin/models"
+	"github.com/Gthulhu/plugin/plugin/affinity"
+	"github.com/Gthulhu/plugin/plugin/internal/queue"
 	reg "github.com/Gthulhu/plugin/plugin/internal/registry"
+	"github.com/Gthulhu/plugin/plugin/internal/strategyapi"
+	"github.com/Gthulhu/plugin/plugin/taskstate"
+	"github.com/Gthulhu/plugin/plugin/topology"
 	"github.com/Gthulhu/plugin/plugin/util"
 )
 
 func init() {
 	// Register the simple plugin with weighted vtime mode
 	err := reg.RegisterNewPlugin("simple", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
-		simplePlugin := NewSimplePlugin(false) // weighted vtime mode
-
-		if config.Scheduler.SliceNsDefault > 0 {
-			simplePlugin.SetSliceDefault(config.Scheduler.SliceNsDefault)
-		}
-
-		return simplePlugin, nil
+		return newFromConfig(ctx, false, config)
 	})
 	if err != nil {
 		panic(err)
@@ -25,19 +32,43 @@ func init() {
 
 	// Register the simple plugin with FIFO mode
 	err = reg.RegisterNewPlugin("simple-fifo", func(ctx context.Context, config *reg.SchedConfig) (reg.CustomScheduler, error) {
-		simplePlugin := NewSimplePlugin(true) // FIFO mode
-
-		if config.Scheduler.SliceNsDefault > 0 {
-			simplePlugin.SetSliceDefault(config.Scheduler.SliceNsDefault)
-		}
-
-		return simplePlugin, nil
+		return newFromConfig(ctx, true, config)
 	})
 	if err != nil {
 		panic(err)
 	}
 }
 
+// newFromConfig creates a SimplePlugin in the given mode with the slice and dispatch policy of the config
+func newFromConfig(ctx context.Context, fifoMode bool, config *reg.SchedConfig) (*SimplePlugin, error) {
+	simplePlugin := newSimplePlugin(fifoMode, reg.HostFS(config.Host.Proc, affinity.ProcPath))
+
+	if config.Scheduler.SliceNsDefault > 0 {
+		simplePlugin.SetSliceDefault(config.Scheduler.SliceNsDefault)
+	}
+
+	policy, err := ParseDispatchPolicy(config.Scheduler.DispatchPolicy)
+	if err != nil {
+		return nil, err
+	}
+	simplePlugin.SetDispatchPolicy(policy)
+
+	if err := simplePlugin.InitTopology(reg.HostFS(config.Host.SysfsCPU, topology.SysfsCPUPath)); err != nil {
+		log.Printf("CPU topology unavailable, assuming CPUs 0 to %d are online: %v", runtime.NumCPU()-1, err)
+	}
+
+	if config.Scheduler.TaskStateSweepInterval > 0 {
+		simplePlugin.localCPU.StartSweeper(ctx, time.Duration(config.Scheduler.TaskStateSweepInterval)*time.Second)
+	}
+
+	// Strategies from the API set CPU masks and switch the scheduling mode
+	if err := strategyapi.Start(ctx, config.APIConfig, simplePlugin.UpdateStrategyMap); err != nil {
+		return nil, err
+	}
+
+	return simplePlugin, nil
+}
+
 // SimplePlugin implements a basic scheduler that can operate in two modes:
 // 1. Weighted vtime scheduling (default)
 // 2. FIFO scheduling
@@ -46,15 +77,41 @@ type SimplePlugin struct {
 	fifoMode     bool
 	sliceDefault uint64
 
-	// Task pool for managing queued tasks
-	taskPool []Task
+	// Task pool for managing queued tasks: a heap ordered by vtime in weighted vtime mode,
+	// a ring buffer in FIFO mode
+	taskHeap taskHeap
+	taskFIFO queue.FIFO
+
+	// Protects the configuration, task pool, vtime and statistics
+	mu sync.Mutex
 
 	// Global vtime tracking (for weighted vtime scheduling)
 	vtimeNow uint64
 
-	// Statistics
+	// Per-CPU queues of tasks dispatched directly to an idle CPU, and the CPU of each task
+	// selected from them until SelectCPU is called
+	dispatchPolicy DispatchPolicy
+	localQueues    []queue.FIFO
+	localCount     int
+	nextLocal      int
+	localStreak    int // Tasks taken from local queues in a row while the global pool waited
+	localCPU       *taskstate.Table[int32]
+
+	// Statistics: tasks queued to a local queue, and tasks queued to the global pool
 	localQueueCount  uint64
 	globalQueueCount uint64
+
+	// Per-strategy CPU masks keyed by PID, and the CPUs tasks are allowed to run on
+	cpuMasks   map[int32][]int32
+	strategyMu sync.RWMutex
+	affinity   *affinity.Resolver
+	nextCPU    int
+
+	// CPU topology strategy CPU masks are checked against, nil when unknown
+	topology *topology.Topology
+
+	// /proc filesystem used to inspect tasks
+	procFS fs.FS
 }
 
 // Task represents a task in the scheduler pool
@@ -66,21 +123,54 @@ type Task struct {
 
 const (
 	sliceDefault = 5000 * 100 // 0.5ms in nanoseconds
+	cpuAny       = 1 << 20    // Let the kernel pick any CPU
+)
+
+// Scheduling mode names, as used by mode switch strategies
+const (
+	ModeVtime = "vtime"
+	ModeFIFO  = "fifo"
 )
 
 // NewSimplePlugin creates a new SimplePlugin instance
 func NewSimplePlugin(fifoMode bool) *SimplePlugin {
+	return newSimplePlugin(fifoMode, os.DirFS(affinity.ProcPath))
+}
+
+// newSimplePlugin creates a plugin inspecting tasks through the given /proc filesystem
+func newSimplePlugin(fifoMode bool, procFS fs.FS) *SimplePlugin {
 	return &SimplePlugin{
 		fifoMode:         fifoMode,
 		sliceDefault:     sliceDefault,
-		taskPool:         make([]Task, 0), // Start with empty slice, no pre-allocation
-		vtimeNow:         1,               // Start with 1 to ensure vtime is never 0
+		vtimeNow:         1, // Start with 1 to ensure vtime is never 0
 		localQueueCount:  0,
 		globalQueueCount: 0,
+		dispatchPolicy:   DispatchGlobal,
+		localCPU:         taskstate.New[int32](taskstate.Options{ProcFS: procFS}),
+		cpuMasks:         make(map[int32][]int32),
+		affinity:         affinity.NewResolver(procFS, runtime.NumCPU()),
+		procFS:           procFS,
+	}
+}
+
+// InitTopology loads the online CPUs from a filesystem rooted at /sys/devices/system/cpu. Without
+// a topology CPUs 0 to runtime.NumCPU()-1 are assumed online. It must be called before scheduling
+// starts.
+func (s *SimplePlugin) InitTopology(fsys fs.FS) error {
+	topo, err := topology.Load(fsys)
+	if err != nil {
+		return err
 	}
+	s.strategyMu.Lock()
+	defer s.strategyMu.Unlock()
+	s.topology = topo
+	s.affinity = affinity.NewResolver(s.procFS, topo.NrCPUs())
+	return nil
 }
 
 func (s *SimplePlugin) SetSliceDefault(slice uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.sliceDefault = slice
 }
 
@@ -104,34 +194,126 @@ func (s *SimplePlugin) DrainQueuedTask(sched reg.Sched) int {
 			return count
 		}
 
-		// Create task and enqueue it
+		// Create task and enqueue it, to the local queue of an idle CPU when the policy allows it
+		cpu := s.idleCPU(sched, &queuedTask)
+		s.mu.Lock()
 		task := s.enqueueTask(&queuedTask)
-		s.insertTaskToPool(task)
+		if cpu >= 0 {
+			s.pushLocal(cpu, task.QueuedTask)
+			s.localQueueCount++
+		} else {
+			s.insertTaskToPool(task)
+			s.globalQueueCount++
+		}
+		s.mu.Unlock()
 
 		count++
-		s.globalQueueCount++
 	}
 }
 
 // SelectQueuedTask selects and returns the next task to be scheduled
 func (s *SimplePlugin) SelectQueuedTask(sched reg.Sched) *models.QueuedTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.getTaskFromPool()
 }
 
-// SelectCPU selects a CPU for the given task
+// SelectCPU selects a CPU for the given task. Tasks from a local queue run on the idle CPU they
+// were queued to, tasks without a strategy CPU mask may run on any CPU, others run on a CPU
+// allowed by both the mask and their affinity.
 func (s *SimplePlugin) SelectCPU(sched reg.Sched, task *models.QueuedTask) (error, int32) {
-	return nil, 1 << 20
+	s.mu.Lock()
+	idle, local := s.localCPU.Get(task.Pid)
+	if local {
+		s.localCPU.Delete(task.Pid)
+	}
+	s.mu.Unlock()
+	if local {
+		return nil, idle
+	}
+
+	s.strategyMu.RLock()
+	mask := s.cpuMasks[task.Tgid]
+	s.strategyMu.RUnlock()
+	if mask == nil {
+		return nil, cpuAny
+	}
+
+	candidates := mask
+	allowed, known := s.affinity.Allowed(task)
+	if !known {
+		return sched.DefaultSelectCPU(task)
+	}
+	if allowed != nil {
+		candidates = util.IntersectCPUs(mask, allowed)
+	}
+	if len(candidates) == 0 {
+		return sched.DefaultSelectCPU(task)
+	}
+
+	// Keep the task on its previous CPU when possible, otherwise spread over the candidates
+	if _, found := slices.BinarySearch(candidates, task.Cpu); found {
+		return nil, task.Cpu
+	}
+	s.strategyMu.Lock()
+	cpu := candidates[s.nextCPU%len(candidates)]
+	s.nextCPU++
+	s.strategyMu.Unlock()
+	return nil, cpu
+}
+
+// UpdateStrategyMap replaces the per-PID CPU masks with those of the given strategies and applies
+// the last mode switch strategy, if any
+func (s *SimplePlugin) UpdateStrategyMap(strategies []util.SchedulingStrategy) {
+	masks := make(map[int32][]int32)
+	mode := ""
+	s.strategyMu.RLock()
+	online := topology.OnlineCPUs(s.topology, s.affinity.NrCPUs())
+	s.strategyMu.RUnlock()
+	for _, strategy := range strategies {
+		if strategy.IsModeSwitch() {
+			mode = strategy.Mode
+			continue
+		}
+		if strategy.CPUs == "" {
+			continue
+		}
+		cpus, err := util.ParseCPUMask(strategy.CPUs, online)
+		if err != nil {
+			log.Printf("Ignoring CPU mask of PID %d: %v", strategy.PID, err)
+			continue
+		}
+		masks[int32(strategy.PID)] = cpus
+	}
+
+	s.strategyMu.Lock()
+	s.cpuMasks = masks
+	s.strategyMu.Unlock()
+
+	if mode == "" {
+		return
+	}
+	fifoMode, err := ParseMode(mode)
+	if err != nil {
+		log.Printf("Ignoring mode switch: %v", err)
+		return
+	}
+	s.SetMode(fifoMode)
 }
 
 // DetermineTimeSlice determines the time slice for the given task
 func (s *SimplePlugin) DetermineTimeSlice(sched reg.Sched, task *models.QueuedTask) uint64 {
 	// Always return default slice
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.sliceDefault
 }
 
 // GetPoolCount returns the number of tasks in the pool
 func (s *SimplePlugin) GetPoolCount() uint64 {
-	return uint64(len(s.taskPool))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint64(s.taskHeap.Len() + s.taskFIFO.Len() + s.localCount)
 }
 
 // enqueueTask processes a task for enqueueing
@@ -141,14 +323,15 @@ func (s *SimplePlugin) enqueueTask(queuedTask *models.QueuedTask) Task {
 		VTime:      queuedTask.Vtime,
 		Timestamp:  queuedTask.StartTs,
 	}
+	// Weighted vtime scheduling logic
+	if !s.fifoMode {
+		// Charge the time the task ran since it was last dispatched
+		s.updateStoppingTask(queuedTask, saturatingSub(queuedTask.StopTs, queuedTask.StartTs))
+	}
 	vtime := queuedTask.Vtime
 
-	// Weighted vtime scheduling logic
 	if !s.fifoMode {
-		// Limit the amount of budget that an idling task can accumulate to one slice
-		if vtime < saturatingSub(s.vtimeNow, s.sliceDefault) {
-			vtime = saturatingSub(s.vtimeNow, s.sliceDefault)
-		}
+		vtime = s.clampVtime(vtime)
 	}
 
 	// Ensure vtime is never 0 - use minimum value of 1 if needed
@@ -157,62 +340,69 @@ func (s *SimplePlugin) enqueueTask(queuedTask *models.QueuedTask) Task {
 	}
 
 	task.VTime = vtime
+	queuedTask.Vtime = vtime
 
 	return task
 }
 
-// getTaskFromPool retrieves the next task from the pool
+// clampVtime limits the amount of budget that an idling task can accumulate to one slice. Must be
+// called with mu held.
+func (s *SimplePlugin) clampVtime(vtime uint64) uint64 {
+	return max(vtime, saturatingSub(s.vtimeNow, s.sliceDefault))
+}
+
+// getTaskFromPool retrieves the next task from the pool. Must be called with mu held.
 func (s *SimplePlugin) getTaskFromPool() *models.QueuedTask {
-	if len(s.taskPool) == 0 {
-		return nil
+	// Idle CPUs are waiting for the tasks of the local queues, but a CPU that keeps refilling its
+	// queue must not starve the global pool
+	globalCount := s.taskHeap.Len() + s.taskFIFO.Len()
+	if s.localStreak < maxLocalStreak || globalCount == 0 {
+		if task := s.popLocal(); task != nil {
+			if globalCount > 0 {
+				s.localStreak++
+			}
+			if !s.fifoMode {
+				s.updateRunningTask(task)
+			}
+			return task
+		}
 	}
+	s.localStreak = 0
 
-	// Get the first task
-	task := &s.taskPool[0]
+	if s.fifoMode {
+		selectedTask := s.taskFIFO.Pop()
+		if selectedTask != nil {
+			s.clearLocalCPU(selectedTask)
+		}
+		return selectedTask
+	}
+	if s.taskHeap.Len() == 0 {
+		return nil
+	}
 
-	// Remove the first task from slice
-	selectedTask := task.QueuedTask
-	s.taskPool = s.taskPool[1:]
+	selectedTask := s.taskHeap.Pop().QueuedTask
+	s.clearLocalCPU(selectedTask)
 
 	// Update running task vtime (for weighted vtime scheduling)
-	if !s.fifoMode {
-		// Ensure task vtime is never 0 before updating global vtime
-		if selectedTask.Vtime == 0 {
-			selectedTask.Vtime = 1
-		}
-		s.updateRunningTask(selectedTask)
+	// Ensure task vtime is never 0 before updating global vtime
+	if selectedTask.Vtime == 0 {
+		selectedTask.Vtime = 1
 	}
+	s.updateRunningTask(selectedTask)
 
 	return selectedTask
 }
 
-// insertTaskToPool inserts a task into the pool
+// insertTaskToPool inserts a task into the pool. Must be called with mu held.
 func (s *SimplePlugin) insertTaskToPool(newTask Task) {
 	if s.fifoMode {
 		// FIFO: just append to end
-		s.taskPool = append(s.taskPool, newTask)
+		s.taskFIFO.Push(newTask.QueuedTask)
 		return
 	}
 
-	// Weighted vtime: insert in sorted order by vtime
-	insertIdx := len(s.taskPool) // Default to end
-	for i := 0; i < len(s.taskPool); i++ {
-		if lessTask(&newTask, &s.taskPool[i]) {
-			insertIdx = i
-			break
-		}
-	}
-
-	// Insert at the correct position
-	if insertIdx == len(s.taskPool) {
-		// Insert at end
-		s.taskPool = append(s.taskPool, newTask)
-	} else {
-		// Insert in middle - grow slice and shift elements
-		s.taskPool = append(s.taskPool, Task{}) // Add empty element at end
-		copy(s.taskPool[insertIdx+1:], s.taskPool[insertIdx:])
-		s.taskPool[insertIdx] = newTask
-	}
+	// Weighted vtime: ordered by vtime
+	s.taskHeap.Push(newTask)
 }
 
 // lessTask compares two tasks for priority ordering
@@ -246,7 +436,11 @@ func (s *SimplePlugin) updateStoppingTask(task *models.QueuedTask, execTime uint
 	}
 
 	// Scale the execution time by the inverse of the weight and charge
-	task.Vtime += execTime * 100 / task.Weight
+	weight := task.Weight
+	if weight == 0 {
+		weight = 100
+	}
+	task.Vtime += execTime * 100 / weight
 
 	// Ensure task vtime is never 0
 	if task.Vtime == 0 {
@@ -264,29 +458,70 @@ func saturatingSub(a, b uint64) uint64 {
 
 // GetMode returns whether the scheduler is in FIFO mode
 func (s *SimplePlugin) GetMode() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.fifoMode
 }
 
-// SetMode sets the scheduling mode
+// SetMode sets the scheduling mode and re-queues the queued tasks under it. Switching to FIFO
+// mode keeps their vtime order, switching to weighted vtime mode orders them by vtime after
+// limiting their budget as if they had just been enqueued. It is safe to call while the
+// scheduler is running.
 func (s *SimplePlugin) SetMode(fifoMode bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fifoMode == fifoMode {
+		return
+	}
 	s.fifoMode = fifoMode
+	if fifoMode {
+		for s.taskHeap.Len() > 0 {
+			s.taskFIFO.Push(s.taskHeap.Pop().QueuedTask)
+		}
+		return
+	}
+	for task := s.taskFIFO.Pop(); task != nil; task = s.taskFIFO.Pop() {
+		task.Vtime = max(s.clampVtime(task.Vtime), 1)
+		s.taskHeap.Push(Task{QueuedTask: task, VTime: task.Vtime, Timestamp: task.StartTs})
+	}
+}
+
+// ParseMode parses a scheduling mode name and reports whether it is FIFO mode
+func ParseMode(name string) (bool, error) {
+	switch name {
+	case ModeVtime:
+		return false, nil
+	case ModeFIFO:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown scheduling mode %q", name)
+	}
 }
 
 // GetStats returns scheduling statistics
 func (s *SimplePlugin) GetStats() (uint64, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.localQueueCount, s.globalQueueCount
 }
 
 // ResetStats resets scheduling statistics
 func (s *SimplePlugin) ResetStats() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.localQueueCount = 0
 	s.globalQueueCount = 0
 }
 
 // GetPoolStatus returns detailed pool status for debugging
 func (s *SimplePlugin) GetPoolStatus() (head, tail, count, capacity int) {
-	// For slice implementation: head=0, tail=len, count=len, capacity=cap
-	return 0, len(s.taskPool), len(s.taskPool), cap(s.taskPool)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// head=0, tail=len, count=len, capacity=cap
+	if s.fifoMode {
+		return 0, s.taskFIFO.Len(), s.taskFIFO.Len(), s.taskFIFO.Cap()
+	}
+	return 0, s.taskHeap.Len(), s.taskHeap.Len(), s.taskHeap.Cap()
 }
 
 func (s *SimplePlugin) GetChangedStrategies() ([]util.SchedulingStrategy, []util.SchedulingStrategy) {
@@ -53,14 +53,13 @@ func TestSimplePluginTaskPoolInitialization(t *testing.T) {
 		t.Errorf("Initial pool count = %d; want 0", simplePlugin.GetPoolCount())
 	}
 
-	// Verify task pool is allocated
-	if simplePlugin.taskPool == nil {
-		t.Error("Task pool is nil; expected allocated slice")
+	// Verify task pool starts empty, without pre-allocation
+	if simplePlugin.taskHeap.Len() != 0 || simplePlugin.taskFIFO.Len() != 0 {
+		t.Errorf("Task pool length = %d; want 0 (should start empty)",
+			simplePlugin.taskHeap.Len()+simplePlugin.taskFIFO.Len())
 	}
-
-	// Verify task pool starts empty but has capacity
-	if len(simplePlugin.taskPool) != 0 {
-		t.Errorf("Task pool length = %d; want 0 (should start empty)", len(simplePlugin.taskPool))
+	if _, _, _, capacity := simplePlugin.GetPoolStatus(); capacity != 0 {
+		t.Errorf("Task pool capacity = %d; want 0 (no pre-allocation)", capacity)
 	}
 
 	// Verify initial statistics
@@ -0,0 +1,212 @@
+package taskstate
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// DefaultCapacity is the number of PIDs a table holds when Options.Capacity is not set
+const DefaultCapacity = 8192
+
+// Options configures a Table
+type Options struct {
+	// Capacity bounds the number of tracked PIDs, the least recently used PID is evicted first
+	Capacity int
+	// MaxAge evicts PIDs that have not been updated for this many nanoseconds (0 disables)
+	MaxAge uint64
+	// Now returns the current time in nanoseconds (defaults to util.Now)
+	Now func() uint64
+	// ProcFS is the /proc filesystem used to detect exited PIDs (nil disables the liveness sweep)
+	ProcFS fs.FS
+}
+
+// Table is a bounded, concurrency-safe store of per-PID state. Each plugin keeps its own
+// payload type T, so several plugins can track different state for the same PID.
+type Table[T any] struct {
+	mu       sync.Mutex
+	capacity int
+	maxAge   uint64
+	now      func() uint64
+	procFS   fs.FS
+	entries  map[int32]*list.Element
+	lru      *list.List
+	seq      uint64 // Incremented on every update, so that a sweep can tell updated entries apart
+
+	nrEvicted uint64
+}
+
+type entry[T any] struct {
+	pid      int32
+	lastSeen uint64
+	seq      uint64 // Table sequence number of the last update
+	value    T
+}
+
+// New creates an empty table
+func New[T any](opts Options) *Table[T] {
+	t := &Table[T]{
+		capacity: opts.Capacity,
+		maxAge:   opts.MaxAge,
+		now:      opts.Now,
+		procFS:   opts.ProcFS,
+		entries:  make(map[int32]*list.Element),
+		lru:      list.New(),
+	}
+	if t.capacity <= 0 {
+		t.capacity = DefaultCapacity
+	}
+	if t.now == nil {
+		t.now = util.Now
+	}
+	return t
+}
+
+// Update calls fn with the state of pid, creating a zero value if the PID is not tracked yet.
+// fn runs with the table locked and must not call back into the table.
+func (t *Table[T]) Update(pid int32, fn func(v *T)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.seq++
+	if elem, exists := t.entries[pid]; exists {
+		e := elem.Value.(*entry[T])
+		e.lastSeen = now
+		e.seq = t.seq
+		t.lru.MoveToFront(elem)
+		fn(&e.value)
+		return
+	}
+
+	if t.lru.Len() >= t.capacity {
+		t.removeLocked(t.lru.Back())
+	}
+	e := &entry[T]{pid: pid, lastSeen: now, seq: t.seq}
+	t.entries[pid] = t.lru.PushFront(e)
+	fn(&e.value)
+}
+
+// Get returns a copy of the state of pid and whether the PID is tracked
+func (t *Table[T]) Get(pid int32) (T, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, exists := t.entries[pid]; exists {
+		return elem.Value.(*entry[T]).value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Delete stops tracking pid
+func (t *Table[T]) Delete(pid int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, exists := t.entries[pid]; exists {
+		t.lru.Remove(elem)
+		delete(t.entries, pid)
+	}
+}
+
+// Len returns the number of tracked PIDs
+func (t *Table[T]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lru.Len()
+}
+
+// Evicted returns the number of PIDs evicted because of capacity, age or liveness
+func (t *Table[T]) Evicted() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.nrEvicted
+}
+
+// EvictExpired removes PIDs that have not been updated within MaxAge and returns how many were removed
+func (t *Table[T]) EvictExpired() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxAge == 0 {
+		return 0
+	}
+
+	now := t.now()
+	count := 0
+	// The list is ordered by last update, so stop at the first fresh entry
+	for elem := t.lru.Back(); elem != nil; elem = t.lru.Back() {
+		if util.SaturatingSub(now, elem.Value.(*entry[T]).lastSeen) < t.maxAge {
+			break
+		}
+		t.removeLocked(elem)
+		count++
+	}
+	return count
+}
+
+// SweepDead removes PIDs that no longer exist in ProcFS and returns how many were removed.
+// PIDs updated while the sweep checks ProcFS are kept, they were reused by a new task.
+func (t *Table[T]) SweepDead() int {
+	if t.procFS == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	seqs := make(map[int32]uint64, len(t.entries))
+	for pid, elem := range t.entries {
+		seqs[pid] = elem.Value.(*entry[T]).seq
+	}
+	t.mu.Unlock()
+
+	// Stat outside the lock so that a slow /proc does not stall the scheduler
+	dead := make([]int32, 0)
+	for pid := range seqs {
+		if _, err := fs.Stat(t.procFS, strconv.Itoa(int(pid))); errors.Is(err, fs.ErrNotExist) {
+			dead = append(dead, pid)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := 0
+	for _, pid := range dead {
+		if elem, exists := t.entries[pid]; exists && elem.Value.(*entry[T]).seq == seqs[pid] {
+			t.removeLocked(elem)
+			count++
+		}
+	}
+	return count
+}
+
+// StartSweeper starts a background goroutine that periodically evicts expired and exited PIDs
+func (t *Table[T]) StartSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				expired := t.EvictExpired()
+				dead := t.SweepDead()
+				if expired+dead > 0 {
+					log.Printf("Task state sweep removed %d expired and %d exited PIDs", expired, dead)
+				}
+			}
+		}
+	}()
+}
+
+// removeLocked drops an entry, the caller holds t.mu
+func (t *Table[T]) removeLocked(elem *list.Element) {
+	t.lru.Remove(elem)
+	delete(t.entries, elem.Value.(*entry[T]).pid)
+	t.nrEvicted++
+}
@@ -0,0 +1,174 @@
+package taskstate
+
+import (
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+type runtimeState struct {
+	avgRuntime uint64
+}
+
+type cpuState struct {
+	lastCPU int32
+}
+
+// TestTableLRUEviction verifies the table stays bounded and evicts the least recently used PID
+func TestTableLRUEviction(t *testing.T) {
+	tbl := New[runtimeState](Options{Capacity: 2})
+
+	tbl.Update(100, func(s *runtimeState) { s.avgRuntime = 1 })
+	tbl.Update(200, func(s *runtimeState) { s.avgRuntime = 2 })
+	// Touch PID 100 so that PID 200 becomes the eviction candidate
+	tbl.Update(100, func(s *runtimeState) {})
+	tbl.Update(300, func(s *runtimeState) { s.avgRuntime = 3 })
+
+	if tbl.Len() != 2 {
+		t.Errorf("Len = %d; want 2", tbl.Len())
+	}
+	if _, ok := tbl.Get(200); ok {
+		t.Error("PID 200 should have been evicted")
+	}
+	if s, ok := tbl.Get(100); !ok || s.avgRuntime != 1 {
+		t.Errorf("PID 100 state = %+v, %v; want avgRuntime 1", s, ok)
+	}
+	if tbl.Evicted() != 1 {
+		t.Errorf("Evicted = %d; want 1", tbl.Evicted())
+	}
+}
+
+// TestTableTypedPayloads verifies that tables with different payloads are independent
+func TestTableTypedPayloads(t *testing.T) {
+	runtimes := New[runtimeState](Options{})
+	cpus := New[cpuState](Options{})
+
+	runtimes.Update(100, func(s *runtimeState) { s.avgRuntime = 5000 })
+	cpus.Update(100, func(s *cpuState) { s.lastCPU = 3 })
+
+	if s, _ := runtimes.Get(100); s.avgRuntime != 5000 {
+		t.Errorf("avgRuntime = %d; want 5000", s.avgRuntime)
+	}
+	if s, _ := cpus.Get(100); s.lastCPU != 3 {
+		t.Errorf("lastCPU = %d; want 3", s.lastCPU)
+	}
+
+	cpus.Delete(100)
+	if _, ok := cpus.Get(100); ok {
+		t.Error("PID 100 should be deleted from the CPU table")
+	}
+	if _, ok := runtimes.Get(100); !ok {
+		t.Error("Deleting from one table should not affect another")
+	}
+}
+
+// TestTableEvictExpired verifies age-based eviction
+func TestTableEvictExpired(t *testing.T) {
+	clock := uint64(1000)
+	tbl := New[runtimeState](Options{MaxAge: 100, Now: func() uint64 { return clock }})
+
+	tbl.Update(100, func(s *runtimeState) {})
+	clock += 60
+	tbl.Update(200, func(s *runtimeState) {})
+	clock += 60
+
+	if n := tbl.EvictExpired(); n != 1 {
+		t.Errorf("EvictExpired = %d; want 1", n)
+	}
+	if _, ok := tbl.Get(100); ok {
+		t.Error("PID 100 should have expired")
+	}
+	if _, ok := tbl.Get(200); !ok {
+		t.Error("PID 200 should still be tracked")
+	}
+}
+
+// TestTableSweepDead verifies that PIDs missing from /proc are removed
+func TestTableSweepDead(t *testing.T) {
+	procFS := fstest.MapFS{
+		"100/stat": &fstest.MapFile{Data: []byte("100 (alive) S")},
+		"300/stat": &fstest.MapFile{Data: []byte("300 (alive) R")},
+	}
+	tbl := New[runtimeState](Options{ProcFS: procFS})
+	for _, pid := range []int32{100, 200, 300, 400} {
+		tbl.Update(pid, func(s *runtimeState) {})
+	}
+
+	if n := tbl.SweepDead(); n != 2 {
+		t.Errorf("SweepDead = %d; want 2", n)
+	}
+	for pid, alive := range map[int32]bool{100: true, 200: false, 300: true, 400: false} {
+		if _, ok := tbl.Get(pid); ok != alive {
+			t.Errorf("PID %d tracked = %v; want %v", pid, ok, alive)
+		}
+	}
+
+	// Without a /proc filesystem the sweep is disabled
+	if n := New[runtimeState](Options{}).SweepDead(); n != 0 {
+		t.Errorf("SweepDead without ProcFS = %d; want 0", n)
+	}
+}
+
+// reusedFS is a /proc without any PID that calls reuse while a PID is looked up
+type reusedFS struct {
+	reuse func(name string)
+}
+
+func (f reusedFS) Open(name string) (fs.File, error) {
+	f.reuse(name)
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// TestTableSweepDeadKeepsReusedPIDs verifies that a PID updated while the sweep checks /proc is
+// kept, whether it was still tracked or removed and added again
+func TestTableSweepDeadKeepsReusedPIDs(t *testing.T) {
+	var tbl *Table[runtimeState]
+	tbl = New[runtimeState](Options{ProcFS: reusedFS{reuse: func(name string) {
+		switch name {
+		case "100":
+			tbl.Update(100, func(s *runtimeState) { s.avgRuntime = 1 })
+		case "200":
+			tbl.Delete(200)
+			tbl.Update(200, func(s *runtimeState) { s.avgRuntime = 2 })
+		}
+	}}})
+	for _, pid := range []int32{100, 200, 300} {
+		tbl.Update(pid, func(s *runtimeState) {})
+	}
+
+	if n := tbl.SweepDead(); n != 1 {
+		t.Errorf("SweepDead = %d; want 1", n)
+	}
+	for pid, want := range map[int32]uint64{100: 1, 200: 2} {
+		if s, ok := tbl.Get(pid); !ok || s.avgRuntime != want {
+			t.Errorf("PID %d state = %+v, %v; want the state of the new task", pid, s, ok)
+		}
+	}
+	if _, ok := tbl.Get(300); ok {
+		t.Error("Exited PID 300 still tracked")
+	}
+}
+
+// TestTableConcurrentUpdates verifies the table is safe for concurrent use
+func TestTableConcurrentUpdates(t *testing.T) {
+	tbl := New[runtimeState](Options{Capacity: 64})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				pid := int32((w*1000 + i) % 128)
+				tbl.Update(pid, func(s *runtimeState) { s.avgRuntime++ })
+				tbl.Get(pid)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if tbl.Len() > 64 {
+		t.Errorf("Len = %d; want <= 64", tbl.Len())
+	}
+}
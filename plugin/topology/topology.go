@@ -0,0 +1,148 @@
+package topology
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Gthulhu/plugin/plugin/util"
+)
+
+// SysfsCPUPath is the sysfs directory Load expects as the root of its filesystem
+const SysfsCPUPath = "/sys/devices/system/cpu"
+
+// CPU describes where a CPU sits in the cache and memory hierarchy
+type CPU struct {
+	ID       int32
+	Siblings []int32 // SMT siblings sharing the same core, including the CPU itself
+	LLC      []int32 // CPUs sharing the last-level cache, including the CPU itself
+	Node     int32   // NUMA node
+}
+
+// Topology is the CPU topology of the host
+type Topology struct {
+	Online []int32           // Online CPUs in ascending order
+	CPUs   map[int32]CPU     // Online CPUs by ID
+	Nodes  map[int32][]int32 // Online CPUs of each NUMA node
+}
+
+// Load reads the CPU topology from a filesystem rooted at SysfsCPUPath, such as
+// os.DirFS("/sys/devices/system/cpu") or a fake tree in tests
+func Load(fsys fs.FS) (*Topology, error) {
+	online, err := readCPUList(fsys, "online")
+	if err != nil {
+		return nil, err
+	}
+	if len(online) == 0 {
+		return nil, fmt.Errorf("no online CPUs")
+	}
+
+	topo := &Topology{
+		Online: online,
+		CPUs:   make(map[int32]CPU, len(online)),
+		Nodes:  make(map[int32][]int32),
+	}
+	for _, id := range online {
+		dir := "cpu" + strconv.Itoa(int(id))
+
+		siblings, err := readCPUList(fsys, path.Join(dir, "topology", "thread_siblings_list"))
+		if err != nil || len(siblings) == 0 {
+			siblings = []int32{id}
+		}
+		node := readNode(fsys, dir)
+		llc := readLLC(fsys, dir)
+
+		topo.CPUs[id] = CPU{ID: id, Siblings: siblings, LLC: llc, Node: node}
+		topo.Nodes[node] = append(topo.Nodes[node], id)
+	}
+
+	// Without cache information assume the whole node shares one LLC
+	for id, cpu := range topo.CPUs {
+		if len(cpu.LLC) == 0 {
+			cpu.LLC = topo.Nodes[cpu.Node]
+			topo.CPUs[id] = cpu
+		}
+	}
+	return topo, nil
+}
+
+// MaxCPU returns the highest online CPU ID
+func (t *Topology) MaxCPU() int32 {
+	return t.Online[len(t.Online)-1]
+}
+
+// NrCPUs returns the number of online CPUs
+func (t *Topology) NrCPUs() int {
+	return len(t.Online)
+}
+
+// OnlineCPUs returns the online CPUs of topo, or CPUs 0 to nrCPUs-1 when the topology is unknown
+func OnlineCPUs(topo *Topology, nrCPUs int) []int32 {
+	if topo != nil {
+		return topo.Online
+	}
+	cpus := make([]int32, nrCPUs)
+	for i := range cpus {
+		cpus[i] = int32(i)
+	}
+	return cpus
+}
+
+// readCPUList reads and parses a cpulist file
+func readCPUList(fsys fs.FS, name string) ([]int32, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return util.ParseCPUList(string(data))
+}
+
+// readNode returns the NUMA node of a CPU from its nodeN link, defaulting to node 0
+func readNode(fsys fs.FS, dir string) int32 {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return 0
+	}
+	for _, entry := range entries {
+		if id, ok := strings.CutPrefix(entry.Name(), "node"); ok {
+			if node, err := strconv.ParseInt(id, 10, 32); err == nil {
+				return int32(node)
+			}
+		}
+	}
+	return 0
+}
+
+// readLLC returns the CPUs sharing the highest-level cache of a CPU, or nil if unknown
+func readLLC(fsys fs.FS, dir string) []int32 {
+	cacheDir := path.Join(dir, "cache")
+	entries, err := fs.ReadDir(fsys, cacheDir)
+	if err != nil {
+		return nil
+	}
+
+	var llc []int32
+	maxLevel := int64(-1)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "index") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(cacheDir, entry.Name(), "level"))
+		if err != nil {
+			continue
+		}
+		level, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil || level <= maxLevel {
+			continue
+		}
+		shared, err := readCPUList(fsys, path.Join(cacheDir, entry.Name(), "shared_cpu_list"))
+		if err != nil || len(shared) == 0 {
+			continue
+		}
+		maxLevel = level
+		llc = shared
+	}
+	return llc
+}
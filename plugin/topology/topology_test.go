@@ -0,0 +1,92 @@
+package topology
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeSysfs builds a /sys/devices/system/cpu tree with 2-way SMT. Each entry of llcs lists the
+// first CPU of every LLC domain and nodes maps a CPU to its NUMA node.
+func fakeSysfs(nrCPUs int, llcs map[int]string, nodes func(cpu int) int) fstest.MapFS {
+	fsys := fstest.MapFS{
+		"online": &fstest.MapFile{Data: []byte("0-" + strconv.Itoa(nrCPUs-1) + "\n")},
+	}
+	for cpu := 0; cpu < nrCPUs; cpu++ {
+		dir := "cpu" + strconv.Itoa(cpu)
+		core := cpu &^ 1
+		fsys[dir+"/topology/thread_siblings_list"] = &fstest.MapFile{
+			Data: []byte(strconv.Itoa(core) + "-" + strconv.Itoa(core+1) + "\n"),
+		}
+		fsys[dir+"/node"+strconv.Itoa(nodes(cpu))+"/cpulist"] = &fstest.MapFile{}
+		fsys[dir+"/cache/index0/level"] = &fstest.MapFile{Data: []byte("1\n")}
+		fsys[dir+"/cache/index0/shared_cpu_list"] = &fstest.MapFile{
+			Data: []byte(strconv.Itoa(core) + "-" + strconv.Itoa(core+1) + "\n"),
+		}
+		if llcs != nil {
+			fsys[dir+"/cache/index3/level"] = &fstest.MapFile{Data: []byte("3\n")}
+			fsys[dir+"/cache/index3/shared_cpu_list"] = &fstest.MapFile{Data: []byte(llcs[cpu/4])}
+		}
+	}
+	return fsys
+}
+
+// TestLoadTopology verifies SMT, LLC and NUMA parsing from a fake sysfs tree
+func TestLoadTopology(t *testing.T) {
+	// node0: CPUs 0-7 split in two LLCs, node1: CPUs 8-11 in one LLC
+	llcs := map[int]string{0: "0-3", 1: "4-7", 2: "8-11"}
+	fsys := fakeSysfs(12, llcs, func(cpu int) int { return cpu / 8 })
+
+	topo, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if topo.NrCPUs() != 12 || topo.MaxCPU() != 11 {
+		t.Errorf("NrCPUs = %d, MaxCPU = %d; want 12 and 11", topo.NrCPUs(), topo.MaxCPU())
+	}
+
+	cpu5 := topo.CPUs[5]
+	if !reflect.DeepEqual(cpu5.Siblings, []int32{4, 5}) {
+		t.Errorf("CPU 5 siblings = %v; want [4 5]", cpu5.Siblings)
+	}
+	if !reflect.DeepEqual(cpu5.LLC, []int32{4, 5, 6, 7}) {
+		t.Errorf("CPU 5 LLC = %v; want [4 5 6 7]", cpu5.LLC)
+	}
+	if cpu5.Node != 0 || topo.CPUs[9].Node != 1 {
+		t.Errorf("Nodes of CPU 5 and 9 = %d, %d; want 0, 1", cpu5.Node, topo.CPUs[9].Node)
+	}
+	if !reflect.DeepEqual(topo.Nodes[1], []int32{8, 9, 10, 11}) {
+		t.Errorf("Node 1 CPUs = %v; want [8 9 10 11]", topo.Nodes[1])
+	}
+}
+
+// TestLoadTopologyWithoutLLC verifies that the NUMA node is used when no LLC is reported
+func TestLoadTopologyWithoutLLC(t *testing.T) {
+	fsys := fakeSysfs(4, nil, func(cpu int) int { return 0 })
+	// Drop the L1 entries too so that no cache information is left
+	for name := range fsys {
+		if strings.Contains(name, "/cache/") {
+			delete(fsys, name)
+		}
+	}
+
+	topo, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(topo.CPUs[2].LLC, []int32{0, 1, 2, 3}) {
+		t.Errorf("CPU 2 LLC = %v; want [0 1 2 3]", topo.CPUs[2].LLC)
+	}
+}
+
+// TestLoadTopologyErrors verifies that a tree without online CPUs is rejected
+func TestLoadTopologyErrors(t *testing.T) {
+	if _, err := Load(fstest.MapFS{}); err == nil {
+		t.Error("Load without an online file should fail")
+	}
+	if _, err := Load(fstest.MapFS{"online": &fstest.MapFile{Data: []byte("\n")}}); err == nil {
+		t.Error("Load with no online CPUs should fail")
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxCPUs bounds the CPU IDs of a cpulist, it is the largest NR_CPUS the kernel supports
+const MaxCPUs = 8192
+
+// ParseCPUList parses a kernel cpulist string such as "0-3,8,10-11" into sorted, unique CPU IDs.
+// CPU IDs must be below MaxCPUs.
+func ParseCPUList(list string) ([]int32, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return []int32{}, nil
+	}
+
+	cpus := make([]int32, 0)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil || first < 0 || first >= MaxCPUs {
+			return nil, fmt.Errorf("invalid cpulist entry %q", part)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.ParseInt(hi, 10, 64)
+			if err != nil || last < first || last >= MaxCPUs {
+				return nil, fmt.Errorf("invalid cpulist range %q", part)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, int32(cpu))
+		}
+		if len(cpus) > MaxCPUs {
+			// Overlapping ranges, drop the duplicates before going on
+			slices.Sort(cpus)
+			cpus = slices.Compact(cpus)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus), nil
+}
+
+// ParseCPUMask parses the cpulist of a scheduling strategy, which must name at least one CPU and
+// only CPUs of the sorted online list
+func ParseCPUMask(list string, online []int32) ([]int32, error) {
+	cpus, err := ParseCPUList(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("empty cpulist %q", list)
+	}
+	for _, cpu := range cpus {
+		if _, found := slices.BinarySearch(online, cpu); !found {
+			return nil, fmt.Errorf("cpulist %q names CPU %d, which is not online", list, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// IntersectCPUs returns the CPUs present in both sorted lists
+func IntersectCPUs(a, b []int32) []int32 {
+	result := make([]int32, 0, min(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
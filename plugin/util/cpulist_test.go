@@ -0,0 +1,103 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseCPUList verifies parsing of kernel cpulist strings
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int32
+		wantErr bool
+	}{
+		{input: "", want: []int32{}},
+		{input: "0\n", want: []int32{0}},
+		{input: "0-3", want: []int32{0, 1, 2, 3}},
+		{input: "0-3,8", want: []int32{0, 1, 2, 3, 8}},
+		{input: "10-11, 2,0-1", want: []int32{0, 1, 2, 10, 11}},
+		{input: "1,1,0-1", want: []int32{0, 1}},
+		{input: "3-1", wantErr: true},
+		{input: "a", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "0,,1", wantErr: true},
+		{input: "8191", want: []int32{8191}},
+		{input: "8192", wantErr: true},
+		{input: "2147483647", wantErr: true},
+		{input: "0-2147483647", wantErr: true},
+		{input: "0-2000000000", wantErr: true},
+		{input: "99999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCPUList(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCPUList(%q) = %v; want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCPUList(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCPUList(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestParseCPUListBounded verifies that the largest and overlapping ranges stay bounded by MaxCPUs
+func TestParseCPUListBounded(t *testing.T) {
+	for _, input := range []string{"0-8191", "0-8191,0-8191,100-200,0-8191", "8191,0-8191"} {
+		got, err := ParseCPUList(input)
+		if err != nil || len(got) != MaxCPUs || got[0] != 0 || got[MaxCPUs-1] != MaxCPUs-1 {
+			t.Errorf("ParseCPUList(%q) = %d CPUs, %v; want CPUs 0-%d", input, len(got), err, MaxCPUs-1)
+		}
+	}
+}
+
+// TestParseCPUMask verifies that strategy masks must name online CPUs only
+func TestParseCPUMask(t *testing.T) {
+	online := []int32{0, 1, 2, 3, 8, 9, 10, 11}
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "0-3"},
+		{input: "3"},
+		{input: "8-11"},
+		{input: "2-3,9"},
+		{input: "", wantErr: true},
+		{input: "4", wantErr: true},
+		{input: "2-4", wantErr: true},
+		{input: "7-8", wantErr: true},
+		{input: "12", wantErr: true},
+		{input: "0-2147483647", wantErr: true},
+		{input: "bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		if got, err := ParseCPUMask(tt.input, online); (err != nil) != tt.wantErr {
+			t.Errorf("ParseCPUMask(%q) = %v, %v; want error %v", tt.input, got, err, tt.wantErr)
+		}
+	}
+}
+
+// TestIntersectCPUs verifies intersection of sorted CPU lists
+func TestIntersectCPUs(t *testing.T) {
+	tests := []struct {
+		a, b []int32
+		want []int32
+	}{
+		{a: []int32{0, 1, 2, 3}, b: []int32{2, 3, 4}, want: []int32{2, 3}},
+		{a: []int32{0, 8}, b: []int32{1, 2}, want: []int32{}},
+		{a: []int32{}, b: []int32{1}, want: []int32{}},
+		{a: []int32{1, 5, 9}, b: []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, want: []int32{1, 5, 9}},
+	}
+	for _, tt := range tests {
+		if got := IntersectCPUs(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IntersectCPUs(%v, %v) = %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
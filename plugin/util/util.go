@@ -7,6 +7,20 @@ type SchedulingStrategy struct {
 	Priority      int    `json:"priority"`       // If > 0, set vtime to minimum vtime
 	ExecutionTime uint64 `json:"execution_time"` // Time slice for this process in nanoseconds
 	PID           int    `json:"pid"`            // Process ID to apply this strategy to
+
+	LatencyTargetNs uint64 `json:"latency_target_ns"` // If > 0, schedule as EDF with deadline now + target
+	CPUs            string `json:"cpus"`              // Cpulist (e.g. "0-3,8") restricting where the task may run
+	QuotaNs         uint64 `json:"quota_ns"`          // If > 0, runtime the matched tasks may consume per period
+	PeriodNs        uint64 `json:"period_ns"`         // Bandwidth period in nanoseconds (100ms if 0)
+	Gang            bool   `json:"gang"`              // If true, dispatch the runnable threads of the TGID together
+	Tickets         uint64 `json:"tickets,omitempty"` // If > 0, share of the process under the lottery and stride modes
+
+	Mode string `json:"mode,omitempty"` // With PID 0, the scheduling mode to switch to, for plugins supporting several modes
+}
+
+// IsModeSwitch reports whether the strategy switches the scheduling mode instead of applying to a process
+func (s SchedulingStrategy) IsModeSwitch() bool {
+	return s.PID == 0 && s.Mode != ""
 }
 
 // SchedulingStrategiesResponse represents the response structure from the API
@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Gthulhu/plugin/plugin"
+	"github.com/Gthulhu/plugin/plugin/plugintest"
+)
+
+// modeFactory returns a factory creating the plugin of a registered mode
+func modeFactory(mode string) plugin.PluginFactory {
+	return func(ctx context.Context, config *plugin.SchedConfig) (plugin.CustomScheduler, error) {
+		config.Mode = mode
+		return plugin.NewSchedulerPlugin(ctx, config)
+	}
+}
+
+// TestConformance runs the conformance suite against the built-in plugins
+func TestConformance(t *testing.T) {
+	for _, mode := range []string{"gthulhu", "simple", "simple-fifo", "rr", "prio", "mlfq", "eevdf", "lottery", "stride", "energy"} {
+		t.Run(mode, func(t *testing.T) {
+			plugintest.Run(t, modeFactory(mode), &plugin.SchedConfig{
+				Scheduler: plugin.Scheduler{
+					SliceNsDefault: 5000 * 1000,
+					SliceNsMin:     500 * 1000,
+				},
+			})
+		})
+	}
+}
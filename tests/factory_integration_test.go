@@ -295,6 +295,43 @@ func TestSimplePluginThroughFactory(t *testing.T) {
 			t.Errorf("Expected third task PID 300, got %d", task3.Pid)
 		}
 	})
+
+	t.Run("LocalDispatchPolicy", func(t *testing.T) {
+		config := &plugin.SchedConfig{
+			Mode:      "simple",
+			Scheduler: plugin.Scheduler{DispatchPolicy: "local"},
+		}
+
+		scheduler, err := plugin.NewSchedulerPlugin(context.TODO(), config)
+		if err != nil {
+			t.Fatalf("Failed to create simple plugin: %v", err)
+		}
+
+		// testSched always reports CPU 0 as idle
+		mockSched := &testSched{
+			tasks: []*models.QueuedTask{{Pid: 100, Weight: 100, Vtime: 5000, Tgid: 100}},
+		}
+		scheduler.DrainQueuedTask(mockSched)
+
+		task := scheduler.SelectQueuedTask(mockSched)
+		if task == nil {
+			t.Fatal("Expected a task, got nil")
+		}
+		if _, cpu := scheduler.SelectCPU(mockSched, task); cpu != 0 {
+			t.Errorf("Expected task on idle CPU 0, got %d", cpu)
+		}
+	})
+
+	t.Run("InvalidDispatchPolicy", func(t *testing.T) {
+		config := &plugin.SchedConfig{
+			Mode:      "simple",
+			Scheduler: plugin.Scheduler{DispatchPolicy: "bogus"},
+		}
+
+		if _, err := plugin.NewSchedulerPlugin(context.TODO(), config); err == nil {
+			t.Error("Expected an error for an unknown dispatch policy")
+		}
+	})
 }
 
 // TestMultiplePluginInstances tests creating multiple plugin instances
@@ -401,7 +438,7 @@ func TestMultiplePluginInstances(t *testing.T) {
 func TestRegisteredModesIntegration(t *testing.T) {
 	modes := plugin.GetRegisteredModes()
 
-	expectedModes := []string{"gthulhu", "simple", "simple-fifo"}
+	expectedModes := []string{"gthulhu", "simple", "simple-fifo", "rr", "prio", "mlfq", "eevdf", "lottery", "stride", "energy"}
 	modeMap := make(map[string]bool)
 	for _, mode := range modes {
 		modeMap[mode] = true
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/Gthulhu/plugin/plugin"
+	"github.com/Gthulhu/plugin/plugin/sim"
+)
+
+const (
+	fairnessSlice  = 5000 * 1000        // 5ms, the default slice of the simulator
+	fairnessWindow = 5000 * 1000 * 1000 // Simulated time over which shares are measured
+	fairnessCases  = 40                 // Random task sets per property
+	starvationNs   = 100 * 1000 * 1000  // Starvation threshold of the Gthulhu plugin
+	noAgingNs      = 3600 * 1000 * 1000 * 1000
+)
+
+// randomTasks returns between nrCPUs+1 and nrCPUs+extra CPU-bound tasks with weights in
+// [minWeight, maxWeight], so that every CPU is contended
+func randomTasks(r *rand.Rand, nrCPUs, extra int, minWeight, maxWeight uint64) []sim.TaskSpec {
+	specs := make([]sim.TaskSpec, nrCPUs+1+r.Intn(extra))
+	for i := range specs {
+		specs[i] = sim.TaskSpec{
+			Pid:    int32(100 + i),
+			Weight: minWeight + uint64(r.Int63n(int64(maxWeight-minWeight+1))),
+			Model:  sim.CPUBound(),
+		}
+	}
+	return specs
+}
+
+// weightedShares returns the fraction of the CPU time of nrCPUs CPUs each task should get in
+// proportion to its weight, a task getting at most one CPU and the rest going to the others
+func weightedShares(specs []sim.TaskSpec, nrCPUs int) []float64 {
+	shares := make([]float64, len(specs))
+	capped := make([]bool, len(specs))
+	limit := 1 / float64(nrCPUs)
+	for {
+		left, weight := 1.0, 0.0
+		for i, spec := range specs {
+			if capped[i] {
+				left -= limit
+			} else {
+				weight += float64(spec.Weight)
+			}
+		}
+		changed := false
+		for i, spec := range specs {
+			if capped[i] {
+				continue
+			}
+			shares[i] = left * float64(spec.Weight) / weight
+			if shares[i] > limit {
+				shares[i], capped[i], changed = limit, true, true
+			}
+		}
+		if !changed {
+			return shares
+		}
+	}
+}
+
+// newSimulation creates a simulation of a plugin mode running the given tasks
+func newSimulation(t *testing.T, config *plugin.SchedConfig, nrCPUs int, specs []sim.TaskSpec) *sim.Simulator {
+	t.Helper()
+	scheduler, err := plugin.NewSchedulerPlugin(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewSchedulerPlugin(%s): %v", config.Mode, err)
+	}
+	s := sim.New(scheduler, sim.Config{NrCPUs: nrCPUs, SliceDefault: fairnessSlice})
+	for _, spec := range specs {
+		if err := s.AddTask(spec); err != nil {
+			t.Fatalf("AddTask: %v", err)
+		}
+	}
+	return s
+}
+
+// runSimulation runs a simulation for duration more and fails the test on error
+func runSimulation(t *testing.T, s *sim.Simulator, duration uint64) *sim.Report {
+	t.Helper()
+	report, err := s.Run(duration)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return report
+}
+
+// checkShareProperty runs random sets of CPU-bound tasks on a plugin mode and checks that each
+// task gets its weighted share within tolerance, and that no task waits much longer than its share
+// implies
+func checkShareProperty(t *testing.T, mode string, tolerance float64) {
+	for seed := int64(0); seed < fairnessCases; seed++ {
+		t.Run("seed="+strconv.FormatInt(seed, 10), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+			nrCPUs := 1 + r.Intn(4)
+			specs := randomTasks(r, nrCPUs, 6, 25, 1000)
+			s := newSimulation(t, &plugin.SchedConfig{
+				Mode: mode,
+				Scheduler: plugin.Scheduler{
+					SliceNsDefault: fairnessSlice,
+					SliceNsMin:     fairnessSlice / 10,
+					// Aging trades the share of heavy tasks for the wait of light ones
+					StarvationThresholdNs: noAgingNs,
+				},
+			}, nrCPUs, specs)
+
+			// The Gthulhu plugin orders tasks by vtime plus their unweighted runtime, up to 100
+			// slices, shares only settle once every task has run that long
+			warmup := runSimulation(t, s, uint64(len(specs))*fairnessSlice*120/uint64(nrCPUs))
+			report := runSimulation(t, s, fairnessWindow)
+
+			var total float64
+			for i := range report.Tasks {
+				total += float64(report.Tasks[i].Runtime - warmup.Tasks[i].Runtime)
+			}
+			for i, want := range weightedShares(specs, nrCPUs) {
+				task := report.Tasks[i]
+				share := float64(task.Runtime-warmup.Tasks[i].Runtime) / total
+				if math.Abs(share-want) > tolerance*want {
+					t.Errorf("%d CPUs, PID %d weight %d share = %.4f; want %.4f", nrCPUs, task.Pid,
+						task.Weight, share, want)
+				}
+				// A task should run one slice every slice / (share * nrCPUs)
+				if bound := 6 * fairnessSlice / (want * float64(nrCPUs)); float64(task.MaxWait) > bound {
+					t.Errorf("%d CPUs, PID %d weight %d waited %d; want at most %.0f", nrCPUs, task.Pid,
+						task.Weight, task.MaxWait, bound)
+				}
+			}
+		})
+	}
+}
+
+// TestWeightedShareProperty verifies on random task sets that the simple weighted vtime mode gives
+// CPU-bound tasks CPU time in proportion to their weight
+func TestWeightedShareProperty(t *testing.T) {
+	checkShareProperty(t, "simple", 0.1)
+}
+
+// TestGthulhuWeightedShareProperty verifies on random task sets that the default path of the
+// Gthulhu plugin gives CPU-bound tasks CPU time in proportion to their weight
+func TestGthulhuWeightedShareProperty(t *testing.T) {
+	t.Skip("Known bug: every enqueue advances the global vruntime of the Gthulhu plugin by the " +
+		"weighted runtime of the task, so CPU-bound tasks all sit at the same vruntime floor and " +
+		"share the CPUs equally whatever their weight")
+	checkShareProperty(t, "gthulhu", 0.1)
+}
+
+// TestStarvationBoundProperty verifies on random task sets with weights from 1 to 10000 that the
+// Gthulhu plugin runs every task within the starvation threshold, one aging scan and the slices
+// of the tasks aged before it
+func TestStarvationBoundProperty(t *testing.T) {
+	for seed := int64(0); seed < fairnessCases; seed++ {
+		t.Run("seed="+strconv.FormatInt(seed, 10), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+			nrCPUs := 1 + r.Intn(4)
+			specs := randomTasks(r, nrCPUs, 12, 1, 10000)
+			s := newSimulation(t, &plugin.SchedConfig{
+				Mode: "gthulhu",
+				Scheduler: plugin.Scheduler{
+					SliceNsDefault:        fairnessSlice,
+					SliceNsMin:            fairnessSlice / 10,
+					StarvationThresholdNs: starvationNs,
+				},
+			}, nrCPUs, specs)
+			report := runSimulation(t, s, fairnessWindow)
+
+			bound := uint64(starvationNs + starvationNs/4 + len(specs)*fairnessSlice)
+			for _, task := range report.Tasks {
+				if task.MaxWait > bound {
+					t.Errorf("%d CPUs, PID %d weight %d waited %d; want at most %d", nrCPUs, task.Pid,
+						task.Weight, task.MaxWait, bound)
+				}
+			}
+		})
+	}
+}
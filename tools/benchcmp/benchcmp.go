@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// results holds the values of each metric of each benchmark, one per run
+type results struct {
+	names  []string // Benchmarks in the order they first appear
+	values map[string]map[string][]float64
+}
+
+// parseResults reads the output of go test -bench, ignoring lines that are not benchmark results
+func parseResults(r io.Reader) (*results, error) {
+	res := &results{values: make(map[string]map[string][]float64)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Name, iterations, then value and unit pairs
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+			continue
+		}
+		name := fields[0]
+		metrics, ok := res.values[name]
+		if !ok {
+			metrics = make(map[string][]float64)
+			res.values[name] = metrics
+			res.names = append(res.names, name)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s value %q", name, fields[i+1], fields[i])
+			}
+			metrics[fields[i+1]] = append(metrics[fields[i+1]], value)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// comparison is the change of one metric of one benchmark
+type comparison struct {
+	name, unit string
+	base, head float64
+	// delta is the relative change, positive when worse
+	delta      float64
+	regression bool
+}
+
+// compare returns the changes from base to head of the metrics found in both, in the order of
+// head, flagging those worse by more than threshold (0.1 for 10%). Runs of the same benchmark are
+// summarized by their median.
+func compare(base, head *results, threshold float64) []comparison {
+	var comparisons []comparison
+	for _, name := range head.names {
+		baseMetrics, ok := base.values[name]
+		if !ok {
+			continue
+		}
+		units := make([]string, 0, len(head.values[name]))
+		for unit := range head.values[name] {
+			if _, ok := baseMetrics[unit]; ok {
+				units = append(units, unit)
+			}
+		}
+		sort.Slice(units, func(i, j int) bool { return unitOrder(units[i]) < unitOrder(units[j]) })
+
+		for _, unit := range units {
+			c := comparison{
+				name: name,
+				unit: unit,
+				base: median(baseMetrics[unit]),
+				head: median(head.values[name][unit]),
+			}
+			switch {
+			case c.base == c.head:
+			case c.base == 0:
+				c.delta = math.Inf(1)
+			default:
+				c.delta = (c.head - c.base) / c.base
+			}
+			if higherIsBetter(unit) {
+				c.delta = -c.delta
+			}
+			c.regression = c.delta > threshold
+			comparisons = append(comparisons, c)
+		}
+	}
+	return comparisons
+}
+
+// missing returns the benchmarks of a that b does not have
+func missing(a, b *results) []string {
+	var names []string
+	for _, name := range a.names {
+		if _, ok := b.values[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// median returns the median of values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// higherIsBetter reports whether larger values of a metric are improvements, such as throughput
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+// unitOrder orders the standard metrics first
+func unitOrder(unit string) string {
+	switch unit {
+	case "ns/op":
+		return "0"
+	case "B/op":
+		return "1"
+	case "allocs/op":
+		return "2"
+	}
+	return "3" + unit
+}
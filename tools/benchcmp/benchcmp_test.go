@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const baseOutput = `goos: linux
+pkg: github.com/Gthulhu/plugin/plugin/gthulhu
+BenchmarkDrain/pool=10-8         	  208551	      6000 ns/op	       600 ns/task	     880 B/op	      11 allocs/op
+BenchmarkDrain/pool=10-8         	  208551	      6400 ns/op	       640 ns/task	     880 B/op	      11 allocs/op
+BenchmarkDrain/pool=10-8         	  208551	      9000 ns/op	       900 ns/task	     880 B/op	      11 allocs/op
+BenchmarkLookup-8                	13300215	        80 ns/op	       0 B/op	       0 allocs/op
+BenchmarkCopy-8                  	   10000	      1000 ns/op	  500.00 MB/s
+BenchmarkRemoved-8               	   10000	      1000 ns/op
+PASS
+ok  	github.com/Gthulhu/plugin/plugin/gthulhu	20.329s
+`
+
+const headOutput = `BenchmarkDrain/pool=10-8         	  208551	      6600 ns/op	       660 ns/task	     880 B/op	      12 allocs/op
+BenchmarkLookup-8                	13300215	        85 ns/op	       8 B/op	       1 allocs/op
+BenchmarkCopy-8                  	   10000	      1000 ns/op	  400.00 MB/s
+BenchmarkAdded-8                 	   10000	      1000 ns/op
+`
+
+// parse parses benchmark output, failing the test on error
+func parse(t *testing.T, output string) *results {
+	t.Helper()
+	res, err := parseResults(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("parseResults: %v", err)
+	}
+	return res
+}
+
+// TestParseResults verifies that every run of every metric is collected
+func TestParseResults(t *testing.T) {
+	res := parse(t, baseOutput)
+	wantNames := []string{"BenchmarkDrain/pool=10-8", "BenchmarkLookup-8", "BenchmarkCopy-8", "BenchmarkRemoved-8"}
+	if strings.Join(res.names, ",") != strings.Join(wantNames, ",") {
+		t.Errorf("names = %v; want %v", res.names, wantNames)
+	}
+	drain := res.values["BenchmarkDrain/pool=10-8"]
+	if len(drain["ns/op"]) != 3 || drain["ns/task"][2] != 900 || drain["allocs/op"][0] != 11 {
+		t.Errorf("BenchmarkDrain metrics = %v", drain)
+	}
+
+	if _, err := parseResults(strings.NewReader("BenchmarkBad-8 100 fast ns/op\n")); err == nil {
+		t.Error("parseResults accepted an invalid value")
+	}
+}
+
+// TestCompare verifies the medians, deltas and regressions
+func TestCompare(t *testing.T) {
+	comparisons := compare(parse(t, baseOutput), parse(t, headOutput), 0.1)
+
+	type key struct{ name, unit string }
+	got := make(map[key]comparison)
+	var order []string
+	for _, c := range comparisons {
+		got[key{c.name, c.unit}] = c
+		if c.name == "BenchmarkDrain/pool=10-8" {
+			order = append(order, c.unit)
+		}
+	}
+	if strings.Join(order, ",") != "ns/op,B/op,allocs/op,ns/task" {
+		t.Errorf("Units ordered %v; want the standard metrics first", order)
+	}
+
+	tests := []struct {
+		name, unit string
+		base       float64
+		delta      float64
+		regression bool
+	}{
+		// The median of 6000, 6400 and 9000 is 6400
+		{"BenchmarkDrain/pool=10-8", "ns/op", 6400, 0.03125, false},
+		{"BenchmarkDrain/pool=10-8", "allocs/op", 11, 1.0 / 11, false},
+		{"BenchmarkLookup-8", "ns/op", 80, 0.0625, false},
+		{"BenchmarkLookup-8", "allocs/op", 0, math.Inf(1), true},
+		// Lower throughput is worse
+		{"BenchmarkCopy-8", "MB/s", 500, 0.2, true},
+		{"BenchmarkCopy-8", "ns/op", 1000, 0, false},
+	}
+	for _, tt := range tests {
+		c, ok := got[key{tt.name, tt.unit}]
+		if !ok {
+			t.Errorf("%s %s not compared", tt.name, tt.unit)
+			continue
+		}
+		sameDelta := c.delta == tt.delta || math.Abs(c.delta-tt.delta) < 1e-9
+		if c.base != tt.base || !sameDelta || c.regression != tt.regression {
+			t.Errorf("%s %s = %+v; want base %g, delta %g, regression %v", tt.name, tt.unit, c, tt.base, tt.delta, tt.regression)
+		}
+	}
+	if _, ok := got[key{"BenchmarkRemoved-8", "ns/op"}]; ok {
+		t.Error("BenchmarkRemoved compared without head results")
+	}
+}
+
+// TestMissing verifies that benchmarks found on one side only are reported
+func TestMissing(t *testing.T) {
+	base, head := parse(t, baseOutput), parse(t, headOutput)
+	if got := missing(base, head); len(got) != 1 || got[0] != "BenchmarkRemoved-8" {
+		t.Errorf("missing(base, head) = %v; want BenchmarkRemoved-8", got)
+	}
+	if got := missing(head, base); len(got) != 1 || got[0] != "BenchmarkAdded-8" {
+		t.Errorf("missing(head, base) = %v; want BenchmarkAdded-8", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Command benchcmp compares two outputs of go test -bench and flags the metrics that regressed
+// by more than a threshold. Runs repeated with -count are summarized by their median. It exits
+// with status 1 when there is a regression, so that it can gate a change.
+//
+//	go test -run '^$' -bench . -count 5 ./plugin/... > old.txt
+//	go test -run '^$' -bench . -count 5 ./plugin/... > new.txt
+//	go run ./tools/benchcmp old.txt new.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "change in percent above which a metric regressed")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: benchcmp [-threshold <percent>] <base> <head>")
+		os.Exit(2)
+	}
+
+	base, err := readResults(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	head, err := readResults(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	comparisons := compare(base, head, *threshold/100)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "benchmark\tunit\tbase\thead\tdelta\t\t")
+	var nrRegressions int
+	for _, c := range comparisons {
+		mark := ""
+		if c.regression {
+			mark = "REGRESSION"
+			nrRegressions++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", c.name, c.unit, formatValue(c.base), formatValue(c.head),
+			formatDelta(c), mark)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for _, name := range missing(base, head) {
+		fmt.Printf("%s: only in %s\n", name, flag.Arg(0))
+	}
+	for _, name := range missing(head, base) {
+		fmt.Printf("%s: only in %s\n", name, flag.Arg(1))
+	}
+	fmt.Printf("%d metrics compared, %d regressions above %g%%\n", len(comparisons), nrRegressions, *threshold)
+	if nrRegressions > 0 {
+		os.Exit(1)
+	}
+}
+
+// readResults parses a file of benchmark results
+func readResults(path string) (res *results, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			res, err = nil, closeErr
+		}
+	}()
+	res, err = parseResults(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return res, nil
+}
+
+// formatValue formats a metric value without an exponent
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatDelta formats a change as a signed percentage of the base value, "+" being worse
+func formatDelta(c comparison) string {
+	switch {
+	case math.IsInf(c.delta, 1):
+		return "+inf%"
+	case c.delta == 0:
+		return "~"
+	}
+	return fmt.Sprintf("%+.1f%%", c.delta*100)
+}
@@ -0,0 +1,63 @@
+// Command replay replays a recording made by replay.Recorder into a plugin mode and prints the
+// decisions that differ from the recording. It exits with status 1 when there is a difference, so
+// that it can drive git bisect run.
+//
+//	go run ./tools/replay -mode eevdf recording.jsonl
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Gthulhu/plugin/plugin"
+	"github.com/Gthulhu/plugin/plugin/replay"
+)
+
+func main() {
+	mode := flag.String("mode", "", "plugin mode to replay the recording into")
+	sliceNs := flag.Uint64("slice-ns", 0, "default time slice in nanoseconds (0 uses the plugin default)")
+	maxDiffs := flag.Int("max-diffs", 10, "number of diffs to print (0 prints all of them)")
+	flag.Parse()
+	if *mode == "" || flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay -mode <mode> [-slice-ns <ns>] [-max-diffs <n>] <recording>")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	calls, err := replay.ReadRecording(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(2)
+	}
+
+	config := &plugin.SchedConfig{
+		Mode:      *mode,
+		Scheduler: plugin.Scheduler{SliceNsDefault: *sliceNs},
+	}
+	diffs, err := replay.ReplayMode(context.Background(), config, calls)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for i, diff := range diffs {
+		if *maxDiffs > 0 && i == *maxDiffs {
+			fmt.Printf("... %d more\n", len(diffs)-i)
+			break
+		}
+		fmt.Println(diff)
+	}
+	fmt.Printf("%d calls replayed, %d diffs\n", len(calls), len(diffs))
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}